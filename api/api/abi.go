@@ -0,0 +1,778 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	arraySuffixRegex = regexp.MustCompile(`^(\[[0-9]*\])*$`)
+	sizedTypeRegex   = regexp.MustCompile(`^(uint|int|bytes)([0-9]+)$`)
+	bigIntType       = reflect.TypeOf(new(big.Int))
+
+	// words that may appear between a parameter type and its name in a
+	// human-readable signature and carry no ABI meaning
+	paramModifiers = map[string]struct{}{
+		"memory":   {},
+		"calldata": {},
+		"storage":  {},
+		"payable":  {},
+	}
+)
+
+// ParseAbiType parses a Solidity type expression such as "uint8", "bytes32[]",
+// "(address,uint256)[2]" or "tuple(address to, uint256 amount)" into an abi.Type.
+func ParseAbiType(typeStr string) (abi.Type, error) {
+	arg, err := parseAbiParam(typeStr)
+	if err != nil {
+		return abi.Type{}, err
+	}
+	if arg.Name != "" {
+		return abi.Type{}, fmt.Errorf("invalid type %q: unexpected name %q", typeStr, arg.Name)
+	}
+	return newAbiType(arg)
+}
+
+func newAbiType(arg abi.ArgumentMarshaling) (abi.Type, error) {
+	typ, err := abi.NewType(arg.Type, "", arg.Components)
+	if err != nil {
+		return abi.Type{}, fmt.Errorf("invalid type %q: %v", arg.Type, err)
+	}
+	return typ, nil
+}
+
+// parseAbiParam parses a single parameter declaration, e.g. "uint256",
+// "address indexed from" or "(uint112,uint112) reserves", into the marshaling
+// form understood by abi.NewType.
+func parseAbiParam(param string) (abi.ArgumentMarshaling, error) {
+	param = strings.TrimSpace(param)
+	if param == "" {
+		return abi.ArgumentMarshaling{}, fmt.Errorf("empty type")
+	}
+
+	var arg abi.ArgumentMarshaling
+	var rest string
+
+	if strings.HasPrefix(param, "tuple(") {
+		param = param[len("tuple"):]
+	}
+	if strings.HasPrefix(param, "(") {
+		end, err := matchingParen(param)
+		if err != nil {
+			return abi.ArgumentMarshaling{}, err
+		}
+		suffix, remaining := splitArraySuffix(param[end+1:])
+
+		components, err := parseAbiParamList(param[1:end])
+		if err != nil {
+			return abi.ArgumentMarshaling{}, err
+		}
+		for i := range components {
+			if components[i].Name == "" {
+				components[i].Name = fmt.Sprintf("field%d", i)
+			}
+		}
+
+		arg.Type = "tuple" + suffix
+		arg.Components = components
+		rest = remaining
+	} else {
+		fields := strings.Fields(param)
+		base, suffix := fields[0], ""
+		if i := strings.Index(base, "["); i != -1 {
+			base, suffix = base[:i], base[i:]
+		}
+		if !arraySuffixRegex.MatchString(suffix) {
+			return abi.ArgumentMarshaling{}, fmt.Errorf("invalid array suffix in type %q", fields[0])
+		}
+
+		base = normalizeElementaryType(base)
+		if err := checkElementarySize(base); err != nil {
+			return abi.ArgumentMarshaling{}, err
+		}
+		arg.Type = base + suffix
+		rest = strings.Join(fields[1:], " ")
+	}
+
+	for _, word := range strings.Fields(rest) {
+		if _, ok := paramModifiers[word]; ok {
+			continue
+		}
+		if word == "indexed" {
+			arg.Indexed = true
+			continue
+		}
+		if arg.Name != "" {
+			return abi.ArgumentMarshaling{}, fmt.Errorf("unexpected token %q after parameter %q", word, arg.Name)
+		}
+		arg.Name = word
+	}
+
+	return arg, nil
+}
+
+// parseAbiParamList parses a comma separated parameter list without the
+// enclosing parentheses.
+func parseAbiParamList(list string) ([]abi.ArgumentMarshaling, error) {
+	if strings.TrimSpace(list) == "" {
+		return []abi.ArgumentMarshaling{}, nil
+	}
+
+	params := []abi.ArgumentMarshaling{}
+	for _, part := range splitTopLevel(list, ',') {
+		param, err := parseAbiParam(part)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, param)
+	}
+	return params, nil
+}
+
+func normalizeElementaryType(base string) string {
+	switch base {
+	case "uint":
+		return "uint256"
+	case "int":
+		return "int256"
+	case "byte":
+		return "bytes1"
+	}
+	return base
+}
+
+// checkElementarySize rejects the sizes abi.NewType lets through but Solidity
+// has no type for: uintN and intN need N a multiple of 8 up to 256, bytesN
+// N from 1 to 32.
+func checkElementarySize(base string) error {
+	match := sizedTypeRegex.FindStringSubmatch(base)
+	if match == nil {
+		return nil
+	}
+	size, err := strconv.Atoi(match[2])
+	if match[1] == "bytes" {
+		if err != nil || size < 1 || size > 32 || match[2][0] == '0' {
+			return fmt.Errorf("invalid type %q: bytesN needs N from 1 to 32", base)
+		}
+		return nil
+	}
+	if err != nil || size < 8 || size > 256 || size%8 != 0 || match[2][0] == '0' {
+		return fmt.Errorf("invalid type %q: %sN needs N a multiple of 8 up to 256", base, match[1])
+	}
+	return nil
+}
+
+// splitArraySuffix splits the leading "[..][..]" run off s.
+func splitArraySuffix(s string) (string, string) {
+	end := 0
+	for end < len(s) && s[end] == '[' {
+		closing := strings.IndexByte(s[end:], ']')
+		if closing == -1 {
+			break
+		}
+		end += closing + 1
+	}
+	return s[:end], s[end:]
+}
+
+func matchingParen(s string) (int, error) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unbalanced parentheses in %q", s)
+}
+
+// splitTopLevel splits s on sep, ignoring separators nested inside
+// parentheses or brackets.
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// ParseAbiValue converts a query string or decoded JSON value into the Go
+// value abi packing expects for typ. Arrays and tuples given as strings are
+// parsed as JSON, tuples either as an object keyed by component name or as a
+// positional array.
+func ParseAbiValue(typ abi.Type, value interface{}) (interface{}, error) {
+	input := value
+
+	switch typ.T {
+	case abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+		if s, ok := value.(string); ok {
+			decoder := json.NewDecoder(strings.NewReader(s))
+			decoder.UseNumber()
+			if err := decoder.Decode(&input); err != nil {
+				return nil, fmt.Errorf("%s value must be JSON: %v", typ.String(), err)
+			}
+		}
+	}
+
+	converted, err := convertAbiValue(typ, input)
+	if err != nil {
+		return nil, err
+	}
+	return converted.Interface(), nil
+}
+
+// convertAbiValue converts a string or decoded JSON value into a reflect.Value
+// of typ.GetType().
+func convertAbiValue(typ abi.Type, value interface{}) (reflect.Value, error) {
+	switch typ.T {
+	case abi.UintTy, abi.IntTy:
+		n, err := parseBigInt(value)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid %s: %v", typ.String(), err)
+		}
+		if err := checkIntRange(typ, n); err != nil {
+			return reflect.Value{}, err
+		}
+
+		goType := typ.GetType()
+		if goType == bigIntType {
+			return reflect.ValueOf(n), nil
+		}
+		out := reflect.New(goType).Elem()
+		if typ.T == abi.UintTy {
+			out.SetUint(n.Uint64())
+		} else {
+			out.SetInt(n.Int64())
+		}
+		return out, nil
+
+	case abi.BoolTy:
+		switch v := value.(type) {
+		case bool:
+			return reflect.ValueOf(v), nil
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("invalid bool: %q", v)
+			}
+			return reflect.ValueOf(b), nil
+		}
+		return reflect.Value{}, fmt.Errorf("invalid bool: %v", value)
+
+	case abi.AddressTy:
+		s, ok := value.(string)
+		if !ok || !common.IsHexAddress(strings.TrimSpace(s)) {
+			return reflect.Value{}, fmt.Errorf("invalid address: %v", value)
+		}
+		return reflect.ValueOf(common.HexToAddress(strings.TrimSpace(s))), nil
+
+	case abi.StringTy:
+		s, ok := value.(string)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("invalid string: %v", value)
+		}
+		return reflect.ValueOf(s), nil
+
+	case abi.BytesTy:
+		data, err := parseHexBytes(value)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid bytes: %v", err)
+		}
+		return reflect.ValueOf(data), nil
+
+	case abi.FixedBytesTy, abi.FunctionTy:
+		data, err := parseHexBytes(value)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid %s: %v", typ.String(), err)
+		}
+		out := reflect.New(typ.GetType()).Elem()
+		if len(data) != out.Len() {
+			return reflect.Value{}, fmt.Errorf("%s expects %d bytes, got %d", typ.String(), out.Len(), len(data))
+		}
+		reflect.Copy(out, reflect.ValueOf(data))
+		return out, nil
+
+	case abi.SliceTy, abi.ArrayTy:
+		items, ok := value.([]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("%s expects a JSON array", typ.String())
+		}
+
+		var out reflect.Value
+		if typ.T == abi.SliceTy {
+			out = reflect.MakeSlice(typ.GetType(), len(items), len(items))
+		} else {
+			if len(items) != typ.Size {
+				return reflect.Value{}, fmt.Errorf("%s expects %d elements, got %d", typ.String(), typ.Size, len(items))
+			}
+			out = reflect.New(typ.GetType()).Elem()
+		}
+
+		for i, item := range items {
+			elem, err := convertAbiValue(*typ.Elem, item)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("element %d: %w", i, err)
+			}
+			out.Index(i).Set(elem)
+		}
+		return out, nil
+
+	case abi.TupleTy:
+		out := reflect.New(typ.TupleType).Elem()
+
+		switch v := value.(type) {
+		case []interface{}:
+			if len(v) != len(typ.TupleElems) {
+				return reflect.Value{}, fmt.Errorf("%s expects %d fields, got %d", typ.String(), len(typ.TupleElems), len(v))
+			}
+			for i, item := range v {
+				field, err := convertAbiValue(*typ.TupleElems[i], item)
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("field %s: %w", typ.TupleRawNames[i], err)
+				}
+				out.Field(i).Set(field)
+			}
+		case map[string]interface{}:
+			for i, name := range typ.TupleRawNames {
+				item, ok := v[name]
+				if !ok {
+					return reflect.Value{}, fmt.Errorf("missing tuple field %s", name)
+				}
+				field, err := convertAbiValue(*typ.TupleElems[i], item)
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("field %s: %w", name, err)
+				}
+				out.Field(i).Set(field)
+			}
+		default:
+			return reflect.Value{}, fmt.Errorf("%s expects a JSON object or array", typ.String())
+		}
+		return out, nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("unsupported parameter type: %s", typ.String())
+}
+
+// parseBigInt accepts decimal or 0x-prefixed hex numbers, optionally negative,
+// given either as strings or JSON numbers.
+func parseBigInt(value interface{}) (*big.Int, error) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case json.Number:
+		s = v.String()
+	default:
+		return nil, fmt.Errorf("expected a number, got %v", value)
+	}
+
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	digits := strings.TrimPrefix(s, "-")
+
+	base := 10
+	if strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X") {
+		base = 16
+		digits = digits[2:]
+	}
+
+	n, ok := new(big.Int).SetString(digits, base)
+	if !ok || digits == "" {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	if negative {
+		n.Neg(n)
+	}
+	return n, nil
+}
+
+func checkIntRange(typ abi.Type, n *big.Int) error {
+	if typ.T == abi.UintTy {
+		max := new(big.Int).Lsh(common.Big1, uint(typ.Size))
+		if n.Sign() < 0 || n.Cmp(max) >= 0 {
+			return fmt.Errorf("value %s out of range for %s", n, typ.String())
+		}
+		return nil
+	}
+
+	limit := new(big.Int).Lsh(common.Big1, uint(typ.Size-1))
+	if n.Cmp(new(big.Int).Neg(limit)) < 0 || n.Cmp(limit) >= 0 {
+		return fmt.Errorf("value %s out of range for %s", n, typ.String())
+	}
+	return nil
+}
+
+func parseHexBytes(value interface{}) ([]byte, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected a 0x-prefixed hex string, got %v", value)
+	}
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "0x") && !strings.HasPrefix(s, "0X") {
+		return nil, fmt.Errorf("value must start with 0x")
+	}
+	data, err := hex.DecodeString(s[2:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex %q", s)
+	}
+	return data, nil
+}
+
+// FunctionSignature is a parsed human-readable function signature such as
+// "getReserves()(uint112,uint112,uint32)" or
+// "function getPair(address,address) view returns (address)".
+type FunctionSignature struct {
+	Name    string
+	Inputs  abi.Arguments
+	Outputs abi.Arguments
+}
+
+// ParseFunctionSignature parses "name(inputs)" optionally preceded by the
+// function keyword and followed by visibility / mutability keywords and an
+// output list, with or without "returns".
+func ParseFunctionSignature(signature string) (*FunctionSignature, error) {
+	signature = strings.TrimSpace(signature)
+	body := strings.TrimSpace(strings.TrimPrefix(signature, "function "))
+
+	start := strings.IndexByte(body, '(')
+	if start <= 0 {
+		return nil, fmt.Errorf("invalid function signature %q", signature)
+	}
+	name := strings.TrimSpace(body[:start])
+
+	end, err := matchingParen(body[start:])
+	if err != nil {
+		return nil, err
+	}
+	inputs, err := parseAbiArguments(body[start+1 : start+end])
+	if err != nil {
+		return nil, fmt.Errorf("invalid inputs in %q: %v", signature, err)
+	}
+
+	var outputs abi.Arguments
+	rest := skipFunctionModifiers(body[start+end+1:])
+	if strings.HasPrefix(rest, "returns") {
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, "returns"))
+		if !strings.HasPrefix(rest, "(") {
+			return nil, fmt.Errorf("invalid function signature %q: expected output list after returns", signature)
+		}
+	}
+	if strings.HasPrefix(rest, "(") {
+		end, err := matchingParen(rest)
+		if err != nil {
+			return nil, err
+		}
+		outputs, err = parseAbiArguments(rest[1:end])
+		if err != nil {
+			return nil, fmt.Errorf("invalid outputs in %q: %v", signature, err)
+		}
+		rest = skipFunctionModifiers(rest[end+1:])
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("invalid function signature %q: unexpected %q", signature, rest)
+	}
+
+	return &FunctionSignature{
+		Name:    name,
+		Inputs:  inputs,
+		Outputs: outputs,
+	}, nil
+}
+
+// skipFunctionModifiers drops leading visibility and mutability keywords.
+func skipFunctionModifiers(s string) string {
+	s = strings.TrimSpace(s)
+	for {
+		word := s
+		if i := strings.IndexAny(s, " ("); i != -1 {
+			word = s[:i]
+		}
+		switch word {
+		case "external", "public", "internal", "private", "view", "pure", "payable", "nonpayable", "constant", "virtual", "override":
+			s = strings.TrimSpace(s[len(word):])
+		default:
+			return s
+		}
+	}
+}
+
+// Signature returns the canonical signature used to derive the selector.
+func (f *FunctionSignature) Signature() string {
+	types := make([]string, 0, len(f.Inputs))
+	for _, input := range f.Inputs {
+		types = append(types, input.Type.String())
+	}
+	return fmt.Sprintf("%s(%s)", f.Name, strings.Join(types, ","))
+}
+
+// Selector returns the first 4 bytes of the keccak256 hash of the signature.
+func (f *FunctionSignature) Selector() []byte {
+	return crypto.Keccak256([]byte(f.Signature()))[:4]
+}
+
+// EncodeCall converts args to the input types and packs them behind the
+// selector. Errors name the offending argument.
+func (f *FunctionSignature) EncodeCall(args []interface{}) ([]byte, error) {
+	if len(args) != len(f.Inputs) {
+		return nil, fmt.Errorf("%s expects %d arguments, got %d", f.Signature(), len(f.Inputs), len(args))
+	}
+
+	values, err := convertAbiArgs(f.Inputs, args)
+	if err != nil {
+		return nil, err
+	}
+
+	packed, err := f.Inputs.Pack(values...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack values: %v", err)
+	}
+	return append(f.Selector(), packed...), nil
+}
+
+func parseAbiArguments(list string) (abi.Arguments, error) {
+	params, err := parseAbiParamList(list)
+	if err != nil {
+		return nil, err
+	}
+	return newAbiArguments(params)
+}
+
+func newAbiArguments(params []abi.ArgumentMarshaling) (abi.Arguments, error) {
+	arguments := abi.Arguments{}
+	for _, param := range params {
+		typ, err := newAbiType(param)
+		if err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, abi.Argument{
+			Name:    param.Name,
+			Type:    typ,
+			Indexed: param.Indexed,
+		})
+	}
+	return arguments, nil
+}
+
+// DecodeAbiValues unpacks ABI encoded data and converts every value into a
+// JSON friendly form.
+func DecodeAbiValues(arguments abi.Arguments, data []byte) ([]interface{}, error) {
+	values, err := arguments.UnpackValues(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode values: %v", err)
+	}
+
+	decoded := make([]interface{}, len(values))
+	for i, value := range values {
+		decoded[i] = FormatAbiValue(arguments[i].Type, value)
+	}
+	return decoded, nil
+}
+
+// FormatAbiValue converts an unpacked ABI value into JSON friendly form:
+// integers become decimal strings, addresses are checksummed, byte values are
+// 0x hex and tuples become objects keyed by field name.
+func FormatAbiValue(typ abi.Type, value interface{}) interface{} {
+	val := reflect.ValueOf(value)
+
+	switch typ.T {
+	case abi.UintTy, abi.IntTy:
+		if n, ok := value.(*big.Int); ok {
+			return n.String()
+		}
+		return fmt.Sprintf("%d", value)
+
+	case abi.AddressTy:
+		return value.(common.Address).Hex()
+
+	case abi.BytesTy:
+		return hexutil.Encode(value.([]byte))
+
+	case abi.FixedBytesTy, abi.FunctionTy:
+		data := make([]byte, val.Len())
+		reflect.Copy(reflect.ValueOf(data), val)
+		return hexutil.Encode(data)
+
+	case abi.SliceTy, abi.ArrayTy:
+		items := make([]interface{}, val.Len())
+		for i := range items {
+			items[i] = FormatAbiValue(*typ.Elem, val.Index(i).Interface())
+		}
+		return items
+
+	case abi.TupleTy:
+		fields := make(map[string]interface{}, len(typ.TupleElems))
+		for i, name := range typ.TupleRawNames {
+			fields[name] = FormatAbiValue(*typ.TupleElems[i], val.Field(i).Interface())
+		}
+		return fields
+	}
+
+	return value
+}
+
+// ResolveAbiMethod picks the method of parsedABI called methodName whose
+// inputs accept args and returns it with the converted argument values.
+// Overloads are resolved by argument count and then by which input types the
+// values convert to; methodName may also be a full signature.
+func ResolveAbiMethod(parsedABI abi.ABI, methodName string, args []interface{}) (*abi.Method, []interface{}, error) {
+	wantSig := ""
+	if strings.Contains(methodName, "(") {
+		signature, err := ParseFunctionSignature(methodName)
+		if err != nil {
+			return nil, nil, err
+		}
+		methodName, wantSig = signature.Name, signature.Signature()
+	}
+
+	var named []abi.Method
+	for _, method := range parsedABI.Methods {
+		if method.RawName != methodName || (wantSig != "" && method.Sig != wantSig) {
+			continue
+		}
+		named = append(named, method)
+	}
+	if len(named) == 0 {
+		if wantSig != "" {
+			return nil, nil, fmt.Errorf("method %s not found in ABI", wantSig)
+		}
+		return nil, nil, fmt.Errorf("method %s not found in ABI", methodName)
+	}
+	sort.Slice(named, func(i, j int) bool { return named[i].Sig < named[j].Sig })
+
+	type candidate struct {
+		method abi.Method
+		values []interface{}
+	}
+	var matches []candidate
+	var failures []string
+
+	for _, method := range named {
+		if len(method.Inputs) != len(args) {
+			failures = append(failures, fmt.Sprintf("%s: expects %d arguments", method.Sig, len(method.Inputs)))
+			continue
+		}
+
+		values, err := convertAbiArgs(method.Inputs, args)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", method.Sig, err))
+			continue
+		}
+		matches = append(matches, candidate{method: method, values: values})
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, nil, fmt.Errorf("no overload of %s accepts %d arguments: %s", methodName, len(args), strings.Join(failures, "; "))
+	case 1:
+		return &matches[0].method, matches[0].values, nil
+	}
+
+	sigs := make([]string, 0, len(matches))
+	for _, match := range matches {
+		sigs = append(sigs, match.method.Sig)
+	}
+	return nil, nil, fmt.Errorf("ambiguous call to %s, matches %s: pass the full signature as method-name", methodName, strings.Join(sigs, ", "))
+}
+
+func convertAbiArgs(inputs abi.Arguments, args []interface{}) ([]interface{}, error) {
+	values := make([]interface{}, 0, len(args))
+	for i, arg := range args {
+		value, err := ParseAbiValue(inputs[i].Type, arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d (%s): %v", i, inputs[i].Type.String(), err)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// NamedAbiValues keys decoded values by argument name, falling back to the
+// position for unnamed arguments.
+func NamedAbiValues(arguments abi.Arguments, decoded []interface{}) map[string]interface{} {
+	named := make(map[string]interface{}, len(decoded))
+	for i, value := range decoded {
+		name := arguments[i].Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		named[name] = value
+	}
+	return named
+}
+
+// ParseAbiJSON parses a contract ABI given either as a JSON array or as a JSON
+// string containing the array.
+func ParseAbiJSON(data []byte) (abi.ABI, error) {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err == nil {
+		data = []byte(encoded)
+	}
+
+	parsedABI, err := abi.JSON(bytes.NewReader(data))
+	if err != nil {
+		return abi.ABI{}, fmt.Errorf("invalid ABI: %v", err)
+	}
+	return parsedABI, nil
+}
+
+// Method converts the signature into an abi.Method.
+func (f *FunctionSignature) Method() abi.Method {
+	return abi.NewMethod(f.Name, f.Name, abi.Function, "", false, false, f.Inputs, f.Outputs)
+}
+
+// DecodeCalldata decodes calldata against the first candidate method whose
+// inputs unpack cleanly.
+func DecodeCalldata(data []byte, candidates []abi.Method) (*abi.Method, []interface{}, error) {
+	if len(data) < 4 {
+		return nil, nil, fmt.Errorf("calldata is shorter than a selector")
+	}
+
+	var failures []string
+	for i := range candidates {
+		method := candidates[i]
+		if !bytes.Equal(method.ID, data[:4]) {
+			failures = append(failures, fmt.Sprintf("%s: selector mismatch", method.Sig))
+			continue
+		}
+		decoded, err := DecodeAbiValues(method.Inputs, data[4:])
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", method.Sig, err))
+			continue
+		}
+		return &method, decoded, nil
+	}
+
+	if len(failures) == 0 {
+		return nil, nil, fmt.Errorf("no known function for selector %s", hexutil.Encode(data[:4]))
+	}
+	return nil, nil, fmt.Errorf("calldata does not decode: %s", strings.Join(failures, "; "))
+}
@@ -0,0 +1,441 @@
+package handler
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func mustAbiType(t *testing.T, typeStr string) abi.Type {
+	t.Helper()
+	typ, err := ParseAbiType(typeStr)
+	if err != nil {
+		t.Fatalf("ParseAbiType(%q): %v", typeStr, err)
+	}
+	return typ
+}
+
+func TestParseAbiType(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "uint8", want: "uint8"},
+		{in: "uint", want: "uint256"},
+		{in: "int", want: "int256"},
+		{in: "byte", want: "bytes1"},
+		{in: " address ", want: "address"},
+		{in: "bytes32[]", want: "bytes32[]"},
+		{in: "uint256[2][]", want: "uint256[2][]"},
+		{in: "(address,uint256)[2]", want: "(address,uint256)[2]"},
+		{in: "tuple(address to, uint256 amount)", want: "(address,uint256)"},
+		{in: "((uint8,bool),bytes)", want: "((uint8,bool),bytes)"},
+		{in: "string memory", want: "string"},
+		{in: "", wantErr: true},
+		{in: "uint7", wantErr: true},
+		{in: "uint0", wantErr: true},
+		{in: "int264", wantErr: true},
+		{in: "uint08", wantErr: true},
+		{in: "bytes0", wantErr: true},
+		{in: "bytes33", wantErr: true},
+		{in: "foo", wantErr: true},
+		{in: "uint256[x]", wantErr: true},
+		{in: "address owner", wantErr: true},
+		{in: "(address,uint256", wantErr: true},
+	}
+	for _, tt := range tests {
+		typ, err := ParseAbiType(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseAbiType(%q) = %s, want an error", tt.in, typ.String())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseAbiType(%q): %v", tt.in, err)
+			continue
+		}
+		if got := typ.String(); got != tt.want {
+			t.Errorf("ParseAbiType(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseAbiTypeTupleNames(t *testing.T) {
+	named := mustAbiType(t, "tuple(address to, uint256 amount)")
+	if want := []string{"to", "amount"}; !reflect.DeepEqual(named.TupleRawNames, want) {
+		t.Errorf("tuple names = %v, want %v", named.TupleRawNames, want)
+	}
+	unnamed := mustAbiType(t, "(address,uint256)")
+	if want := []string{"field0", "field1"}; !reflect.DeepEqual(unnamed.TupleRawNames, want) {
+		t.Errorf("tuple names = %v, want %v", unnamed.TupleRawNames, want)
+	}
+}
+
+func TestParseAbiValue(t *testing.T) {
+	tests := []struct {
+		typ     string
+		in      interface{}
+		want    interface{} // as FormatAbiValue renders the converted value
+		wantErr bool
+	}{
+		{typ: "uint8", in: "255", want: "255"},
+		{typ: "uint8", in: "256", wantErr: true},
+		{typ: "uint8", in: "-1", wantErr: true},
+		{typ: "int8", in: "-128", want: "-128"},
+		{typ: "int8", in: "-129", wantErr: true},
+		{typ: "uint64", in: json.Number("18446744073709551615"), want: "18446744073709551615"},
+		{typ: "uint256", in: "0x10", want: "16"},
+		{typ: "uint256", in: "ten", wantErr: true},
+		{typ: "uint256", in: true, wantErr: true},
+		{typ: "bool", in: "true", want: true},
+		{typ: "bool", in: false, want: false},
+		{typ: "bool", in: "yes", wantErr: true},
+		{typ: "address", in: "0xd8da6bf26964af9d7eed9e03e53415d37aa96045", want: "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"},
+		{typ: "address", in: "0x1234", wantErr: true},
+		{typ: "string", in: "hello", want: "hello"},
+		{typ: "string", in: json.Number("1"), wantErr: true},
+		{typ: "bytes", in: "0x0102", want: "0x0102"},
+		{typ: "bytes", in: "0102", wantErr: true},
+		{typ: "bytes", in: "0xzz", wantErr: true},
+		{typ: "bytes4", in: "0xa9059cbb", want: "0xa9059cbb"},
+		{typ: "bytes4", in: "0xa905", wantErr: true},
+		{typ: "uint256[]", in: `["1", 2, "0x03"]`, want: []interface{}{"1", "2", "3"}},
+		{typ: "uint256[]", in: `{"a": 1}`, wantErr: true},
+		{typ: "uint256[]", in: `[1,`, wantErr: true},
+		{typ: "address[2]", in: []interface{}{"0x0000000000000000000000000000000000000001"}, wantErr: true},
+		{typ: "uint8[2]", in: `[1, 2]`, want: []interface{}{"1", "2"}},
+		{typ: "uint8[]", in: `[1, 300]`, wantErr: true},
+		{
+			typ:  "tuple(address to, uint256 amount)",
+			in:   `{"to": "0x0000000000000000000000000000000000000001", "amount": "5"}`,
+			want: map[string]interface{}{"to": "0x0000000000000000000000000000000000000001", "amount": "5"},
+		},
+		{
+			typ:  "tuple(address to, uint256 amount)",
+			in:   `["0x0000000000000000000000000000000000000001", 5]`,
+			want: map[string]interface{}{"to": "0x0000000000000000000000000000000000000001", "amount": "5"},
+		},
+		{typ: "tuple(address to, uint256 amount)", in: `{"to": "0x0000000000000000000000000000000000000001"}`, wantErr: true},
+		{typ: "tuple(address to, uint256 amount)", in: `[5]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		typ := mustAbiType(t, tt.typ)
+		got, err := ParseAbiValue(typ, tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseAbiValue(%s, %v) = %v, want an error", tt.typ, tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseAbiValue(%s, %v): %v", tt.typ, tt.in, err)
+			continue
+		}
+		if formatted := FormatAbiValue(typ, got); !reflect.DeepEqual(formatted, tt.want) {
+			t.Errorf("ParseAbiValue(%s, %v) = %#v, want %#v", tt.typ, tt.in, formatted, tt.want)
+		}
+	}
+}
+
+// ParseAbiValue has to return the Go types abi packing expects, or Pack
+// rejects the value.
+func TestParseAbiValuePacks(t *testing.T) {
+	for _, tt := range []struct {
+		typ string
+		in  interface{}
+	}{
+		{"uint8", "7"},
+		{"int32", "-7"},
+		{"uint256", "7"},
+		{"bytes32", "0x" + strings.Repeat("ab", 32)},
+		{"address[]", `["0x0000000000000000000000000000000000000001"]`},
+		{"tuple(uint16 fee, bytes data)[]", `[{"fee": 3, "data": "0x01"}]`},
+	} {
+		typ := mustAbiType(t, tt.typ)
+		value, err := ParseAbiValue(typ, tt.in)
+		if err != nil {
+			t.Errorf("ParseAbiValue(%s, %v): %v", tt.typ, tt.in, err)
+			continue
+		}
+		if _, err := (abi.Arguments{{Type: typ}}).Pack(value); err != nil {
+			t.Errorf("packing %s %v: %v", tt.typ, tt.in, err)
+		}
+	}
+}
+
+func TestParseBigInt(t *testing.T) {
+	tests := []struct {
+		in      interface{}
+		want    string
+		wantErr bool
+	}{
+		{in: "42", want: "42"},
+		{in: " 42 ", want: "42"},
+		{in: "-42", want: "-42"},
+		{in: "0x2a", want: "42"},
+		{in: "0X2A", want: "42"},
+		{in: "-0x2a", want: "-42"},
+		{in: json.Number("42"), want: "42"},
+		{in: "115792089237316195423570985008687907853269984665640564039457584007913129639936", want: "115792089237316195423570985008687907853269984665640564039457584007913129639936"},
+		{in: "", wantErr: true},
+		{in: "-", wantErr: true},
+		{in: "0x", wantErr: true},
+		{in: "4x2", wantErr: true},
+		{in: "1e3", wantErr: true},
+		{in: "1.5", wantErr: true},
+		{in: 42, wantErr: true},
+		{in: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseBigInt(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseBigInt(%#v) = %s, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseBigInt(%#v): %v", tt.in, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("parseBigInt(%#v) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCheckIntRange(t *testing.T) {
+	maxUint256 := new(big.Int).Set(abi.MaxUint256)
+	tests := []struct {
+		typ     string
+		n       *big.Int
+		wantErr bool
+	}{
+		{typ: "uint8", n: big.NewInt(0)},
+		{typ: "uint8", n: big.NewInt(255)},
+		{typ: "uint8", n: big.NewInt(256), wantErr: true},
+		{typ: "uint8", n: big.NewInt(-1), wantErr: true},
+		{typ: "int8", n: big.NewInt(127)},
+		{typ: "int8", n: big.NewInt(-128)},
+		{typ: "int8", n: big.NewInt(128), wantErr: true},
+		{typ: "int8", n: big.NewInt(-129), wantErr: true},
+		{typ: "uint256", n: maxUint256},
+		{typ: "uint256", n: new(big.Int).Add(maxUint256, common.Big1), wantErr: true},
+		{typ: "int256", n: new(big.Int).Rsh(maxUint256, 1)},
+		{typ: "int256", n: new(big.Int).Add(new(big.Int).Rsh(maxUint256, 1), common.Big1), wantErr: true},
+	}
+	for _, tt := range tests {
+		err := checkIntRange(mustAbiType(t, tt.typ), tt.n)
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Errorf("checkIntRange(%s, %s) error = %v, want error %v", tt.typ, tt.n, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseFunctionSignature(t *testing.T) {
+	tests := []struct {
+		in        string
+		signature string
+		selector  string
+		inputs    []string // input names
+		outputs   []string // output types
+		wantErr   bool
+	}{
+		{
+			in:        "transfer(address,uint256)",
+			signature: "transfer(address,uint256)",
+			selector:  "0xa9059cbb",
+			inputs:    []string{"", ""},
+		},
+		{
+			in:        "function balanceOf(address owner) external view returns (uint256)",
+			signature: "balanceOf(address)",
+			selector:  "0x70a08231",
+			inputs:    []string{"owner"},
+			outputs:   []string{"uint256"},
+		},
+		{
+			in:        "getReserves()(uint112,uint112,uint32)",
+			signature: "getReserves()",
+			selector:  "0x0902f1ac",
+			inputs:    []string{},
+			outputs:   []string{"uint112", "uint112", "uint32"},
+		},
+		{
+			in:        "function allowance(address owner, address spender) public view virtual override returns (uint256 remaining)",
+			signature: "allowance(address,address)",
+			selector:  "0xdd62ed3e",
+			inputs:    []string{"owner", "spender"},
+			outputs:   []string{"uint256"},
+		},
+		{
+			in:        "swap((address,uint256)[] calldata orders, bytes memory data) payable",
+			signature: "swap((address,uint256)[],bytes)",
+			inputs:    []string{"orders", "data"},
+		},
+		{in: "transfer", wantErr: true},
+		{in: "(address)", wantErr: true},
+		{in: "transfer(address,uint256", wantErr: true},
+		{in: "f(uint7)", wantErr: true},
+		{in: "f(address) returns uint256", wantErr: true},
+		{in: "f(address) view foo", wantErr: true},
+		{in: "f(address)(uint256", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseFunctionSignature(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseFunctionSignature(%q) = %s, want an error", tt.in, got.Signature())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseFunctionSignature(%q): %v", tt.in, err)
+			continue
+		}
+		if got.Signature() != tt.signature {
+			t.Errorf("ParseFunctionSignature(%q) signature = %s, want %s", tt.in, got.Signature(), tt.signature)
+		}
+		if tt.selector != "" && hexutil.Encode(got.Selector()) != tt.selector {
+			t.Errorf("ParseFunctionSignature(%q) selector = %s, want %s", tt.in, hexutil.Encode(got.Selector()), tt.selector)
+		}
+		inputs := make([]string, 0, len(got.Inputs))
+		for _, input := range got.Inputs {
+			inputs = append(inputs, input.Name)
+		}
+		if tt.inputs != nil && !reflect.DeepEqual(inputs, tt.inputs) {
+			t.Errorf("ParseFunctionSignature(%q) input names = %q, want %q", tt.in, inputs, tt.inputs)
+		}
+		var outputs []string
+		for _, output := range got.Outputs {
+			outputs = append(outputs, output.Type.String())
+		}
+		if !reflect.DeepEqual(outputs, tt.outputs) {
+			t.Errorf("ParseFunctionSignature(%q) outputs = %q, want %q", tt.in, outputs, tt.outputs)
+		}
+	}
+}
+
+const overloadedAbi = `[
+	{"type": "function", "name": "safeTransferFrom", "inputs": [{"name": "from", "type": "address"}, {"name": "to", "type": "address"}, {"name": "id", "type": "uint256"}], "outputs": []},
+	{"type": "function", "name": "safeTransferFrom", "inputs": [{"name": "from", "type": "address"}, {"name": "to", "type": "address"}, {"name": "id", "type": "uint256"}, {"name": "data", "type": "bytes"}], "outputs": []},
+	{"type": "function", "name": "set", "inputs": [{"name": "value", "type": "uint8"}], "outputs": []},
+	{"type": "function", "name": "set", "inputs": [{"name": "value", "type": "address"}], "outputs": []},
+	{"type": "function", "name": "mint", "inputs": [{"name": "amount", "type": "uint256"}], "outputs": []},
+	{"type": "function", "name": "mint", "inputs": [{"name": "amount", "type": "int256"}], "outputs": []}
+]`
+
+func TestResolveAbiMethod(t *testing.T) {
+	parsedABI, err := ParseAbiJSON([]byte(overloadedAbi))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const (
+		from = "0x0000000000000000000000000000000000000001"
+		to   = "0x0000000000000000000000000000000000000002"
+	)
+	tests := []struct {
+		method  string
+		args    []interface{}
+		want    string
+		wantErr string
+	}{
+		{method: "safeTransferFrom", args: []interface{}{from, to, "1"}, want: "safeTransferFrom(address,address,uint256)"},
+		{method: "safeTransferFrom", args: []interface{}{from, to, "1", "0x"}, want: "safeTransferFrom(address,address,uint256,bytes)"},
+		{method: "safeTransferFrom", args: []interface{}{from, to}, wantErr: "no overload of safeTransferFrom accepts 2 arguments"},
+		{method: "set", args: []interface{}{"7"}, want: "set(uint8)"},
+		{method: "set", args: []interface{}{"0xd8da6bf26964af9d7eed9e03e53415d37aa96045"}, want: "set(address)"},
+		{method: "set", args: []interface{}{from}, wantErr: "ambiguous call to set"},
+		{method: "set", args: []interface{}{"300"}, wantErr: "no overload of set accepts 1 arguments"},
+		{method: "mint", args: []interface{}{"1"}, wantErr: "ambiguous call to mint"},
+		{method: "mint(int256)", args: []interface{}{"1"}, want: "mint(int256)"},
+		{method: "function mint(uint256 amount)", args: []interface{}{"1"}, want: "mint(uint256)"},
+		{method: "mint", args: []interface{}{"-1"}, want: "mint(int256)"},
+		{method: "mint(uint128)", args: []interface{}{"1"}, wantErr: "method mint(uint128) not found"},
+		{method: "burn", args: []interface{}{"1"}, wantErr: "method burn not found"},
+	}
+	for _, tt := range tests {
+		method, values, err := ResolveAbiMethod(parsedABI, tt.method, tt.args)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ResolveAbiMethod(%s, %v) error = %v, want %q", tt.method, tt.args, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ResolveAbiMethod(%s, %v): %v", tt.method, tt.args, err)
+			continue
+		}
+		if method.Sig != tt.want {
+			t.Errorf("ResolveAbiMethod(%s, %v) = %s, want %s", tt.method, tt.args, method.Sig, tt.want)
+		}
+		if _, err := method.Inputs.Pack(values...); err != nil {
+			t.Errorf("ResolveAbiMethod(%s, %v) values do not pack: %v", tt.method, tt.args, err)
+		}
+	}
+}
+
+func TestDecodeCalldata(t *testing.T) {
+	transfer, err := ParseFunctionSignature("transfer(address to, uint256 amount)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	approve, err := ParseFunctionSignature("approve(address spender, uint256 amount)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	candidates := []abi.Method{approve.Method(), transfer.Method()}
+
+	// transfer(0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045, 1000)
+	calldata := hexutil.MustDecode("0xa9059cbb" +
+		"000000000000000000000000d8da6bf26964af9d7eed9e03e53415d37aa96045" +
+		"00000000000000000000000000000000000000000000000000000000000003e8")
+
+	tests := []struct {
+		name       string
+		data       []byte
+		candidates []abi.Method
+		want       string
+		args       []interface{}
+		wantErr    string
+	}{
+		{
+			name:       "matching candidate",
+			data:       calldata,
+			candidates: candidates,
+			want:       "transfer(address,uint256)",
+			args:       []interface{}{"0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045", "1000"},
+		},
+		{name: "shorter than a selector", data: calldata[:3], candidates: candidates, wantErr: "shorter than a selector"},
+		{name: "no candidates", data: calldata, wantErr: "no known function for selector 0xa9059cbb"},
+		{name: "selector mismatch", data: calldata, candidates: candidates[:1], wantErr: "approve(address,uint256): selector mismatch"},
+		{name: "truncated arguments", data: calldata[:40], candidates: candidates, wantErr: "transfer(address,uint256): failed to decode values"},
+	}
+	for _, tt := range tests {
+		method, args, err := DecodeCalldata(tt.data, tt.candidates)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if method.Sig != tt.want {
+			t.Errorf("%s: method = %s, want %s", tt.name, method.Sig, tt.want)
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%s: args = %v, want %v", tt.name, args, tt.args)
+		}
+	}
+}
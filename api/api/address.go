@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Address kinds reported by evm-address
+const (
+	AddressKindEOA          = "eoa"
+	AddressKindContract     = "contract"
+	AddressKindMinimalProxy = "minimal-proxy"
+	AddressKindDelegated    = "delegated"
+	AddressKindPrecompile   = "precompile"
+)
+
+var (
+	// EIP-1167 runtime code around the 20-byte implementation address
+	minimalProxyPrefix = common.FromHex("0x363d3d373d3d3d363d73")
+	minimalProxySuffix = common.FromHex("0x5af43d82803e903d91602b57fd5bf3")
+
+	// EIP-7702 delegation designator, followed by the 20-byte delegate
+	delegationPrefix = common.FromHex("0xef0100")
+)
+
+// precompiles are the precompiled contracts of Ethereum up to Prague, and
+// P-256 verification from RIP-7212 that many rollups ship.
+var precompiles = map[common.Address]string{
+	common.BytesToAddress([]byte{0x01}):       "ecrecover",
+	common.BytesToAddress([]byte{0x02}):       "sha256",
+	common.BytesToAddress([]byte{0x03}):       "ripemd160",
+	common.BytesToAddress([]byte{0x04}):       "identity",
+	common.BytesToAddress([]byte{0x05}):       "modexp",
+	common.BytesToAddress([]byte{0x06}):       "bn256-add",
+	common.BytesToAddress([]byte{0x07}):       "bn256-scalar-mul",
+	common.BytesToAddress([]byte{0x08}):       "bn256-pairing",
+	common.BytesToAddress([]byte{0x09}):       "blake2f",
+	common.BytesToAddress([]byte{0x0a}):       "kzg-point-evaluation",
+	common.BytesToAddress([]byte{0x0b}):       "bls12-g1-add",
+	common.BytesToAddress([]byte{0x0c}):       "bls12-g1-msm",
+	common.BytesToAddress([]byte{0x0d}):       "bls12-g2-add",
+	common.BytesToAddress([]byte{0x0e}):       "bls12-g2-msm",
+	common.BytesToAddress([]byte{0x0f}):       "bls12-pairing",
+	common.BytesToAddress([]byte{0x10}):       "bls12-map-fp-to-g1",
+	common.BytesToAddress([]byte{0x11}):       "bls12-map-fp2-to-g2",
+	common.BytesToAddress([]byte{0x01, 0x00}): "p256-verify",
+}
+
+// GetAddressInfo reads the balance, nonce and code of address at block on a
+// single client and classifies the account.
+func GetAddressInfo(client *ethclient.Client, address common.Address, block *BlockRef) (*GetEvmAddressRequestResponse, error) {
+	balance, err := balanceAtBlock(client, address, block)
+	if err != nil {
+		return nil, fmt.Errorf("get balance failed: %v", err)
+	}
+	nonce, err := nonceAtBlock(client, address, block)
+	if err != nil {
+		return nil, fmt.Errorf("get nonce failed: %v", err)
+	}
+	code, codeSize, err := ExtCodeSize(client, address, block)
+	if err != nil {
+		return nil, err
+	}
+
+	// like EXTCODEHASH, an account that does not exist has the zero hash
+	// rather than the hash of empty code
+	codeHash := crypto.Keccak256Hash(code)
+	if balance.Sign() == 0 && nonce == 0 && len(code) == 0 {
+		codeHash = common.Hash{}
+	}
+	info := &GetEvmAddressRequestResponse{
+		Address:  address.Hex(),
+		Balance:  balance.String(),
+		Nonce:    nonce,
+		CodeSize: codeSize,
+		CodeHash: codeHash.Hex(),
+	}
+	info.Kind, info.Implementation, info.Delegate, info.Precompile = ClassifyCode(address, code)
+	return info, nil
+}
+
+// ClassifyCode tells the kind of account holding code at address, with the
+// implementation of an EIP-1167 minimal proxy, the delegate of an EIP-7702
+// delegated EOA or the name of a precompile.
+func ClassifyCode(address common.Address, code []byte) (kind, implementation, delegate, precompile string) {
+	if name, ok := precompiles[address]; ok && len(code) == 0 {
+		return AddressKindPrecompile, "", "", name
+	}
+	if target, ok := minimalProxyTarget(code); ok {
+		return AddressKindMinimalProxy, target.Hex(), "", ""
+	}
+	if target, ok := delegationTarget(code); ok {
+		return AddressKindDelegated, "", target.Hex(), ""
+	}
+	if len(code) > 0 {
+		return AddressKindContract, "", "", ""
+	}
+	return AddressKindEOA, "", "", ""
+}
+
+// minimalProxyTarget returns the implementation of EIP-1167 runtime code.
+func minimalProxyTarget(code []byte) (common.Address, bool) {
+	if len(code) != len(minimalProxyPrefix)+common.AddressLength+len(minimalProxySuffix) ||
+		!bytes.HasPrefix(code, minimalProxyPrefix) || !bytes.HasSuffix(code, minimalProxySuffix) {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(code[len(minimalProxyPrefix) : len(minimalProxyPrefix)+common.AddressLength]), true
+}
+
+// delegationTarget returns the delegate of an EIP-7702 delegation designator.
+func delegationTarget(code []byte) (common.Address, bool) {
+	if len(code) != len(delegationPrefix)+common.AddressLength || !bytes.HasPrefix(code, delegationPrefix) {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(code[len(delegationPrefix):]), true
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestClassifyCode(t *testing.T) {
+	target := common.HexToAddress("0xbebebebebebebebebebebebebebebebebebebebe")
+	account := common.HexToAddress("0x0000000000000000000000000000000000c0ffee")
+	minimalProxy := common.FromHex("0x363d3d373d3d3d363d73bebebebebebebebebebebebebebebebebebebebe5af43d82803e903d91602b57fd5bf3")
+	delegated := common.FromHex("0xef0100bebebebebebebebebebebebebebebebebebebebe")
+
+	tests := []struct {
+		name           string
+		address        common.Address
+		code           []byte
+		kind           string
+		implementation string
+		delegate       string
+		precompile     string
+	}{
+		{name: "eoa", address: account, kind: AddressKindEOA},
+		{name: "contract", address: account, code: common.FromHex("0x6080604052"), kind: AddressKindContract},
+		{name: "minimal proxy", address: account, code: minimalProxy, kind: AddressKindMinimalProxy, implementation: target.Hex()},
+		{name: "minimal proxy with trailing code", address: account, code: append(append([]byte{}, minimalProxy...), 0x00), kind: AddressKindContract},
+		{name: "delegated eoa", address: account, code: delegated, kind: AddressKindDelegated, delegate: target.Hex()},
+		{name: "truncated delegation", address: account, code: delegated[:22], kind: AddressKindContract},
+		{name: "ecrecover", address: common.BytesToAddress([]byte{0x01}), kind: AddressKindPrecompile, precompile: "ecrecover"},
+		{name: "kzg point evaluation", address: common.BytesToAddress([]byte{0x0a}), kind: AddressKindPrecompile, precompile: "kzg-point-evaluation"},
+		{name: "p256 verify", address: common.BytesToAddress([]byte{0x01, 0x00}), kind: AddressKindPrecompile, precompile: "p256-verify"},
+		{name: "code at a precompile address", address: common.BytesToAddress([]byte{0x01, 0x00}), code: common.FromHex("0x00"), kind: AddressKindContract},
+	}
+	for _, tt := range tests {
+		kind, implementation, delegate, precompile := ClassifyCode(tt.address, tt.code)
+		if kind != tt.kind || implementation != tt.implementation || delegate != tt.delegate || precompile != tt.precompile {
+			t.Errorf("%s: ClassifyCode = (%q, %q, %q, %q), want (%q, %q, %q, %q)", tt.name,
+				kind, implementation, delegate, precompile, tt.kind, tt.implementation, tt.delegate, tt.precompile)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	utils "generic-evm-api-go/api/pkg/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	maxBatchItems = 100
+	batchWorkers  = 8
+)
+
+// BatchRequest runs the queries of a POST body concurrently on a bounded
+// worker pool and answers one result per item, in input order. The items
+// share a batching client pool, so items for the same chain use one upstream
+// connection and their concurrent reads go out as JSON-RPC batches.
+func BatchRequest(r *http.Request) (interface{}, error) {
+	if r == nil || r.Method != http.MethodPost {
+		return nil, utils.ErrMalformedRequest("batch expects a POST body")
+	}
+
+	var items []BatchRequestItem
+	if err := utils.ParseJSONBody(r, &items); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, utils.ErrMalformedRequest("batch has no items")
+	}
+	if len(items) > maxBatchItems {
+		return nil, utils.ErrMalformedRequest(fmt.Sprintf("at most %d batch items are allowed, got %d", maxBatchItems, len(items)))
+	}
+
+	pool := newClientPool(true)
+	defer pool.Close()
+
+	results := make([]BatchResult, len(items))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+
+	workers := batchWorkers
+	if len(items) < workers {
+		workers = len(items)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = runBatchItem(r, pool, items[i])
+			}
+		}()
+	}
+	for i := range items {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results, nil
+}
+
+func runBatchItem(parent *http.Request, pool *clientPool, item BatchRequestItem) (result BatchResult) {
+	result.Query = item.Query
+	defer func() {
+		if rec := recover(); rec != nil {
+			logrus.Error(fmt.Sprintf("Recovered from panic in batch item %s: %v", item.Query, rec))
+			result.Status, result.Error = ErrorResponse(fmt.Errorf("internal error"))
+			result.Result = nil
+		}
+	}()
+
+	response, err := func() (interface{}, error) {
+		if item.Query == "batch" {
+			return nil, utils.ErrMalformedRequest("batch items cannot be batches")
+		}
+		req, err := newBatchItemRequest(parent, pool, item)
+		if err != nil {
+			return nil, err
+		}
+		return Dispatch(req)
+	}()
+	if err != nil {
+		result.Status, result.Error = ErrorResponse(err)
+		return result
+	}
+
+	result.Status = http.StatusOK
+	result.Result = response
+	return result
+}
+
+// newBatchItemRequest builds the request a batch item would have been sent
+// as on its own, keeping the headers of the batch request.
+func newBatchItemRequest(parent *http.Request, pool *clientPool, item BatchRequestItem) (*http.Request, error) {
+	query := url.Values{}
+	query.Set("query", item.Query)
+	for key, value := range item.Params {
+		values, err := batchParamValues(value)
+		if err != nil {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("param %s: %v", key, err))
+		}
+		query[key] = values
+	}
+
+	method := http.MethodGet
+	if len(item.Body) > 0 {
+		method = http.MethodPost
+	}
+
+	req, err := http.NewRequestWithContext(withClientPool(parent.Context(), pool), method, parent.URL.Path+"?"+query.Encode(), bytes.NewReader(item.Body))
+	if err != nil {
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+	req.Header = parent.Header.Clone()
+	req.Header.Del("Content-Length")
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+func batchParamValues(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case json.Number:
+		return []string{v.String()}, nil
+	case bool:
+		return []string{fmt.Sprint(v)}, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+				continue
+			}
+			encoded, err := json.Marshal(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, string(encoded))
+		}
+		return values, nil
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return []string{string(encoded)}, nil
+	}
+}
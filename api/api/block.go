@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	utils "generic-evm-api-go/api/pkg/utils"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var blockTags = map[string]rpc.BlockNumber{
+	"latest":    rpc.LatestBlockNumber,
+	"safe":      rpc.SafeBlockNumber,
+	"finalized": rpc.FinalizedBlockNumber,
+	"pending":   rpc.PendingBlockNumber,
+	"earliest":  rpc.EarliestBlockNumber,
+}
+
+// BlockRef selects the state a read runs against: a block number (tags are
+// the negative rpc.BlockNumber values) or, per EIP-1898, a block hash. A nil
+// BlockRef reads the latest state.
+type BlockRef struct {
+	Number *big.Int
+	Hash   *common.Hash
+}
+
+// ParseBlockParam parses a block query value: a decimal or 0x hex number, one
+// of latest, safe, finalized, pending or earliest, or a 32-byte block hash.
+// An empty value means latest.
+func ParseBlockParam(value string) (*BlockRef, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return &BlockRef{Number: big.NewInt(int64(rpc.LatestBlockNumber))}, nil
+	}
+	if tag, ok := blockTags[value]; ok {
+		return &BlockRef{Number: big.NewInt(int64(tag))}, nil
+	}
+	if strings.HasPrefix(value, "0x") && len(value) == 2+2*common.HashLength {
+		b, err := hexutil.Decode(value)
+		if err != nil {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("invalid block hash %q", value))
+		}
+		hash := common.BytesToHash(b)
+		return &BlockRef{Hash: &hash}, nil
+	}
+
+	// Numbers travel as rpc.BlockNumber, an int64 whose negative values are
+	// the tags
+	n, err := parseBigInt(value)
+	if err != nil || n.Sign() < 0 || !n.IsInt64() {
+		return nil, utils.ErrMalformedRequest(fmt.Sprintf("invalid block %q", value))
+	}
+	return &BlockRef{Number: n}, nil
+}
+
+// ResolveBlock parses a block query value and fetches its header. Numbers and
+// tags other than pending are pinned to the resolved block number, so every
+// read of one request sees the same state even when the chain head moves.
+func ResolveBlock(client *ethclient.Client, value string) (*BlockRef, *BlockInfo, error) {
+	block, err := ParseBlockParam(value)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Only the fields echoed are decoded, taking the hash as reported by the
+	// node: chains with non-standard headers would not hash back to it
+	var header *struct {
+		Number    hexutil.Uint64 `json:"number"`
+		Hash      common.Hash    `json:"hash"`
+		Timestamp hexutil.Uint64 `json:"timestamp"`
+	}
+	if block.Hash != nil {
+		err = client.Client().CallContext(context.Background(), &header, "eth_getBlockByHash", *block.Hash, false)
+	} else {
+		err = client.Client().CallContext(context.Background(), &header, "eth_getBlockByNumber", rpc.BlockNumber(block.Number.Int64()), false)
+	}
+	if err == nil && header == nil {
+		err = ethereum.NotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("get block %s failed: %v", value, err)
+	}
+
+	info := &BlockInfo{
+		Number:    uint64(header.Number),
+		Hash:      header.Hash.Hex(),
+		Timestamp: uint64(header.Timestamp),
+	}
+	tag := strings.ToLower(strings.TrimSpace(value))
+	if _, ok := blockTags[tag]; ok {
+		info.Tag = tag
+	} else if tag == "" {
+		info.Tag = "latest"
+	}
+	if block.Number != nil && block.Number.Int64() != int64(rpc.PendingBlockNumber) {
+		block = &BlockRef{Number: new(big.Int).SetUint64(info.Number)}
+	}
+	return block, info, nil
+}
+
+// resolveBlockNumber resolves a block query value to a block number.
+func resolveBlockNumber(client *ethclient.Client, value string) (uint64, error) {
+	block, err := ParseBlockParam(value)
+	if err != nil {
+		return 0, err
+	}
+	if block.Hash == nil && block.Number.Sign() >= 0 {
+		return block.Number.Uint64(), nil
+	}
+
+	_, info, err := ResolveBlock(client, value)
+	if err != nil {
+		return 0, err
+	}
+	return info.Number, nil
+}
+
+// The readers below run against block, by hash when it carries one.
+
+func codeAtBlock(client *ethclient.Client, address common.Address, block *BlockRef) ([]byte, error) {
+	if block != nil && block.Hash != nil {
+		return client.CodeAtHash(context.Background(), address, *block.Hash)
+	}
+	return client.CodeAt(context.Background(), address, block.number())
+}
+
+func storageAtBlock(client *ethclient.Client, address common.Address, slot common.Hash, block *BlockRef) ([]byte, error) {
+	if block != nil && block.Hash != nil {
+		return client.StorageAtHash(context.Background(), address, slot, *block.Hash)
+	}
+	return client.StorageAt(context.Background(), address, slot, block.number())
+}
+
+func balanceAtBlock(client *ethclient.Client, address common.Address, block *BlockRef) (*big.Int, error) {
+	if block != nil && block.Hash != nil {
+		return client.BalanceAtHash(context.Background(), address, *block.Hash)
+	}
+	return client.BalanceAt(context.Background(), address, block.number())
+}
+
+func nonceAtBlock(client *ethclient.Client, address common.Address, block *BlockRef) (uint64, error) {
+	if block != nil && block.Hash != nil {
+		return client.NonceAtHash(context.Background(), address, *block.Hash)
+	}
+	return client.NonceAt(context.Background(), address, block.number())
+}
+
+func callAtBlock(client *ethclient.Client, msg ethereum.CallMsg, block *BlockRef) ([]byte, error) {
+	if block != nil && block.Hash != nil {
+		return client.CallContractAtHash(context.Background(), msg, *block.Hash)
+	}
+	return client.CallContract(context.Background(), msg, block.number())
+}
+
+func (b *BlockRef) number() *big.Int {
+	if b == nil {
+		return nil
+	}
+	return b.Number
+}
+
+// rpcArg is the block argument of a raw JSON-RPC request.
+func (b *BlockRef) rpcArg() interface{} {
+	switch {
+	case b == nil:
+		return rpc.LatestBlockNumber
+	case b.Hash != nil:
+		return rpc.BlockNumberOrHashWithHash(*b.Hash, false)
+	default:
+		return rpc.BlockNumber(b.Number.Int64())
+	}
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestParseBlockParam(t *testing.T) {
+	hash := common.HexToHash("0x88e96d4537bea4d9c05d12549907b32561d3bf31f45aae734cdc119f13406cb6")
+	tests := []struct {
+		in      string
+		number  *big.Int
+		hash    *common.Hash
+		wantErr bool
+	}{
+		{in: "", number: big.NewInt(int64(rpc.LatestBlockNumber))},
+		{in: "latest", number: big.NewInt(int64(rpc.LatestBlockNumber))},
+		{in: " Finalized ", number: big.NewInt(int64(rpc.FinalizedBlockNumber))},
+		{in: "safe", number: big.NewInt(int64(rpc.SafeBlockNumber))},
+		{in: "pending", number: big.NewInt(int64(rpc.PendingBlockNumber))},
+		{in: "earliest", number: big.NewInt(0)},
+		{in: "0", number: big.NewInt(0)},
+		{in: "19000000", number: big.NewInt(19000000)},
+		{in: "0x10", number: big.NewInt(16)},
+		{in: "0x7fffffffffffffff", number: big.NewInt(math.MaxInt64)},
+		{in: "0xffffffffffffffff", wantErr: true},
+		{in: hash.Hex(), hash: &hash},
+		{in: "0x88E96D4537BEA4D9C05D12549907B32561D3BF31F45AAE734CDC119F13406CB6", hash: &hash},
+		{in: "-1", wantErr: true},
+		{in: "0x10000000000000000", wantErr: true},
+		{in: "0x88e96d4537bea4d9c05d12549907b32561d3bf31f45aae734cdc119f13406cbz", wantErr: true},
+		{in: "head", wantErr: true},
+		{in: "0x", wantErr: true},
+		{in: "1.5", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseBlockParam(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseBlockParam(%q) = %+v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseBlockParam(%q): %v", tt.in, err)
+			continue
+		}
+		if tt.hash != nil {
+			if got.Hash == nil || *got.Hash != *tt.hash || got.Number != nil {
+				t.Errorf("ParseBlockParam(%q) = %+v, want hash %s", tt.in, got, tt.hash.Hex())
+			}
+			continue
+		}
+		if got.Hash != nil || got.Number == nil || got.Number.Cmp(tt.number) != 0 {
+			t.Errorf("ParseBlockParam(%q) = %+v, want number %s", tt.in, got, tt.number)
+		}
+	}
+}
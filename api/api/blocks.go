@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	utils "generic-evm-api-go/api/pkg/utils"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// rpcBlock is a block as eth_getBlockBy* returns it with full transactions.
+// Fields that are missing before their fork, or on a pending block, are
+// pointers.
+type rpcBlock struct {
+	Number                *hexutil.Uint64   `json:"number"`
+	Hash                  *common.Hash      `json:"hash"`
+	ParentHash            common.Hash       `json:"parentHash"`
+	Timestamp             hexutil.Uint64    `json:"timestamp"`
+	Miner                 *common.Address   `json:"miner"`
+	GasUsed               hexutil.Uint64    `json:"gasUsed"`
+	GasLimit              hexutil.Uint64    `json:"gasLimit"`
+	BaseFee               *hexutil.Big      `json:"baseFeePerGas"`
+	BlobGasUsed           *hexutil.Uint64   `json:"blobGasUsed"`
+	ExcessBlobGas         *hexutil.Uint64   `json:"excessBlobGas"`
+	WithdrawalsRoot       *common.Hash      `json:"withdrawalsRoot"`
+	Withdrawals           []json.RawMessage `json:"withdrawals"`
+	ParentBeaconBlockRoot *common.Hash      `json:"parentBeaconBlockRoot"`
+	StateRoot             common.Hash       `json:"stateRoot"`
+	TransactionsRoot      common.Hash       `json:"transactionsRoot"`
+	ReceiptsRoot          common.Hash       `json:"receiptsRoot"`
+	ExtraData             hexutil.Bytes     `json:"extraData"`
+	Size                  *hexutil.Uint64   `json:"size"`
+	Transactions          []json.RawMessage `json:"transactions"`
+}
+
+// GetBlock fetches the block block refers to, with its transactions.
+func GetBlock(client *ethclient.Client, block *BlockRef) (*rpcBlock, error) {
+	var result *rpcBlock
+	var err error
+	if block != nil && block.Hash != nil {
+		err = client.Client().CallContext(context.Background(), &result, "eth_getBlockByHash", *block.Hash, true)
+	} else {
+		err = client.Client().CallContext(context.Background(), &result, "eth_getBlockByNumber", block.rpcArg(), true)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get block failed: %v", err)
+	}
+	if result == nil {
+		return nil, utils.ErrNotFound(fmt.Sprintf("block %v", ethereum.NotFound))
+	}
+	return result, nil
+}
+
+// GetBlockReceipts fetches the receipts of a block in transaction order with
+// eth_getBlockReceipts, or one eth_getTransactionReceipt per transaction in
+// JSON-RPC batches on nodes without it.
+func GetBlockReceipts(client *ethclient.Client, blockHash common.Hash, txHashes []common.Hash) ([]*rpcReceipt, error) {
+	var receipts []*rpcReceipt
+	err := client.Client().CallContext(context.Background(), &receipts, "eth_getBlockReceipts", rpc.BlockNumberOrHashWithHash(blockHash, false))
+	if err == nil && len(receipts) == len(txHashes) {
+		return receipts, nil
+	}
+
+	receipts = make([]*rpcReceipt, len(txHashes))
+	for start := 0; start < len(txHashes); start += rpcBatchMaxSize {
+		end := min(start+rpcBatchMaxSize, len(txHashes))
+		batch := make([]rpc.BatchElem, 0, end-start)
+		for i := start; i < end; i++ {
+			batch = append(batch, rpc.BatchElem{
+				Method: "eth_getTransactionReceipt",
+				Args:   []interface{}{txHashes[i]},
+				Result: &receipts[i],
+			})
+		}
+		if err := client.Client().BatchCallContext(context.Background(), batch); err != nil {
+			return nil, fmt.Errorf("get receipts failed: %v", err)
+		}
+		for _, elem := range batch {
+			if elem.Error != nil {
+				return nil, fmt.Errorf("get receipt %v failed: %v", elem.Args[0], elem.Error)
+			}
+		}
+	}
+	return receipts, nil
+}
+
+// BlockAtTimestamp finds the last block with a timestamp at or before
+// timestamp by binary search between genesis and the latest block.
+func BlockAtTimestamp(client *ethclient.Client, timestamp uint64) (uint64, error) {
+	latest, latestTime, err := blockTimestamp(client, rpc.LatestBlockNumber)
+	if err != nil {
+		return 0, err
+	}
+	if latestTime <= timestamp {
+		return latest, nil
+	}
+	_, genesisTime, err := blockTimestamp(client, 0)
+	if err != nil {
+		return 0, err
+	}
+	if timestamp < genesisTime {
+		return 0, utils.ErrNotFound(fmt.Sprintf("timestamp %d is before the genesis block", timestamp))
+	}
+
+	// The block at lo is at or before timestamp, the block at hi after it
+	lo, hi := uint64(0), latest
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		_, midTime, err := blockTimestamp(client, rpc.BlockNumber(mid))
+		if err != nil {
+			return 0, err
+		}
+		if midTime <= timestamp {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+func blockTimestamp(client *ethclient.Client, number rpc.BlockNumber) (uint64, uint64, error) {
+	var header *struct {
+		Number    hexutil.Uint64 `json:"number"`
+		Timestamp hexutil.Uint64 `json:"timestamp"`
+	}
+	err := client.Client().CallContext(context.Background(), &header, "eth_getBlockByNumber", number, false)
+	if err == nil && header == nil {
+		err = ethereum.NotFound
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("get block %v failed: %v", number, err)
+	}
+	return uint64(header.Number), uint64(header.Timestamp), nil
+}
+
+// FormatBlock reports a block's header and a summary of its transactions.
+// receipts, when given, adds the full transaction and its receipt to each.
+func FormatBlock(chainId string, block *rpcBlock, receipts []*rpcReceipt) (*GetEvmBlockRequestResponse, error) {
+	formatted := &GetEvmBlockRequestResponse{
+		ChainId:          chainId,
+		ParentHash:       block.ParentHash.Hex(),
+		Timestamp:        uint64(block.Timestamp),
+		GasUsed:          uint64(block.GasUsed),
+		GasLimit:         uint64(block.GasLimit),
+		BaseFee:          formatBig(block.BaseFee),
+		StateRoot:        block.StateRoot.Hex(),
+		TransactionsRoot: block.TransactionsRoot.Hex(),
+		ReceiptsRoot:     block.ReceiptsRoot.Hex(),
+		ExtraData:        hexutil.Encode(block.ExtraData),
+		TransactionCount: len(block.Transactions),
+		Transactions:     make([]EvmBlockTransaction, 0, len(block.Transactions)),
+	}
+	if block.Number != nil {
+		formatted.Number = uint64(*block.Number)
+	}
+	if block.Hash != nil {
+		formatted.Hash = block.Hash.Hex()
+	}
+	if block.Miner != nil {
+		formatted.Miner = block.Miner.Hex()
+	}
+	if block.BlobGasUsed != nil {
+		blobGasUsed := uint64(*block.BlobGasUsed)
+		formatted.BlobGasUsed = &blobGasUsed
+	}
+	if block.ExcessBlobGas != nil {
+		excessBlobGas := uint64(*block.ExcessBlobGas)
+		formatted.ExcessBlobGas = &excessBlobGas
+	}
+	if block.WithdrawalsRoot != nil {
+		formatted.WithdrawalsRoot = block.WithdrawalsRoot.Hex()
+		withdrawals := len(block.Withdrawals)
+		formatted.WithdrawalCount = &withdrawals
+	}
+	if block.ParentBeaconBlockRoot != nil {
+		formatted.ParentBeaconBlockRoot = block.ParentBeaconBlockRoot.Hex()
+	}
+	if block.Size != nil {
+		formatted.Size = uint64(*block.Size)
+	}
+
+	for i, raw := range block.Transactions {
+		var tx rpcTransaction
+		if err := json.Unmarshal(raw, &tx); err != nil {
+			return nil, fmt.Errorf("transaction %d: %v", i, err)
+		}
+		summary := EvmBlockTransaction{
+			Hash:  tx.Hash.Hex(),
+			Index: uint64(i),
+			Type:  uint64(tx.Type),
+			From:  tx.From.Hex(),
+			Nonce: uint64(tx.Nonce),
+			Value: formatBig(tx.Value),
+			Gas:   uint64(tx.Gas),
+		}
+		if tx.To != nil {
+			summary.To = tx.To.Hex()
+		}
+		if len(tx.Input) >= 4 {
+			summary.Selector = hexutil.Encode(tx.Input[:4])
+		}
+		if receipts != nil {
+			summary.Detail = FormatTransaction(chainId, &tx, raw)
+			if receipts[i] != nil {
+				summary.Receipt = FormatReceipt(chainId, receipts[i])
+			}
+		}
+		formatted.Transactions = append(formatted.Transactions, summary)
+	}
+	return formatted, nil
+}
@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	utils "generic-evm-api-go/api/pkg/utils"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxPooledClients caps the shared pool, since json-rpc URLs come from callers
+	maxPooledClients = 64
+	// rpcHTTPTimeout bounds every HTTP round trip to an RPC, so a slow one
+	// cannot hold a batch worker
+	rpcHTTPTimeout = 30 * time.Second
+)
+
+// sharedClients keeps one client per RPC URL for the whole process, so
+// requests stop dialing a fresh client each time.
+var sharedClients = newClientPool(false)
+
+type clientPoolKey struct{}
+
+type requestClientsKey struct{}
+
+// clientPool hands out one client per HTTP RPC URL, evicting the least
+// recently used once maxPooledClients are held. A batching pool routes its
+// clients through a batchingTransport, so concurrent reads to the same chain
+// go upstream as JSON-RPC batches.
+type clientPool struct {
+	mu       sync.Mutex
+	clients  map[string]*list.Element
+	recent   *list.List // of *pooledClient, most recently used first
+	batching bool
+}
+
+type pooledClient struct {
+	url    string
+	client *ethclient.Client
+}
+
+func newClientPool(batching bool) *clientPool {
+	return &clientPool{
+		clients:  make(map[string]*list.Element),
+		recent:   list.New(),
+		batching: batching,
+	}
+}
+
+// Dial returns the pooled client for the HTTP RPC url.
+func (p *clientPool) Dial(url string) (*ethclient.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if elem, ok := p.clients[url]; ok {
+		p.recent.MoveToFront(elem)
+		return elem.Value.(*pooledClient).client, nil
+	}
+
+	httpClient := &http.Client{Timeout: rpcHTTPTimeout}
+	if p.batching {
+		httpClient.Transport = newBatchingTransport(http.DefaultTransport)
+	}
+	rpcClient, err := rpc.DialOptions(context.Background(), url, rpc.WithHTTPClient(httpClient))
+	if err != nil {
+		err_ := fmt.Errorf("client connection failed: %v", err)
+		logrus.Error(err_.Error())
+		return nil, err_
+	}
+	client := ethclient.NewClient(rpcClient)
+
+	// An HTTP client holds no connection of its own, so an evicted one is only
+	// dropped and stays usable by the requests still holding it
+	if p.recent.Len() >= maxPooledClients {
+		oldest := p.recent.Back()
+		p.recent.Remove(oldest)
+		delete(p.clients, oldest.Value.(*pooledClient).url)
+	}
+	p.clients[url] = p.recent.PushFront(&pooledClient{url: url, client: client})
+	return client, nil
+}
+
+// Close closes every pooled client.
+func (p *clientPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for url, elem := range p.clients {
+		elem.Value.(*pooledClient).client.Close()
+		delete(p.clients, url)
+	}
+	p.recent.Init()
+}
+
+// requestClients collects the clients dialed outside a pool while serving a
+// request, to close them when it ends.
+type requestClients struct {
+	mu      sync.Mutex
+	clients []*ethclient.Client
+}
+
+func (c *requestClients) add(client *ethclient.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clients = append(c.clients, client)
+}
+
+// Close closes every client dialed for the request.
+func (c *requestClients) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, client := range c.clients {
+		client.Close()
+	}
+	c.clients = nil
+}
+
+// withRequestClients makes the clients dialed for requests built on ctx
+// close with clients.
+func withRequestClients(ctx context.Context, clients *requestClients) context.Context {
+	return context.WithValue(ctx, requestClientsKey{}, clients)
+}
+
+// checkRpcURL refuses RPC URLs other than http(s) and ws(s) ones, which
+// ethclient would otherwise take as an IPC socket path or stdio.
+func checkRpcURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return utils.ErrMalformedRequest(fmt.Sprintf("RPC URL %q must be an http, https, ws or wss URL", rawURL))
+	}
+	switch parsed.Scheme {
+	case "http", "https", "ws", "wss":
+		return nil
+	}
+	return utils.ErrMalformedRequest(fmt.Sprintf("RPC URL %q must be an http, https, ws or wss URL", rawURL))
+}
+
+// dialRequestClient returns a client for rawURL while serving r: the pooled
+// one for HTTP URLs, or for websocket URLs, which hold a connection of their
+// own, a fresh one closed when r ends.
+func dialRequestClient(r *http.Request, rawURL string) (*ethclient.Client, error) {
+	if err := checkRpcURL(rawURL); err != nil {
+		return nil, err
+	}
+	if parsed, _ := url.Parse(rawURL); parsed.Scheme == "http" || parsed.Scheme == "https" {
+		return clientPoolFor(r).Dial(rawURL)
+	}
+
+	var clients *requestClients
+	if r != nil {
+		clients, _ = r.Context().Value(requestClientsKey{}).(*requestClients)
+	}
+	if clients == nil {
+		return nil, fmt.Errorf("%s can only be dialed while serving a request", rawURL)
+	}
+	client, err := DialClient(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	clients.add(client)
+	return client, nil
+}
+
+// withClientPool makes the requests built on ctx dial through pool.
+func withClientPool(ctx context.Context, pool *clientPool) context.Context {
+	return context.WithValue(ctx, clientPoolKey{}, pool)
+}
+
+func clientPoolFor(r *http.Request) *clientPool {
+	if r != nil {
+		if pool, ok := r.Context().Value(clientPoolKey{}).(*clientPool); ok {
+			return pool
+		}
+	}
+	return sharedClients
+}
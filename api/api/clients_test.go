@@ -0,0 +1,27 @@
+package handler
+
+import "testing"
+
+func TestCheckRpcURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: "https://eth.llamarpc.com"},
+		{url: "http://127.0.0.1:8545"},
+		{url: "wss://mainnet.example/ws"},
+		{url: "ws://localhost:8546"},
+		{url: "/root/.ethereum/geth.ipc", wantErr: true},
+		{url: "stdio", wantErr: true},
+		{url: "file:///root/.ethereum/geth.ipc", wantErr: true},
+		{url: "ftp://example.com", wantErr: true},
+		{url: "https:///no-host", wantErr: true},
+		{url: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		err := checkRpcURL(tt.url)
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Errorf("checkRpcURL(%q) error = %v, want error %v", tt.url, err, tt.wantErr)
+		}
+	}
+}
@@ -4,27 +4,34 @@ import "fmt"
 
 const Version string = "Example API v0"
 
+// Multicall3 is deployed at the same address on most chains
+const multicall3Address = "0xcA11bde05977b3631167028862bE2a173976CA11"
+
 type ChainInfo struct {
-	RPC  string
-	ID   string
-	Name string
+	RPC        string
+	Multicall3 string // empty when the chain has no Multicall3 deployment
+	ID         string
+	Name       string
 }
 
 var SupportedChains = map[string]ChainInfo{
 	"1": {
-		RPC:  "https://eth.llamarpc.com",
-		ID:   "01",
-		Name: "Ethereum Mainnet",
+		RPC:        "https://eth.llamarpc.com",
+		Multicall3: multicall3Address,
+		ID:         "01",
+		Name:       "Ethereum Mainnet",
 	},
 	"137": {
-		RPC:  "https",
-		ID:   "89",
-		Name: "Polygon Mainnet",
+		RPC:        "https",
+		Multicall3: multicall3Address,
+		ID:         "89",
+		Name:       "Polygon Mainnet",
 	},
 	"56": {
-		RPC:  "https://bsc-rpc.publicnode.com",
-		ID:   "38",
-		Name: "Binance Smart Chain",
+		RPC:        "https://bsc-rpc.publicnode.com",
+		Multicall3: multicall3Address,
+		ID:         "38",
+		Name:       "Binance Smart Chain",
 	},
 }
 
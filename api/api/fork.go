@@ -0,0 +1,499 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	utils "generic-evm-api-go/api/pkg/utils"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/misc/eip4844"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	_ "github.com/ethereum/go-ethereum/eth/tracers/native"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/triedb"
+	"github.com/holiman/uint256"
+)
+
+const (
+	forkMaxSteps = 10000            // opcode steps recorded per call
+	forkTimeout  = 30 * time.Second // a call runs with unlimited gas, so time is capped instead
+)
+
+// forkGas is the gas of a fork call that names none, unlimited like the
+// default of geth's eth_call
+const forkGas = math.MaxUint64 / 2
+
+// forkChainConfigs are the fork schedules of chains with one in go-ethereum.
+// Other chains run with every fork up to Cancun active.
+var forkChainConfigs = map[string]*params.ChainConfig{
+	"1":        params.MainnetChainConfig,
+	"11155111": params.SepoliaChainConfig,
+	"17000":    params.HoleskyChainConfig,
+}
+
+// forkPragueTimes are the Prague activation times of the chains above, whose
+// go-ethereum configs predate it. The EVM here does not implement Prague, so
+// later blocks are refused rather than run with the wrong rules; on other
+// chains a Prague header is told by its requestsHash.
+var forkPragueTimes = map[string]uint64{
+	"1":        1746612311,
+	"11155111": 1741159776,
+	"17000":    1740434112,
+}
+
+// Fork runs calls inside the server on go-ethereum's EVM against the state of
+// a remote node at one block. Accounts and storage slots are fetched from the
+// node the first time the execution touches them and kept for the lifetime
+// of the Fork, so a Fork serves one request. Writes of a call, and state
+// overrides, stay local.
+type Fork struct {
+	client  *ethclient.Client
+	config  *params.ChainConfig
+	context vm.BlockContext
+	reader  *remoteStateReader
+	state   *state.StateDB
+}
+
+// ForkCallResult is the outcome of a call run on a Fork.
+type ForkCallResult struct {
+	ReturnData []byte
+	GasUsed    uint64
+	Err        error // execution error, a revert carries its data as a forkRevertError
+	Trace      *callTracerFrame
+	Steps      []OpcodeStep
+	Truncated  bool
+}
+
+// forkRevertError is a revert inside a Fork, shaped like the error a node
+// answers eth_call with so AsRevertError decodes it.
+type forkRevertError struct {
+	data []byte
+}
+
+func (e *forkRevertError) Error() string          { return "execution reverted" }
+func (e *forkRevertError) ErrorCode() int         { return 3 }
+func (e *forkRevertError) ErrorData() interface{} { return hexutil.Encode(e.data) }
+
+type forkHeader struct {
+	Number        hexutil.Uint64  `json:"number"`
+	Hash          common.Hash     `json:"hash"`
+	Timestamp     hexutil.Uint64  `json:"timestamp"`
+	Miner         common.Address  `json:"miner"`
+	GasLimit      hexutil.Uint64  `json:"gasLimit"`
+	BaseFee       *hexutil.Big    `json:"baseFeePerGas"`
+	Difficulty    *hexutil.Big    `json:"difficulty"`
+	MixDigest     common.Hash     `json:"mixHash"`
+	ExcessBlobGas *hexutil.Uint64 `json:"excessBlobGas"`
+	RequestsHash  *common.Hash    `json:"requestsHash"` // from Prague on
+}
+
+// NewFork forks the state of chainId at block, which ResolveBlock has pinned.
+func NewFork(client *ethclient.Client, chainId string, block *BlockRef) (*Fork, error) {
+	config, err := forkChainConfig(chainId)
+	if err != nil {
+		return nil, err
+	}
+
+	var header *forkHeader
+	if block != nil && block.Hash != nil {
+		err = client.Client().CallContext(context.Background(), &header, "eth_getBlockByHash", *block.Hash, false)
+	} else {
+		err = client.Client().CallContext(context.Background(), &header, "eth_getBlockByNumber", block.rpcArg(), false)
+	}
+	if err == nil && header == nil {
+		err = fmt.Errorf("not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get fork block failed: %v", err)
+	}
+	pragueTime, known := forkPragueTimes[chainId]
+	if header.RequestsHash != nil || (known && uint64(header.Timestamp) >= pragueTime) {
+		return nil, utils.ErrNotImplemented(fmt.Sprintf("block %d is past the Prague fork, which fork execution does not implement yet, use execution=node", uint64(header.Number)))
+	}
+
+	reader := newRemoteStateReader(client, block)
+	statedb, err := state.New(types.EmptyRootHash, &remoteStateDatabase{
+		Database: state.NewDatabase(triedb.NewDatabase(rawdb.NewMemoryDatabase(), nil), nil),
+		reader:   reader,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create fork state failed: %v", err)
+	}
+
+	fork := &Fork{
+		client: client,
+		config: config,
+		reader: reader,
+		state:  statedb,
+	}
+	fork.context = vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		GetHash:     fork.blockHash,
+		Coinbase:    header.Miner,
+		GasLimit:    uint64(header.GasLimit),
+		BlockNumber: new(big.Int).SetUint64(uint64(header.Number)),
+		Time:        uint64(header.Timestamp),
+		Difficulty:  new(big.Int),
+		BaseFee:     new(big.Int),
+		BlobBaseFee: big.NewInt(1),
+	}
+	if header.Difficulty != nil {
+		fork.context.Difficulty = header.Difficulty.ToInt()
+	}
+	if fork.context.Difficulty.Sign() == 0 {
+		random := header.MixDigest
+		fork.context.Random = &random
+	}
+	if header.BaseFee != nil {
+		fork.context.BaseFee = header.BaseFee.ToInt()
+	}
+	if header.ExcessBlobGas != nil {
+		fork.context.BlobBaseFee = eip4844.CalcBlobFee(uint64(*header.ExcessBlobGas))
+	}
+	return fork, nil
+}
+
+func forkChainConfig(chainId string) (*params.ChainConfig, error) {
+	if config, ok := forkChainConfigs[chainId]; ok {
+		return config, nil
+	}
+	id, ok := new(big.Int).SetString(chainId, 10)
+	if !ok || id.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid chain id %q", chainId)
+	}
+
+	config := *params.AllDevChainProtocolChanges
+	config.ChainID = id
+	config.PragueTime = nil
+	return &config, nil
+}
+
+// ApplyOverrides writes a state override set to the fork.
+func (f *Fork) ApplyOverrides(overrides map[common.Address]OverrideAccount) error {
+	for address, account := range overrides {
+		if account.Balance != nil {
+			balance, overflow := uint256.FromBig(account.Balance.ToInt())
+			if overflow {
+				return fmt.Errorf("balance override of %s overflows 256 bits", address.Hex())
+			}
+			f.state.SetBalance(address, balance, tracing.BalanceChangeUnspecified)
+		}
+		if account.Nonce != nil {
+			f.state.SetNonce(address, uint64(*account.Nonce))
+		}
+		if account.Code != nil {
+			f.state.SetCode(address, *account.Code)
+		}
+		if account.State != nil {
+			f.state.SetStorage(address, account.State)
+		}
+		for slot, value := range account.StateDiff {
+			f.state.SetState(address, slot, value)
+		}
+	}
+	return nil
+}
+
+// Call runs a call to contractAddress under opts, which may be nil, and with
+// traceCalls or traceSteps records its call tree or its opcode steps.
+func (f *Fork) Call(contractAddress common.Address, callData []byte, opts *CallOptions, traceCalls bool, traceSteps bool) (*ForkCallResult, error) {
+	msg := &core.Message{
+		To:               &contractAddress,
+		Value:            new(big.Int),
+		GasLimit:         forkGas,
+		GasPrice:         new(big.Int),
+		GasFeeCap:        new(big.Int),
+		GasTipCap:        new(big.Int),
+		Data:             callData,
+		SkipNonceChecks:  true,
+		SkipFromEOACheck: true,
+	}
+	if opts != nil {
+		if opts.From != nil {
+			msg.From = *opts.From
+		}
+		if opts.Value != nil {
+			msg.Value = opts.Value
+		}
+		if opts.GasPrice != nil {
+			msg.GasPrice, msg.GasFeeCap, msg.GasTipCap = opts.GasPrice, opts.GasPrice, opts.GasPrice
+			// A priced call pays for its gas, so it gets a block's worth
+			msg.GasLimit = f.context.GasLimit
+		}
+		if opts.Gas != 0 {
+			msg.GasLimit = opts.Gas
+		}
+	}
+	msg.Nonce = f.state.GetNonce(msg.From)
+
+	result := &ForkCallResult{}
+	hooks := &tracing.Hooks{}
+	var callTracer *tracers.Tracer
+	if traceCalls {
+		var err error
+		callTracer, err = tracers.DefaultDirectory.New("callTracer", &tracers.Context{
+			BlockNumber: f.context.BlockNumber,
+		}, nil, f.config)
+		if err != nil {
+			return nil, fmt.Errorf("create call tracer failed: %v", err)
+		}
+		*hooks = *callTracer.Hooks
+	}
+	if traceSteps {
+		next := hooks.OnOpcode
+		hooks.OnOpcode = func(pc uint64, op byte, gas, cost uint64, scope tracing.OpContext, rData []byte, depth int, err error) {
+			if len(result.Steps) < forkMaxSteps {
+				result.Steps = append(result.Steps, newOpcodeStep(pc, op, gas, cost, scope, depth, err))
+			} else {
+				result.Truncated = true
+			}
+			if next != nil {
+				next(pc, op, gas, cost, scope, rData, depth, err)
+			}
+		}
+	}
+
+	evm := vm.NewEVM(f.context, core.NewEVMTxContext(msg), f.state, f.config, vm.Config{
+		Tracer:    hooks,
+		NoBaseFee: true,
+	})
+	timer := time.AfterFunc(forkTimeout, evm.Cancel)
+	defer timer.Stop()
+
+	if hooks.OnTxStart != nil {
+		hooks.OnTxStart(evm.GetVMContext(), types.NewTx(&types.LegacyTx{
+			Nonce:    msg.Nonce,
+			GasPrice: msg.GasPrice,
+			Gas:      msg.GasLimit,
+			To:       msg.To,
+			Value:    msg.Value,
+			Data:     msg.Data,
+		}), msg.From)
+	}
+	execution, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(msg.GasLimit))
+	if hooks.OnTxEnd != nil {
+		var receipt *types.Receipt
+		if execution != nil {
+			receipt = &types.Receipt{GasUsed: execution.UsedGas}
+		}
+		hooks.OnTxEnd(receipt, err)
+	}
+	if stateErr := f.state.Error(); stateErr != nil {
+		return nil, fmt.Errorf("fork state read failed: %v", stateErr)
+	}
+	if evm.Cancelled() {
+		return nil, fmt.Errorf("fork call ran over %v", forkTimeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fork call failed: %v", err)
+	}
+
+	result.ReturnData = execution.ReturnData
+	result.GasUsed = execution.UsedGas
+	if execution.Err != nil {
+		if errors.Is(execution.Err, vm.ErrExecutionReverted) {
+			result.Err = &forkRevertError{data: execution.Revert()}
+		} else {
+			result.Err = fmt.Errorf("execution failed: %v", execution.Err)
+		}
+	}
+
+	if callTracer != nil {
+		trace, err := callTracer.GetResult()
+		if err != nil {
+			return nil, fmt.Errorf("call trace failed: %v", err)
+		}
+		if err := json.Unmarshal(trace, &result.Trace); err != nil {
+			return nil, fmt.Errorf("call trace failed: %v", err)
+		}
+	}
+	return result, nil
+}
+
+// Info reports a call on the fork for a response.
+func (f *Fork) Info(result *ForkCallResult) *ForkInfo {
+	return &ForkInfo{
+		GasUsed:        result.GasUsed,
+		AccountsRead:   f.reader.accountsRead,
+		SlotsRead:      f.reader.slotsRead,
+		Steps:          result.Steps,
+		StepsTruncated: result.Truncated,
+	}
+}
+
+// blockHash answers BLOCKHASH from the node. Unknown blocks hash to zero,
+// like blocks out of the 256 block window.
+func (f *Fork) blockHash(number uint64) common.Hash {
+	var header *struct {
+		Hash common.Hash `json:"hash"`
+	}
+	err := f.client.Client().CallContext(context.Background(), &header, "eth_getBlockByNumber", rpc.BlockNumber(number), false)
+	if err != nil || header == nil {
+		return common.Hash{}
+	}
+	return header.Hash
+}
+
+func newOpcodeStep(pc uint64, op byte, gas, cost uint64, scope tracing.OpContext, depth int, err error) OpcodeStep {
+	step := OpcodeStep{
+		Pc:      pc,
+		Op:      vm.OpCode(op).String(),
+		Gas:     gas,
+		GasCost: cost,
+		Depth:   depth,
+	}
+	stack := scope.StackData()
+	step.Stack = make([]string, len(stack))
+	for i := range stack {
+		step.Stack[i] = stack[i].Hex()
+	}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	return step
+}
+
+// remoteStateDatabase is an in-memory state database whose accounts, storage
+// and code come from a remoteStateReader.
+type remoteStateDatabase struct {
+	state.Database
+	reader *remoteStateReader
+}
+
+func (db *remoteStateDatabase) Reader(root common.Hash) (state.Reader, error) {
+	return db.reader, nil
+}
+
+func (db *remoteStateDatabase) ContractCode(address common.Address, codeHash common.Hash) ([]byte, error) {
+	account, err := db.reader.account(address)
+	if err != nil {
+		return nil, err
+	}
+	return account.code, nil
+}
+
+func (db *remoteStateDatabase) ContractCodeSize(address common.Address, codeHash common.Hash) (int, error) {
+	code, err := db.ContractCode(address, codeHash)
+	return len(code), err
+}
+
+// remoteStateReader fetches accounts and storage slots at block from a node,
+// each once.
+type remoteStateReader struct {
+	client   *ethclient.Client
+	block    *BlockRef
+	accounts map[common.Address]*remoteAccount
+	storage  map[common.Address]map[common.Hash]common.Hash
+
+	accountsRead int
+	slotsRead    int
+}
+
+type remoteAccount struct {
+	balance *uint256.Int
+	nonce   uint64
+	code    []byte
+}
+
+func newRemoteStateReader(client *ethclient.Client, block *BlockRef) *remoteStateReader {
+	return &remoteStateReader{
+		client:   client,
+		block:    block,
+		accounts: make(map[common.Address]*remoteAccount),
+		storage:  make(map[common.Address]map[common.Hash]common.Hash),
+	}
+}
+
+// account fetches balance, nonce and code in one JSON-RPC batch.
+func (r *remoteStateReader) account(address common.Address) (*remoteAccount, error) {
+	if account, ok := r.accounts[address]; ok {
+		return account, nil
+	}
+
+	var balance hexutil.Big
+	var nonce hexutil.Uint64
+	var code hexutil.Bytes
+	batch := []rpc.BatchElem{
+		{Method: "eth_getBalance", Args: []interface{}{address, r.block.rpcArg()}, Result: &balance},
+		{Method: "eth_getTransactionCount", Args: []interface{}{address, r.block.rpcArg()}, Result: &nonce},
+		{Method: "eth_getCode", Args: []interface{}{address, r.block.rpcArg()}, Result: &code},
+	}
+	if err := r.client.Client().BatchCallContext(context.Background(), batch); err != nil {
+		return nil, fmt.Errorf("get account %s failed: %v", address.Hex(), err)
+	}
+	for _, elem := range batch {
+		if elem.Error != nil {
+			return nil, fmt.Errorf("get account %s failed: %s: %v", address.Hex(), elem.Method, elem.Error)
+		}
+	}
+
+	value, overflow := uint256.FromBig(balance.ToInt())
+	if overflow {
+		return nil, fmt.Errorf("get account %s failed: balance out of range", address.Hex())
+	}
+	account := &remoteAccount{balance: value, nonce: uint64(nonce), code: code}
+	r.accounts[address] = account
+	r.accountsRead++
+	return account, nil
+}
+
+func (r *remoteStateReader) Account(address common.Address) (*types.StateAccount, error) {
+	account, err := r.account(address)
+	if err != nil {
+		return nil, err
+	}
+	if account.nonce == 0 && account.balance.IsZero() && len(account.code) == 0 {
+		return nil, nil
+	}
+
+	codeHash := types.EmptyCodeHash
+	if len(account.code) > 0 {
+		codeHash = common.BytesToHash(crypto.Keccak256(account.code))
+	}
+	return &types.StateAccount{
+		Nonce:    account.nonce,
+		Balance:  new(uint256.Int).Set(account.balance),
+		Root:     types.EmptyRootHash, // the storage root is not known, slots are read one by one
+		CodeHash: codeHash.Bytes(),
+	}, nil
+}
+
+func (r *remoteStateReader) Storage(address common.Address, slot common.Hash) (common.Hash, error) {
+	if value, ok := r.storage[address][slot]; ok {
+		return value, nil
+	}
+
+	value, err := storageAtBlock(r.client, address, slot, r.block)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("get storage %s slot %s failed: %v", address.Hex(), slot.Hex(), err)
+	}
+	if r.storage[address] == nil {
+		r.storage[address] = make(map[common.Hash]common.Hash)
+	}
+	word := common.BytesToHash(value)
+	r.storage[address][slot] = word
+	r.slotsRead++
+	return word, nil
+}
+
+// Copy shares the reader, a Fork only ever runs on one goroutine.
+func (r *remoteStateReader) Copy() state.Reader {
+	return r
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -20,50 +21,81 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	handlerWithCORS := utils.EnableCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		query := r.URL.Query()
-		var response interface{}
-		var err error
-
 		w.Header().Set("Content-Type", "application/json")
-		switch query.Get("query") {
-		case "version":
-			response, err = GetVersionRequest(r)
-			HandleResponse(w, r, response, err)
-			return
-		case "evm-contract-ext-code-size":
-			response, err = GetEvmContractExtCodeSizeRequest(r)
-			HandleResponse(w, r, response, err)
-			return
-		case "evm-contract-code":
-			response, err = GetEvmContractCodeRequest(r)
-			HandleResponse(w, r, response, err)
-			return
-		case "evm-contract-data-at-memory":
-			response, err = GetEvmContractDataAtMemoryRequest(r)
-			HandleResponse(w, r, response, err)
-			return
-		case "evm-contract-call-view":
-			response, err = GetEvmContractCallViewRequest(r)
-			HandleResponse(w, r, response, err)
-			return
-		case "get-contract-balance":
-			response, err = GetEvmContractBalanceRequest(r)
-			HandleResponse(w, r, response, err)
-			return
-		default:
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(utils.ErrMalformedRequest("Invalid query parameter"))
-			return
-		}
+		response, err := Dispatch(r)
+		HandleResponse(w, r, response, err)
 	}))
 
 	handlerWithCORS.ServeHTTP(w, r)
 }
 
+// Dispatch runs the query named by the query parameter of r. The batch query
+// runs its items through here as well. Clients dialed outside a pool for the
+// query are closed once it returns.
+func Dispatch(r *http.Request) (interface{}, error) {
+	clients := &requestClients{}
+	defer clients.Close()
+	r = r.WithContext(withRequestClients(r.Context(), clients))
+
+	switch r.URL.Query().Get("query") {
+	case "version":
+		return GetVersionRequest(r)
+	case "evm-contract-ext-code-size":
+		return GetEvmContractExtCodeSizeRequest(r)
+	case "evm-contract-code":
+		return GetEvmContractCodeRequest(r)
+	case "evm-contract-data-at-memory":
+		return GetEvmContractDataAtMemoryRequest(r)
+	case "storage-slot":
+		return GetStorageSlotRequest(r)
+	case "storage-dump":
+		return GetStorageDumpRequest(r)
+	case "storage-diff":
+		return GetStorageDiffRequest(r)
+	case "evm-contract-call-view":
+		return GetEvmContractCallViewRequest(r)
+	case "get-contract-balance":
+		return GetEvmContractBalanceRequest(r)
+	case "evm-simulate":
+		return GetEvmSimulateRequest(r)
+	case "evm-multicall":
+		return GetEvmMulticallRequest(r)
+	case "evm-address":
+		return GetEvmAddressRequest(r)
+	case "resolve-proxy":
+		return ResolveProxyRequest(r)
+	case "evm-transaction":
+		return GetEvmTransactionRequest(r)
+	case "evm-block":
+		return GetEvmBlockRequest(r)
+	case "evm-logs":
+		return GetEvmLogsRequest(r)
+	case "decode-calldata":
+		return DecodeCalldataRequest(r)
+	case "decode-return":
+		return DecodeReturnRequest(r)
+	case "lookup-selector":
+		return LookupSelectorRequest(r)
+	case "lookup-topic":
+		return LookupTopicRequest(r)
+	case "contract-abis":
+		return GetContractAbisRequest(r)
+	case "register-contract-abi":
+		return RegisterContractAbiRequest(r)
+	case "bind-contract-abi":
+		return BindContractAbiRequest(r)
+	case "batch":
+		return BatchRequest(r)
+	default:
+		return nil, utils.ErrMalformedRequest("Invalid query parameter")
+	}
+}
+
 func HandleResponse(w http.ResponseWriter, r *http.Request, response interface{}, err error) {
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(err)
+		status, body := ErrorResponse(err)
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
 		return
 	}
 
@@ -75,3 +107,18 @@ func HandleResponse(w http.ResponseWriter, r *http.Request, response interface{}
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 	}
 }
+
+// ErrorResponse maps an error to its HTTP status and JSON body: revert errors
+// answer 422, API errors their own code and anything else 500.
+func ErrorResponse(err error) (int, interface{}) {
+	var apiErr utils.Error
+	var revertErr *RevertError
+	switch {
+	case errors.As(err, &revertErr):
+		return http.StatusUnprocessableEntity, revertErr
+	case errors.As(err, &apiErr) && apiErr.Code != 0:
+		return int(apiErr.Code), apiErr
+	default:
+		return http.StatusInternalServerError, utils.ErrInternal(err.Error())
+	}
+}
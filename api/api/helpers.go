@@ -1,17 +1,19 @@
 package handler
 
 import (
-	"context"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	utils "generic-evm-api-go/api/pkg/utils"
 	"math/big"
+	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/sirupsen/logrus"
 )
@@ -26,14 +28,41 @@ func DialClient(jsonrpc string) (*ethclient.Client, error) {
 	return client, nil
 }
 
-func ViewFunction(client *ethclient.Client, contractAddress common.Address, parsedABI abi.ABI, methodName string, args ...interface{}) ([]byte, error) {
-	data, err := parsedABI.Pack(methodName, args...)
+// dialChainClient dials the RPC of the supported chain. Clients come from the
+// pool of the request, so repeated queries to one RPC share a connection.
+func dialChainClient(r *http.Request, chainId string) (*ethclient.Client, error) {
+	chainInfo, err := GetChainInfo(chainId)
+	if err != nil {
+		return nil, err
+	}
+	return dialRpcClient(r, chainInfo.RPC)
+}
+
+// dialRpcClient dials url, which has to be an http(s) or ws(s) URL, while
+// serving r.
+func dialRpcClient(r *http.Request, url string) (*ethclient.Client, error) {
+	if err := checkRpcURL(url); err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	client, err := dialRequestClient(r, url)
+	if err != nil {
+		err_ := fmt.Errorf("dial client %v failed: %v", url, err.Error())
+		logrus.Error(err_)
+		return nil, err_
+	}
+	return client, nil
+}
+
+func ViewFunction(client *ethclient.Client, contractAddress common.Address, block *BlockRef, parsedABI abi.ABI, methodName string, args ...interface{}) ([]byte, error) {
+	data, err := GetCallBytes(parsedABI, methodName, args...)
 	if err != nil {
 		return nil, err
 	}
 
 	callMsg := ethereum.CallMsg{To: &contractAddress, Data: data}
-	result, err := client.CallContract(context.Background(), callMsg, big.NewInt(305965178))
+	result, err := callAtBlock(client, callMsg, block)
 	if err != nil {
 		return nil, err
 	}
@@ -66,22 +95,16 @@ func GetCallBytes(parsedABI abi.ABI, methodName string, args ...interface{}) ([]
 	return data, err
 }
 
-func ExtCodeSize(client *ethclient.Client, address common.Address) ([]byte, int, error) {
-	ctx := context.Background()
-	code, err := client.CodeAt(ctx, address, nil) // nil block number for the latest state
+func ExtCodeSize(client *ethclient.Client, address common.Address, block *BlockRef) ([]byte, int, error) {
+	code, err := codeAtBlock(client, address, block)
 	if err != nil {
 		return nil, 0, fmt.Errorf("geth client failed to get extcodesize: %v", err)
 	}
 	return code, len(code), nil
 }
 
-func GetStorageAt(client *ethclient.Client, address common.Address, slot int64) ([]byte, error) {
-	slotHash := common.BigToHash(common.Big1)
-	if slot != 0 {
-		slotHash = common.BigToHash(big.NewInt(int64(slot)))
-	}
-
-	storage, err := client.StorageAt(context.Background(), address, slotHash, nil)
+func GetStorageAt(client *ethclient.Client, address common.Address, slot common.Hash, block *BlockRef) ([]byte, error) {
+	storage, err := storageAtBlock(client, address, slot, block)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get storage: %+v", err.Error())
 	}
@@ -90,118 +113,539 @@ func GetStorageAt(client *ethclient.Client, address common.Address, slot int64)
 }
 
 func ConstructCallData(methodName string, params []utils.Parameter) ([]byte, error) {
-	// Create method signature
-	methodSig := createMethodSignature(methodName, params)
+	// Build the signature from the parameter types, then pack the values behind its selector
+	signature, err := signatureFromParams(methodName, params)
+	if err != nil {
+		return nil, err
+	}
 
-	// Calculate function selector (first 4 bytes of the hash of the method signature)
-	selector := crypto.Keccak256([]byte(methodSig))[:4]
+	args := make([]interface{}, 0, len(params))
+	for _, param := range params {
+		args = append(args, param.Value)
+	}
+
+	return signature.EncodeCall(args)
+}
 
-	// Parse and pack parameters
-	packedParams, err := packParameters(params)
+func signatureFromParams(methodName string, params []utils.Parameter) (*FunctionSignature, error) {
+	signature := &FunctionSignature{Name: methodName}
+	for i, param := range params {
+		if param.Type == "" {
+			return nil, fmt.Errorf("argument %d has no type", i)
+		}
+		abiType, err := ParseAbiType(param.Type)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %v", i, err)
+		}
+		signature.Inputs = append(signature.Inputs, abi.Argument{Type: abiType})
+	}
+	return signature, nil
+}
+
+func CallContract(
+	client *ethclient.Client,
+	contractAddress common.Address,
+	methodName string,
+	params []utils.Parameter,
+	block *BlockRef,
+) ([]byte, error) {
+	callData, err := ConstructCallData(methodName, params)
 	if err != nil {
-		return nil, fmt.Errorf("failed to pack parameters: %v", err)
+		return nil, fmt.Errorf("failed to construct call data: %v", err)
 	}
 
-	// Combine selector with packed parameters
-	callData := append(selector, packedParams...)
+	return CallContractData(client, contractAddress, callData, block)
+}
+
+func CallContractData(client *ethclient.Client, contractAddress common.Address, callData []byte, block *BlockRef) ([]byte, error) {
+	msg := ethereum.CallMsg{
+		To:   &contractAddress,
+		Data: callData,
+	}
 
-	return callData, nil
+	result, err := callAtBlock(client, msg, block)
+	if err != nil {
+		return nil, fmt.Errorf("contract call failed: %w", err)
+	}
+
+	return result, nil
 }
 
-func createMethodSignature(methodName string, params []utils.Parameter) string {
-	var types []string
-	for _, param := range params {
-		types = append(types, param.Type)
+// parseCallArgs collects positional argument values from the POST body, the
+// args query key (repeated, or one JSON array) or the method-inputs values,
+// in that order of preference.
+func parseCallArgs(r *http.Request, methodParams []utils.Parameter, bodyArgs []interface{}) ([]interface{}, error) {
+	if bodyArgs != nil {
+		return bodyArgs, nil
+	}
+
+	if r != nil {
+		values := r.URL.Query()["args"]
+		if len(values) == 1 && strings.HasPrefix(strings.TrimSpace(values[0]), "[") {
+			var args []interface{}
+			decoder := json.NewDecoder(strings.NewReader(values[0]))
+			decoder.UseNumber()
+			if err := decoder.Decode(&args); err != nil {
+				return nil, utils.ErrMalformedRequest(fmt.Sprintf("args must be a JSON array: %v", err))
+			}
+			return args, nil
+		}
+		if len(values) > 0 {
+			args := make([]interface{}, 0, len(values))
+			for _, value := range values {
+				args = append(args, value)
+			}
+			return args, nil
+		}
+	}
+
+	args := make([]interface{}, 0, len(methodParams))
+	for _, param := range methodParams {
+		args = append(args, param.Value)
 	}
-	return fmt.Sprintf("%s(%s)", methodName, strings.Join(types, ","))
+	return args, nil
 }
 
-func packParameters(params []utils.Parameter) ([]byte, error) {
-	if len(params) == 0 {
-		logrus.Error("param count 0")
-		return []byte{}, nil
+// parseListParam reads a list query value, repeated (keys=a&keys=b) or as one
+// JSON array (keys=["a","b"]). value is used when there is no request.
+func parseListParam(r *http.Request, name string, value string) ([]string, error) {
+	values := []string{}
+	if r != nil {
+		values = r.URL.Query()[name]
+	} else if value != "" {
+		values = []string{value}
+	}
+	if len(values) != 1 || !strings.HasPrefix(strings.TrimSpace(values[0]), "[") {
+		return values, nil
 	}
 
-	var arguments abi.Arguments
-	var values []interface{}
+	var items []interface{}
+	decoder := json.NewDecoder(strings.NewReader(values[0]))
+	decoder.UseNumber()
+	if err := decoder.Decode(&items); err != nil {
+		return nil, utils.ErrMalformedRequest(fmt.Sprintf("%s must be a JSON array: %v", name, err))
+	}
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		list = append(list, fmt.Sprint(item))
+	}
+	return list, nil
+}
 
-	for _, param := range params {
-		abiType, err := abi.NewType(param.Type, "", nil)
+// resolveCallSignature builds the function to call from method-name, which may
+// be a human-readable signature carrying input and output types, or from the
+// typed method-inputs. Outputs fall back to method-outputs.
+func resolveCallSignature(methodName string, methodParams []utils.Parameter, methodOutputs []utils.Parameter) (*FunctionSignature, error) {
+	var signature *FunctionSignature
+	if strings.Contains(methodName, "(") {
+		signature_, err := ParseFunctionSignature(methodName)
 		if err != nil {
-			return nil, fmt.Errorf("invalid type %s: %v", param.Type, err)
+			return nil, utils.ErrMalformedRequest(err.Error())
 		}
-		arguments = append(arguments, abi.Argument{Type: abiType})
+		signature = signature_
+	} else {
+		signature_, err := signatureFromParams(methodName, methodParams)
+		if err != nil {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("method-inputs: %v, or give a signature in method-name", err))
+		}
+		signature = signature_
+	}
+
+	if len(signature.Outputs) == 0 {
+		for i, output := range methodOutputs {
+			abiType, err := ParseAbiType(output.Type)
+			if err != nil {
+				return nil, utils.ErrMalformedRequest(fmt.Sprintf("method-outputs[%d]: %v", i, err))
+			}
+			signature.Outputs = append(signature.Outputs, abi.Argument{Name: fmt.Sprintf("output%d", i), Type: abiType})
+		}
+	}
+
+	return signature, nil
+}
 
-		value, err := parseParameterValue(param.Type, param.Value)
+// callViewWithAbi runs evm-contract-call-view for a method of a full contract
+// ABI through call, decoding outputs by name and reverts with the ABI's
+// custom errors.
+func callViewWithAbi(
+	params *GetEvmContractCallViewRequestParams,
+	parsedABI abi.ABI,
+	method *abi.Method,
+	call func() ([]byte, error),
+) (*GetEvmContractCallViewRequestResponse, error) {
+	result, err := call()
+	if err != nil {
+		if revertErr := AsRevertError(err, &parsedABI); revertErr != nil {
+			logrus.Error(revertErr.Details)
+			return nil, revertErr
+		}
+		err_ := fmt.Errorf("failed to call contract %v: %w", params.Address, err)
+		logrus.Error(err_)
+		return nil, err_
+	}
+
+	decoded, err := DecodeAbiValues(method.Outputs, result)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	return &GetEvmContractCallViewRequestResponse{
+		ChainId:    params.ChainId,
+		Address:    params.Address,
+		MethodName: method.RawName,
+		Signature:  method.Sig,
+		Response:   hex.EncodeToString(result),
+		Decoded:    decoded,
+		Outputs:    NamedAbiValues(method.Outputs, decoded),
+	}, nil
+}
+
+// callViewWithSignature runs evm-contract-call-view through call for a
+// function given by its signature or typed method-inputs and method-outputs.
+func callViewWithSignature(
+	params *GetEvmContractCallViewRequestParams,
+	signature *FunctionSignature,
+	call func() ([]byte, error),
+) (*GetEvmContractCallViewRequestResponse, error) {
+	result, err := call()
+	if err != nil {
+		if revertErr := AsRevertError(err, nil); revertErr != nil {
+			logrus.Error(revertErr.Details)
+			return nil, revertErr
+		}
+		err_ := fmt.Errorf("failed to call contract %v: %w", params.Address, err)
+		logrus.Error(err_)
+		return nil, err_
+	}
+
+	var decoded []interface{}
+	if len(signature.Outputs) > 0 {
+		decoded, err = DecodeAbiValues(signature.Outputs, result)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse parameter value: %v", err)
+			logrus.Error(err)
+			return nil, err
+		}
+	}
+
+	return &GetEvmContractCallViewRequestResponse{
+		ChainId:    params.ChainId,
+		Address:    params.Address,
+		MethodName: signature.Name,
+		Signature:  signature.Signature(),
+		Response:   hex.EncodeToString(result),
+		Decoded:    decoded,
+	}, nil
+}
+
+func abiHasMethod(parsedABI abi.ABI, methodName string) bool {
+	if i := strings.IndexByte(methodName, '('); i != -1 {
+		methodName = methodName[:i]
+	}
+	for _, method := range parsedABI.Methods {
+		if method.RawName == methodName {
+			return true
 		}
-		values = append(values, value)
 	}
+	return false
+}
 
-	logrus.Error(values)
-	packed, err := arguments.Pack(values...)
+// decodeHexParam decodes a hex query value, with or without the 0x prefix.
+func decodeHexParam(name string, value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "0x") && !strings.HasPrefix(value, "0X") {
+		value = "0x" + value
+	}
+	data, err := hexutil.Decode(value)
 	if err != nil {
-		return nil, fmt.Errorf("failed to pack values: %v", err)
+		return nil, utils.ErrMalformedRequest(fmt.Sprintf("%s is not valid hex: %v", name, err))
 	}
+	return data, nil
+}
 
-	return packed, nil
+// parseFlag parses a boolean query value; empty is false.
+func parseFlag(name string, value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	flag, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return false, utils.ErrMalformedRequest(fmt.Sprintf("%s must be true or false, got %q", name, value))
+	}
+	return flag, nil
 }
 
-func parseParameterValue(paramType, paramValue string) (interface{}, error) {
-	switch paramType {
-	case "uint256":
-		val, ok := new(big.Int).SetString(paramValue, 10)
-		if !ok {
-			return nil, fmt.Errorf("invalid uint256: %s", paramValue)
+// parseTrace parses the trace query value: true or calls for the call tree,
+// opcodes for the call tree and the opcode steps.
+func parseTrace(value string) (bool, bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "opcodes":
+		return true, true, nil
+	case "calls":
+		return true, false, nil
+	}
+	trace, err := parseFlag("trace", value)
+	return trace, false, err
+}
+
+// parseExecution parses the execution query value, reporting whether the
+// call runs on a Fork.
+func parseExecution(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "node":
+		return false, nil
+	case "fork":
+		return true, nil
+	}
+	return false, utils.ErrMalformedRequest(fmt.Sprintf("execution must be node or fork, got %q", value))
+}
+
+// calldataCandidates lists the methods calldata with the given selector may
+// belong to, keyed to where each came from: the explicit signature, the method
+// of the request ABI, every registered ABI and finally the signature database.
+func calldataCandidates(params *DecodeCalldataRequestParams, inline []byte, selector []byte) ([]abi.Method, map[string]string, error) {
+	if params.Signature != "" {
+		signature, err := ParseFunctionSignature(params.Signature)
+		if err != nil {
+			return nil, nil, utils.ErrMalformedRequest(err.Error())
 		}
-		return val, nil
+		method := signature.Method()
+		return []abi.Method{method}, map[string]string{method.Sig: "signature"}, nil
+	}
 
-	case "address":
-		return common.HexToAddress(paramValue), nil
+	contractAbi, err := resolveContractAbi(inline, params.AbiName, params.ChainId, params.Address)
+	if err != nil {
+		return nil, nil, utils.ErrMalformedRequest(err.Error())
+	}
+	if contractAbi != nil {
+		if method, err := contractAbi.MethodById(selector); err == nil {
+			return []abi.Method{*method}, map[string]string{method.Sig: "abi"}, nil
+		}
+	}
 
-	case "bytes":
-		if !strings.HasPrefix(paramValue, "0x") {
-			return nil, fmt.Errorf("bytes value must start with 0x")
+	candidates := []abi.Method{}
+	sources := make(map[string]string)
+	for _, method := range GetAbiRegistry().MethodsBySelector(selector) {
+		candidates = append(candidates, method)
+		sources[method.Sig] = "registry"
+	}
+	for _, method := range GetSignatureDB().Methods(selector) {
+		if _, ok := sources[method.Sig]; ok {
+			continue
 		}
-		data, err := hex.DecodeString(paramValue[2:])
+		candidates = append(candidates, method)
+		sources[method.Sig] = "signature-db"
+	}
+	return candidates, sources, nil
+}
+
+// resolveReturnOutputs finds the output types for decode-return from, in
+// order, a signature, a types list, method-outputs or an ABI method.
+func resolveReturnOutputs(params *DecodeReturnRequestParams, inline []byte) (abi.Arguments, error) {
+	if params.Signature != "" {
+		signature, err := ParseFunctionSignature(params.Signature)
 		if err != nil {
-			return nil, fmt.Errorf("invalid bytes: %s", paramValue)
+			return nil, utils.ErrMalformedRequest(err.Error())
+		}
+		if len(signature.Outputs) == 0 {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("signature %s has no outputs", params.Signature))
 		}
-		return data, nil
+		return signature.Outputs, nil
+	}
 
-	case "bool":
-		return paramValue == "true", nil
+	if params.Types != "" {
+		outputs, err := parseAbiArguments(params.Types)
+		if err != nil {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("types: %v", err))
+		}
+		return outputs, nil
+	}
 
-	case "string":
-		return paramValue, nil
+	if len(params.MethodOutputs) > 0 {
+		outputs := abi.Arguments{}
+		for i, output := range params.MethodOutputs {
+			abiType, err := ParseAbiType(output.Type)
+			if err != nil {
+				return nil, utils.ErrMalformedRequest(fmt.Sprintf("method-outputs[%d]: %v", i, err))
+			}
+			outputs = append(outputs, abi.Argument{Type: abiType})
+		}
+		return outputs, nil
+	}
+
+	contractAbi, err := resolveContractAbi(inline, params.AbiName, params.ChainId, params.Address)
+	if err != nil {
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+	if contractAbi == nil || params.MethodName == "" {
+		return nil, utils.ErrMalformedRequest("Missing fields: signature, types, method-outputs or an ABI with method-name")
+	}
 
-	default:
-		return nil, fmt.Errorf("unsupported parameter type: %s", paramType)
+	var outputs abi.Arguments
+	for _, method := range contractAbi.Methods {
+		if method.RawName != params.MethodName && method.Sig != params.MethodName {
+			continue
+		}
+		if outputs != nil && !sameArgumentTypes(outputs, method.Outputs) {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("overloads of %s return different types: pass the full signature as method-name", params.MethodName))
+		}
+		outputs = method.Outputs
+	}
+	if outputs == nil {
+		return nil, utils.ErrMalformedRequest(fmt.Sprintf("method %s not found in ABI", params.MethodName))
 	}
+	return outputs, nil
 }
 
-func CallContract(
-	client *ethclient.Client,
-	contractAddress common.Address,
-	methodName string,
-	params []utils.Parameter,
-) ([]byte, error) {
-	fmt.Printf("\n current params in callcontract: %v", params)
-	callData, err := ConstructCallData(methodName, params)
+func sameArgumentTypes(a, b abi.Arguments) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Type.String() != b[i].Type.String() {
+			return false
+		}
+	}
+	return true
+}
+
+// getStorageVariable serves evm-contract-data-at-memory for a variable path:
+// it locates the variable with the storage layout, checks its dynamic array
+// indexes, reads its slots at the block and decodes the value.
+func getStorageVariable(client *ethclient.Client, params *GetEvmContractDataAtMemoryRequestParams, inlineLayout []byte) (*GetEvmContractDataAtMemoryRequestResponse, error) {
+	layout, err := resolveStorageLayout(inlineLayout, params.AbiName, params.ChainId, params.Address)
 	if err != nil {
-		return nil, fmt.Errorf("failed to construct call data: %v", err)
+		logrus.Error(err)
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+	location, err := layout.Locate(params.Variable)
+	if err != nil {
+		logrus.Error(err)
+		return nil, utils.ErrMalformedRequest(err.Error())
 	}
 
-	msg := ethereum.CallMsg{
-		To:   &contractAddress,
-		Data: callData,
+	block, blockInfo, err := ResolveBlock(client, params.Block)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
 	}
 
-	result, err := client.CallContract(context.Background(), msg, nil)
+	reader := NewStorageReader(client, common.HexToAddress(params.Address), block)
+	if err := CheckIndexes(reader, location); err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+	value, err := layout.DecodeStorageValue(reader, location)
 	if err != nil {
-		return nil, fmt.Errorf("contract call failed: %v", err)
+		logrus.Error(err)
+		return nil, err
+	}
+	word, err := reader.Word(location.Slot)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
 	}
 
-	return result, nil
+	return &GetEvmContractDataAtMemoryRequestResponse{
+		ChainId:  params.ChainId,
+		Address:  params.Address,
+		Bytes:    hex.EncodeToString(word.Bytes()),
+		Variable: params.Variable,
+		Type:     layout.Types[location.Type].Label,
+		Slot:     location.Slot.Hex(),
+		Offset:   &location.Offset,
+		Value:    value,
+		Block:    blockInfo,
+	}, nil
+}
+
+// parseSlotList reads the slots of a multi-slot read, listed in slots or as
+// a range of count slots from start, and nil for a single slot read.
+func parseSlotList(r *http.Request, params *GetEvmContractDataAtMemoryRequestParams) ([]common.Hash, error) {
+	values, err := parseListParam(r, "slots", params.Slots)
+	if err != nil {
+		return nil, err
+	}
+	ranged := params.Start != "" || params.Count != ""
+	if len(values) == 0 && !ranged {
+		return nil, nil
+	}
+	if (len(values) > 0 && ranged) || params.StorgeAt != "" || params.Variable != "" {
+		return nil, utils.ErrMalformedRequest("give one of storage-at, variable, slots or start and count")
+	}
+
+	if ranged {
+		start, err := ParseSlot(params.Start)
+		if err != nil {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("start: %v", err))
+		}
+		count, err := strconv.Atoi(params.Count)
+		if err != nil || count <= 0 || count > maxStorageReadSlots {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("count must be between 1 and %d", maxStorageReadSlots))
+		}
+		slots := make([]common.Hash, count)
+		for i := range slots {
+			slots[i] = addSlot(start, big.NewInt(int64(i)))
+		}
+		return slots, nil
+	}
+
+	if len(values) > maxStorageReadSlots {
+		return nil, utils.ErrMalformedRequest(fmt.Sprintf("at most %d slots can be read at once", maxStorageReadSlots))
+	}
+	slots := make([]common.Hash, 0, len(values))
+	for _, value := range values {
+		slot, err := ParseSlot(value)
+		if err != nil {
+			return nil, utils.ErrMalformedRequest(err.Error())
+		}
+		slots = append(slots, slot)
+	}
+	return slots, nil
+}
+
+// getStorageSlots serves a multi-slot read of evm-contract-data-at-memory:
+// every slot is read at the same block in JSON-RPC batches.
+func getStorageSlots(client *ethclient.Client, params *GetEvmContractDataAtMemoryRequestParams, slots []common.Hash) (*GetEvmContractDataAtMemoryRequestResponse, error) {
+	skipZero, err := parseFlag("skip-zero", params.SkipZero)
+	if err != nil {
+		return nil, err
+	}
+
+	block, blockInfo, err := ResolveBlock(client, params.Block)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	reader := NewStorageReader(client, common.HexToAddress(params.Address), block)
+	if err := reader.Prefetch(slots); err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	values := StorageWords{}
+	seen := make(map[common.Hash]bool, len(slots))
+	for _, slot := range slots {
+		if seen[slot] {
+			continue
+		}
+		seen[slot] = true
+		word, err := reader.Word(slot)
+		if err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+		if skipZero && word == (common.Hash{}) {
+			continue
+		}
+		values = append(values, StorageWord{Slot: slot.Hex(), Value: word.Hex()})
+	}
+
+	return &GetEvmContractDataAtMemoryRequestResponse{
+		ChainId: params.ChainId,
+		Address: params.Address,
+		Values:  &values,
+		Block:   blockInfo,
+	}, nil
 }
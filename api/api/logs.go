@@ -0,0 +1,321 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	utils "generic-evm-api-go/api/pkg/utils"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultLogBlockChunk = 2000
+	defaultLogLimit      = 1000
+	maxLogLimit          = 10000
+)
+
+// ParseEventSignature parses a human-readable event declaration such as
+// "event Transfer(address indexed from, address indexed to, uint256 value)".
+func ParseEventSignature(declaration string) (abi.Event, error) {
+	body := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(declaration), "event "))
+	anonymous := strings.HasSuffix(body, "anonymous")
+	body = strings.TrimSpace(strings.TrimSuffix(body, "anonymous"))
+
+	function, err := ParseFunctionSignature(body)
+	if err != nil {
+		return abi.Event{}, err
+	}
+	return abi.NewEvent(function.Name, function.Name, anonymous, function.Inputs), nil
+}
+
+// LogCursor is where a page of logs resumes: the log at LogIndex in Block,
+// written as "<block>" or "<block>:<log-index>".
+type LogCursor struct {
+	Block    uint64
+	LogIndex uint
+}
+
+func (c LogCursor) String() string {
+	if c.LogIndex == 0 {
+		return strconv.FormatUint(c.Block, 10)
+	}
+	return fmt.Sprintf("%d:%d", c.Block, c.LogIndex)
+}
+
+// parseLogCursor reads a cursor, whose block may also be a tag or hash.
+func parseLogCursor(client *ethclient.Client, value string) (LogCursor, error) {
+	blockValue, indexValue, hasIndex := strings.Cut(strings.TrimSpace(value), ":")
+	block, err := resolveBlockNumber(client, blockValue)
+	if err != nil {
+		return LogCursor{}, err
+	}
+	cursor := LogCursor{Block: block}
+	if hasIndex {
+		index, err := strconv.ParseUint(indexValue, 10, 32)
+		if err != nil {
+			return LogCursor{}, fmt.Errorf("invalid log index %q", indexValue)
+		}
+		cursor.LogIndex = uint(index)
+	}
+	return cursor, nil
+}
+
+// FilterLogsChunked runs eth_getLogs from the cursor from up to block to in
+// windows of chunk blocks so each request stays inside provider range
+// limits. A failing window is retried at half the size down to a single
+// block. It returns at most limit logs and the cursor of the next one, which
+// may be inside the last window, or nil when the range is exhausted.
+func FilterLogsChunked(client *ethclient.Client, query ethereum.FilterQuery, from LogCursor, to, chunk uint64, limit int) ([]types.Log, *LogCursor, error) {
+	logs := []types.Log{}
+
+	for start := from.Block; start <= to; {
+		end := start + chunk - 1
+		if end > to || end < start {
+			end = to
+		}
+
+		query.FromBlock = new(big.Int).SetUint64(start)
+		query.ToBlock = new(big.Int).SetUint64(end)
+
+		chunkLogs, err := client.FilterLogs(context.Background(), query)
+		if err != nil {
+			if end == start {
+				return nil, nil, fmt.Errorf("get logs for block %d failed: %v", start, err)
+			}
+			chunk = (end - start + 1) / 2
+			logrus.Debug(fmt.Sprintf("get logs %d-%d failed, retrying with %d blocks: %v", start, end, chunk, err))
+			continue
+		}
+
+		for _, log := range chunkLogs {
+			// the logs of the cursor's block before its log were on the last page
+			if log.BlockNumber == from.Block && log.Index < from.LogIndex {
+				continue
+			}
+			if len(logs) == limit {
+				return logs, &LogCursor{Block: log.BlockNumber, LogIndex: log.Index}, nil
+			}
+			logs = append(logs, log)
+		}
+		if end == to {
+			break
+		}
+		start = end + 1
+		if len(logs) == limit {
+			return logs, &LogCursor{Block: start}, nil
+		}
+	}
+
+	return logs, nil, nil
+}
+
+// logEventResolver finds the event declaration for a log: explicit events
+// from the request first, then the ABI bound to the emitting contract, every
+// registered ABI and finally the signature database.
+type logEventResolver struct {
+	chainId  string
+	explicit []abi.Event
+}
+
+func (res *logEventResolver) candidates(log types.Log) []abi.Event {
+	topic := log.Topics[0]
+
+	candidates := []abi.Event{}
+	for _, event := range res.explicit {
+		if event.ID == topic {
+			candidates = append(candidates, event)
+		}
+	}
+	if len(res.explicit) > 0 {
+		return candidates
+	}
+
+	registry := GetAbiRegistry()
+	if bound, ok := registry.Lookup(res.chainId, log.Address); ok {
+		if event, err := bound.ABI.EventByID(topic); err == nil {
+			candidates = append(candidates, *event)
+		}
+	}
+	candidates = append(candidates, registry.EventsByTopic(topic)...)
+	return append(candidates, GetSignatureDB().Events(topic)...)
+}
+
+// DecodeLog formats a log, decoding it with the first candidate event whose
+// indexed parameters match the topic count and whose data unpacks.
+func (res *logEventResolver) DecodeLog(log types.Log) EvmLog {
+	decoded := EvmLog{
+		Address:     log.Address.Hex(),
+		BlockNumber: log.BlockNumber,
+		BlockHash:   log.BlockHash.Hex(),
+		TxHash:      log.TxHash.Hex(),
+		TxIndex:     log.TxIndex,
+		LogIndex:    log.Index,
+		Removed:     log.Removed,
+		Topics:      make([]string, 0, len(log.Topics)),
+		Data:        hexutil.Encode(log.Data),
+	}
+	for _, topic := range log.Topics {
+		decoded.Topics = append(decoded.Topics, topic.Hex())
+	}
+	if len(log.Topics) == 0 {
+		return decoded
+	}
+
+	for _, event := range res.candidates(log) {
+		indexed, args, err := decodeEventValues(event, log)
+		if err != nil {
+			continue
+		}
+		decoded.Event = event.RawName
+		decoded.Signature = event.Sig
+		decoded.Indexed = indexed
+		decoded.Args = args
+		break
+	}
+	return decoded
+}
+
+func decodeEventValues(event abi.Event, log types.Log) (map[string]interface{}, map[string]interface{}, error) {
+	var indexedArgs abi.Arguments
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			indexedArgs = append(indexedArgs, input)
+		}
+	}
+	if len(indexedArgs) != len(log.Topics)-1 {
+		return nil, nil, fmt.Errorf("%s expects %d indexed topics, got %d", event.Sig, len(indexedArgs), len(log.Topics)-1)
+	}
+
+	topics := make([]interface{}, 0, len(indexedArgs))
+	for i, input := range indexedArgs {
+		value, err := decodeTopicValue(input.Type, log.Topics[i+1])
+		if err != nil {
+			return nil, nil, err
+		}
+		topics = append(topics, value)
+	}
+
+	nonIndexed := event.Inputs.NonIndexed()
+	values, err := DecodeAbiValues(nonIndexed, log.Data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NamedAbiValues(indexedArgs, topics), NamedAbiValues(nonIndexed, values), nil
+}
+
+// decodeTopicValue decodes an indexed parameter. Dynamic types are stored as
+// their keccak256 hash, which is returned as is.
+func decodeTopicValue(typ abi.Type, topic common.Hash) (interface{}, error) {
+	switch typ.T {
+	case abi.StringTy, abi.BytesTy, abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+		return topic.Hex(), nil
+	}
+
+	values, err := DecodeAbiValues(abi.Arguments{{Type: typ}}, topic.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return values[0], nil
+}
+
+// buildLogFilter turns the evm-logs parameters into a filter query and the
+// resolver used to decode the matching logs.
+func buildLogFilter(params *GetEvmLogsRequestParams, inline []byte) (ethereum.FilterQuery, *logEventResolver, error) {
+	query := ethereum.FilterQuery{}
+	resolver := &logEventResolver{chainId: params.ChainId}
+
+	for _, address := range strings.Split(params.Address, ",") {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
+		}
+		if !common.IsHexAddress(address) {
+			return query, nil, utils.ErrMalformedRequest(fmt.Sprintf("address %q is not hex", address))
+		}
+		query.Addresses = append(query.Addresses, common.HexToAddress(address))
+	}
+
+	if params.Event != "" {
+		event, err := ParseEventSignature(params.Event)
+		if err != nil {
+			return query, nil, utils.ErrMalformedRequest(fmt.Sprintf("event: %v", err))
+		}
+		resolver.explicit = append(resolver.explicit, event)
+		if params.Topics[0] == "" {
+			params.Topics[0] = event.ID.Hex()
+		}
+	}
+
+	contractAbi, err := resolveContractAbi(inline, params.AbiName, "", "")
+	if err != nil {
+		return query, nil, utils.ErrMalformedRequest(err.Error())
+	}
+	if contractAbi != nil {
+		for _, event := range contractAbi.Events {
+			resolver.explicit = append(resolver.explicit, event)
+		}
+	}
+
+	// Trailing wildcard positions are dropped; inner ones stay as nil
+	last := -1
+	for i, topics := range params.Topics {
+		if strings.TrimSpace(topics) != "" {
+			last = i
+		}
+	}
+	for i := 0; i <= last; i++ {
+		var set []common.Hash
+		for _, topic := range strings.Split(params.Topics[i], ",") {
+			topic = strings.TrimSpace(topic)
+			if topic == "" || topic == "null" {
+				continue
+			}
+			data, err := decodeHexParam(fmt.Sprintf("topics[%d]", i), topic)
+			if err != nil {
+				return query, nil, err
+			}
+			if len(data) != common.HashLength {
+				return query, nil, utils.ErrMalformedRequest(fmt.Sprintf("topics[%d]: %s is not 32 bytes", i, topic))
+			}
+			set = append(set, common.BytesToHash(data))
+		}
+		query.Topics = append(query.Topics, set)
+	}
+
+	return query, resolver, nil
+}
+
+func parseLogPaging(params *GetEvmLogsRequestParams) (uint64, int, error) {
+	chunk := uint64(defaultLogBlockChunk)
+	if params.BlockChunk != "" {
+		n, err := strconv.ParseUint(params.BlockChunk, 10, 64)
+		if err != nil || n == 0 {
+			return 0, 0, utils.ErrMalformedRequest(fmt.Sprintf("invalid block-chunk %q", params.BlockChunk))
+		}
+		chunk = n
+	}
+
+	limit := defaultLogLimit
+	if params.Limit != "" {
+		n, err := strconv.Atoi(params.Limit)
+		if err != nil || n <= 0 {
+			return 0, 0, utils.ErrMalformedRequest(fmt.Sprintf("invalid limit %q", params.Limit))
+		}
+		limit = n
+	}
+	if limit > maxLogLimit {
+		limit = maxLogLimit
+	}
+
+	return chunk, limit, nil
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// logsNode serves eth_getLogs from logs and fails ranges wider than
+// maxRange blocks, like providers capping eth_getLogs.
+func logsNode(t *testing.T, logs []types.Log, maxRange uint64) *ethclient.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params []struct {
+				FromBlock hexutil.Uint64 `json:"fromBlock"`
+				ToBlock   hexutil.Uint64 `json:"toBlock"`
+			} `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Method != "eth_getLogs" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		from, to := uint64(request.Params[0].FromBlock), uint64(request.Params[0].ToBlock)
+		response := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+		if to-from+1 > maxRange {
+			response["error"] = map[string]interface{}{"code": -32005, "message": "block range too large"}
+		} else {
+			matched := []types.Log{}
+			for _, log := range logs {
+				if log.BlockNumber >= from && log.BlockNumber <= to {
+					matched = append(matched, log)
+				}
+			}
+			response["result"] = matched
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := ethclient.Dial(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+func TestFilterLogsChunked(t *testing.T) {
+	var logs []types.Log
+	for _, position := range []LogCursor{{10, 0}, {10, 1}, {10, 2}, {11, 0}, {11, 1}, {13, 0}} {
+		logs = append(logs, types.Log{
+			Address:     common.HexToAddress("0x0000000000000000000000000000000000000001"),
+			Topics:      []common.Hash{},
+			Data:        []byte{},
+			BlockNumber: position.Block,
+			Index:       position.LogIndex,
+		})
+	}
+
+	tests := []struct {
+		name     string
+		maxRange uint64
+		chunk    uint64
+		limit    int
+		pages    [][]string // cursors of the logs of every page, in order
+		cursors  []string   // next-cursor of every page but the last
+	}{
+		{
+			name:     "pages end inside a block",
+			maxRange: 100,
+			chunk:    100,
+			limit:    2,
+			pages:    [][]string{{"10", "10:1"}, {"10:2", "11"}, {"11:1", "13"}},
+			cursors:  []string{"10:2", "11:1"},
+		},
+		{
+			name:     "a page ends with its window",
+			maxRange: 100,
+			chunk:    1,
+			limit:    3,
+			pages:    [][]string{{"10", "10:1", "10:2"}, {"11", "11:1", "13"}},
+			cursors:  []string{"11"},
+		},
+		{
+			name:     "failing windows are halved",
+			maxRange: 1,
+			chunk:    4,
+			limit:    4,
+			pages:    [][]string{{"10", "10:1", "10:2", "11"}, {"11:1", "13"}},
+			cursors:  []string{"11:1"},
+		},
+		{
+			name:     "one page",
+			maxRange: 100,
+			chunk:    2,
+			limit:    10,
+			pages:    [][]string{{"10", "10:1", "10:2", "11", "11:1", "13"}},
+		},
+	}
+	for _, tt := range tests {
+		client := logsNode(t, logs, tt.maxRange)
+		from := LogCursor{Block: 10}
+		var pages [][]string
+		var cursors []string
+		for len(pages) <= len(tt.pages) {
+			page, next, err := FilterLogsChunked(client, ethereum.FilterQuery{}, from, 13, tt.chunk, tt.limit)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			var positions []string
+			for _, log := range page {
+				positions = append(positions, LogCursor{Block: log.BlockNumber, LogIndex: log.Index}.String())
+			}
+			pages = append(pages, positions)
+			if next == nil {
+				break
+			}
+			cursors = append(cursors, next.String())
+			from = *next
+		}
+		if !reflect.DeepEqual(pages, tt.pages) || !reflect.DeepEqual(cursors, tt.cursors) {
+			t.Errorf("%s: pages %v with cursors %v, want %v with %v", tt.name, pages, cursors, tt.pages, tt.cursors)
+		}
+	}
+}
@@ -1,33 +1,465 @@
 package handler
 
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// BlockInfo is the block a read was served from, echoed so the result can be
+// reproduced by passing the hash back as block.
+type BlockInfo struct {
+	Number    uint64 `json:"number"`
+	Hash      string `json:"hash"`
+	Timestamp uint64 `json:"timestamp"`
+	Tag       string `json:"tag,omitempty"`
+}
+
 type GetEvmContractExtCodeSizeRequestResponse struct {
-	ChainId string `json:"chain-id"`
-	Address string `json:"contract-address"`
-	Size    string `json:"contract-size"`
+	ChainId string     `json:"chain-id"`
+	Address string     `json:"contract-address"`
+	Size    string     `json:"contract-size"`
+	Block   *BlockInfo `json:"block,omitempty"`
 }
 
 type GetEvmContractCodeRequestResponse struct {
-	ChainId string `json:"chain-id"`
-	Address string `json:"contract-address"`
-	Size    string `json:"contract-size"`
-	Code    string `json:"contract-code"`
+	ChainId string     `json:"chain-id"`
+	Address string     `json:"contract-address"`
+	Size    string     `json:"contract-size"`
+	Code    string     `json:"contract-code"`
+	Block   *BlockInfo `json:"block,omitempty"`
 }
 
 type GetEvmContractDataAtMemoryRequestResponse struct {
-	ChainId string `json:"chain-id"`
-	Address string `json:"contract-address"`
-	Bytes   string `json:"bytes"`
+	ChainId  string        `json:"chain-id"`
+	Address  string        `json:"contract-address"`
+	Bytes    string        `json:"bytes,omitempty"`
+	Variable string        `json:"variable,omitempty"` // with a storage layout
+	Type     string        `json:"type,omitempty"`
+	Slot     string        `json:"slot,omitempty"`
+	Offset   *int          `json:"offset,omitempty"`
+	Value    interface{}   `json:"value,omitempty"`
+	Values   *StorageWords `json:"values,omitempty"` // with slots or a range
+	Block    *BlockInfo    `json:"block,omitempty"`
+}
+
+// StorageWord is the value of one storage slot.
+type StorageWord struct {
+	Slot  string
+	Value string
+}
+
+// StorageWords marshals as a JSON object of slot to value that keeps the
+// order the slots were asked for.
+type StorageWords []StorageWord
+
+func (w StorageWords) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, word := range w {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(word.Slot)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(word.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
 }
 
 type GetEvmContractCallViewRequestResponse struct {
-	ChainId    string `json:"chain-id"`
-	Address    string `json:"contract-address"`
-	MethodName string `json:"method-name"`
-	Response   string `json:"response"`
+	ChainId    string                 `json:"chain-id"`
+	Address    string                 `json:"contract-address"`
+	MethodName string                 `json:"method-name"`
+	Response   string                 `json:"response"`
+	Decoded    []interface{}          `json:"decoded,omitempty"`
+	Signature  string                 `json:"signature,omitempty"`
+	Outputs    map[string]interface{} `json:"outputs,omitempty"`
+	Block      *BlockInfo             `json:"block,omitempty"`
+	Trace      *CallFrame             `json:"trace,omitempty"`
+	Fork       *ForkInfo              `json:"fork,omitempty"`
+	Proxy      *ProxyInfo             `json:"proxy,omitempty"`
+}
+
+// ProxyInfo tells which implementation's ABI a proxied call was decoded with.
+type ProxyInfo struct {
+	Implementation string `json:"implementation"`
+	AbiName        string `json:"abi-name"`
+	Heuristic      bool   `json:"heuristic,omitempty"` // a hop came from the implementation() getter
 }
 
 type GetEvmContractBalanceRequestResponse struct {
-	ChainId string `query:"chain-id"`
-	Address string `query:"address"`
-	Balance string `query:"balance"`
+	ChainId string     `query:"chain-id"`
+	Address string     `query:"address"`
+	Balance string     `query:"balance"`
+	Block   *BlockInfo `json:"block,omitempty"`
+}
+
+type ContractAbiBinding struct {
+	ChainId string `json:"chain-id"`
+	Address string `json:"contract-address"`
+}
+
+type ContractAbiInfo struct {
+	Name          string               `json:"abi-name"`
+	Functions     []string             `json:"functions"`
+	Events        []string             `json:"events"`
+	Bindings      []ContractAbiBinding `json:"bindings"`
+	StorageLayout bool                 `json:"storage-layout,omitempty"` // registered with one
+}
+
+type GetContractAbisRequestResponse struct {
+	Abis []ContractAbiInfo `json:"abis"`
+}
+
+type RegisterContractAbiRequestResponse struct {
+	AbiName  string               `json:"abi-name"`
+	Bindings []ContractAbiBinding `json:"bindings"`
+}
+
+type DecodeCalldataRequestResponse struct {
+	Selector   string                 `json:"selector"`
+	Function   string                 `json:"function"`
+	Signature  string                 `json:"signature"`
+	Args       []interface{}          `json:"args"`
+	NamedArgs  map[string]interface{} `json:"named-args"`
+	Source     string                 `json:"source"`
+	Candidates []string               `json:"candidates,omitempty"`
+}
+
+type DecodeReturnRequestResponse struct {
+	Types   []string               `json:"types"`
+	Decoded []interface{}          `json:"decoded"`
+	Outputs map[string]interface{} `json:"outputs"`
+}
+
+type LookupSelectorRequestResponse struct {
+	Selector string            `json:"selector"`
+	Matches  []*SignatureEntry `json:"matches"`
+}
+
+type LookupTopicRequestResponse struct {
+	Topic   string            `json:"topic"`
+	Matches []*SignatureEntry `json:"matches"`
+}
+
+type EvmLog struct {
+	Address     string                 `json:"address"`
+	BlockNumber uint64                 `json:"block-number"`
+	BlockHash   string                 `json:"block-hash"`
+	TxHash      string                 `json:"tx-hash"`
+	TxIndex     uint                   `json:"tx-index"`
+	LogIndex    uint                   `json:"log-index"`
+	Removed     bool                   `json:"removed"`
+	Topics      []string               `json:"topics"`
+	Data        string                 `json:"data"`
+	Event       string                 `json:"event,omitempty"`
+	Signature   string                 `json:"signature,omitempty"`
+	Indexed     map[string]interface{} `json:"indexed,omitempty"`
+	Args        map[string]interface{} `json:"args,omitempty"`
+}
+
+type GetEvmLogsRequestResponse struct {
+	ChainId    string   `json:"chain-id"`
+	FromBlock  uint64   `json:"from-block"`
+	ToBlock    uint64   `json:"to-block"`
+	Logs       []EvmLog `json:"logs"`
+	NextCursor string   `json:"next-cursor,omitempty"`
+}
+
+type MulticallResult struct {
+	Address   string                 `json:"address"`
+	Signature string                 `json:"signature"`
+	Success   bool                   `json:"success"`
+	Response  string                 `json:"response"`
+	Decoded   []interface{}          `json:"decoded,omitempty"`
+	Outputs   map[string]interface{} `json:"outputs,omitempty"`
+	Revert    *Revert                `json:"revert,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+}
+
+type GetEvmMulticallRequestResponse struct {
+	ChainId    string            `json:"chain-id"`
+	Via        string            `json:"via"` // multicall3 or batch
+	Multicall3 string            `json:"multicall3,omitempty"`
+	Results    []MulticallResult `json:"results"`
+	Block      *BlockInfo        `json:"block,omitempty"`
+}
+
+type BatchResult struct {
+	Query  string      `json:"query"`
+	Status int         `json:"status"`
+	Result interface{} `json:"result,omitempty"`
+	Error  interface{} `json:"error,omitempty"`
+}
+
+type SimulationFee struct {
+	BaseFee     string `json:"base-fee,omitempty"`
+	PriorityFee string `json:"priority-fee,omitempty"`
+	GasPrice    string `json:"gas-price"`
+	Gas         uint64 `json:"gas"`
+	Fee         string `json:"fee"`        // wei
+	FeeNative   string `json:"fee-native"` // in the chain's native unit
+}
+
+type GetEvmSimulateRequestResponse struct {
+	ChainId                   string                 `json:"chain-id"`
+	From                      string                 `json:"from"`
+	To                        string                 `json:"to,omitempty"`
+	Signature                 string                 `json:"signature,omitempty"`
+	Success                   bool                   `json:"success"`
+	ReturnData                string                 `json:"return-data"`
+	Decoded                   []interface{}          `json:"decoded,omitempty"`
+	Outputs                   map[string]interface{} `json:"outputs,omitempty"`
+	Revert                    *Revert                `json:"revert,omitempty"`
+	GasEstimate               uint64                 `json:"gas-estimate,omitempty"`
+	AccessList                types.AccessList       `json:"access-list,omitempty"`
+	AccessListGasUsed         uint64                 `json:"access-list-gas-used,omitempty"`
+	GasEstimateWithAccessList uint64                 `json:"gas-estimate-with-access-list,omitempty"`
+	GasSaved                  int64                  `json:"gas-saved"`
+	Fee                       *SimulationFee         `json:"fee,omitempty"`
+	Errors                    map[string]string      `json:"errors,omitempty"` // steps the node could not run
+	Block                     *BlockInfo             `json:"block,omitempty"`
+	Trace                     *CallFrame             `json:"trace,omitempty"`
+}
+
+// CallFrame is one call of a traced call tree, decoded where the function is
+// known.
+type CallFrame struct {
+	Type      string                 `json:"type"` // CALL, STATICCALL, DELEGATECALL, CREATE...
+	From      string                 `json:"from"`
+	To        string                 `json:"to,omitempty"`
+	Value     string                 `json:"value,omitempty"` // wei
+	Gas       uint64                 `json:"gas"`
+	GasUsed   uint64                 `json:"gas-used"`
+	Input     string                 `json:"input"`
+	Output    string                 `json:"output,omitempty"`
+	Function  string                 `json:"function,omitempty"`
+	Signature string                 `json:"signature,omitempty"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+	Outputs   map[string]interface{} `json:"outputs,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	Revert    *Revert                `json:"revert,omitempty"`
+	Calls     []*CallFrame           `json:"calls,omitempty"`
+}
+
+// ForkInfo reports a call run in-process on the fork of a remote state.
+type ForkInfo struct {
+	GasUsed        uint64       `json:"gas-used"`
+	AccountsRead   int          `json:"accounts-read"` // fetched from the node
+	SlotsRead      int          `json:"slots-read"`
+	Steps          []OpcodeStep `json:"steps,omitempty"`
+	StepsTruncated bool         `json:"steps-truncated,omitempty"`
+}
+
+type OpcodeStep struct {
+	Pc      uint64   `json:"pc"`
+	Op      string   `json:"op"`
+	Gas     uint64   `json:"gas"`
+	GasCost uint64   `json:"gas-cost"`
+	Depth   int      `json:"depth"`
+	Stack   []string `json:"stack"` // bottom first
+	Error   string   `json:"error,omitempty"`
+}
+
+type EvmAuthorization struct {
+	ChainId   string `json:"chain-id"`
+	Address   string `json:"address"` // delegate
+	Nonce     uint64 `json:"nonce"`
+	Authority string `json:"authority,omitempty"` // recovered signer
+}
+
+type EvmTransaction struct {
+	Hash                 string                         `json:"hash"`
+	Type                 uint64                         `json:"type"`
+	TypeName             string                         `json:"type-name,omitempty"`
+	From                 string                         `json:"from"`
+	FromRecovered        bool                           `json:"from-recovered"` // false when from is the node's
+	To                   string                         `json:"to,omitempty"`
+	Nonce                uint64                         `json:"nonce"`
+	Value                string                         `json:"value"`
+	Gas                  uint64                         `json:"gas"`
+	GasPrice             string                         `json:"gas-price,omitempty"`
+	MaxFeePerGas         string                         `json:"max-fee-per-gas,omitempty"`
+	MaxPriorityFeePerGas string                         `json:"max-priority-fee-per-gas,omitempty"`
+	MaxFeePerBlobGas     string                         `json:"max-fee-per-blob-gas,omitempty"`
+	ChainId              string                         `json:"chain-id,omitempty"`
+	Input                string                         `json:"input"`
+	Decoded              *DecodeCalldataRequestResponse `json:"decoded,omitempty"`
+	AccessList           types.AccessList               `json:"access-list,omitempty"`
+	BlobHashes           []string                       `json:"blob-hashes,omitempty"`
+	Authorizations       []EvmAuthorization             `json:"authorizations,omitempty"`
+	BlockNumber          *uint64                        `json:"block-number,omitempty"`
+	BlockHash            string                         `json:"block-hash,omitempty"`
+	TxIndex              *uint64                        `json:"tx-index,omitempty"`
+}
+
+type EvmReceipt struct {
+	Status            *uint64  `json:"status,omitempty"` // 1 success, 0 failure; absent before Byzantium
+	GasUsed           uint64   `json:"gas-used"`
+	CumulativeGasUsed uint64   `json:"cumulative-gas-used"`
+	EffectiveGasPrice string   `json:"effective-gas-price,omitempty"`
+	Fee               string   `json:"fee,omitempty"`        // wei
+	FeeNative         string   `json:"fee-native,omitempty"` // in the chain's native unit
+	BlobGasUsed       uint64   `json:"blob-gas-used,omitempty"`
+	BlobGasPrice      string   `json:"blob-gas-price,omitempty"`
+	ContractAddress   string   `json:"contract-address,omitempty"`
+	Logs              []EvmLog `json:"logs"`
+}
+
+type GetEvmTransactionRequestResponse struct {
+	ChainId     string          `json:"chain-id"`
+	Pending     bool            `json:"pending"`
+	Transaction *EvmTransaction `json:"transaction"`
+	Receipt     *EvmReceipt     `json:"receipt,omitempty"`
+}
+
+type EvmBlockTransaction struct {
+	Hash     string          `json:"hash"`
+	Index    uint64          `json:"index"`
+	Type     uint64          `json:"type"`
+	From     string          `json:"from"`
+	To       string          `json:"to,omitempty"`
+	Nonce    uint64          `json:"nonce"`
+	Value    string          `json:"value"`
+	Gas      uint64          `json:"gas"`
+	Selector string          `json:"selector,omitempty"`
+	Detail   *EvmTransaction `json:"detail,omitempty"` // with full=true
+	Receipt  *EvmReceipt     `json:"receipt,omitempty"`
+}
+
+type GetEvmBlockRequestResponse struct {
+	ChainId               string                `json:"chain-id"`
+	Number                uint64                `json:"number"`
+	Hash                  string                `json:"hash,omitempty"` // empty for pending
+	ParentHash            string                `json:"parent-hash"`
+	Timestamp             uint64                `json:"timestamp"`
+	Tag                   string                `json:"tag,omitempty"`
+	SearchTimestamp       *uint64               `json:"search-timestamp,omitempty"`
+	Miner                 string                `json:"miner,omitempty"`
+	GasUsed               uint64                `json:"gas-used"`
+	GasLimit              uint64                `json:"gas-limit"`
+	BaseFee               string                `json:"base-fee,omitempty"`
+	BlobGasUsed           *uint64               `json:"blob-gas-used,omitempty"`
+	ExcessBlobGas         *uint64               `json:"excess-blob-gas,omitempty"`
+	WithdrawalsRoot       string                `json:"withdrawals-root,omitempty"`
+	WithdrawalCount       *int                  `json:"withdrawal-count,omitempty"`
+	ParentBeaconBlockRoot string                `json:"parent-beacon-block-root,omitempty"`
+	StateRoot             string                `json:"state-root"`
+	TransactionsRoot      string                `json:"transactions-root"`
+	ReceiptsRoot          string                `json:"receipts-root"`
+	ExtraData             string                `json:"extra-data"`
+	Size                  uint64                `json:"size,omitempty"`
+	TransactionCount      int                   `json:"transaction-count"`
+	Transactions          []EvmBlockTransaction `json:"transactions"`
+}
+
+type GetEvmAddressRequestResponse struct {
+	ChainId        string     `json:"chain-id"`
+	Address        string     `json:"address"`
+	Kind           string     `json:"kind"` // eoa, contract, minimal-proxy, delegated or precompile
+	Balance        string     `json:"balance"`
+	Nonce          uint64     `json:"nonce"`
+	CodeSize       int        `json:"code-size"`
+	CodeHash       string     `json:"code-hash"`
+	Implementation string     `json:"implementation,omitempty"` // of a minimal proxy
+	Delegate       string     `json:"delegate,omitempty"`       // of a delegated EOA
+	Precompile     string     `json:"precompile,omitempty"`
+	Block          *BlockInfo `json:"block,omitempty"`
+}
+
+// ProxyHop is one proxy on the way from a contract to its implementation.
+type ProxyHop struct {
+	Address        string `json:"address"`
+	Kind           string `json:"kind"`
+	Implementation string `json:"implementation"`
+	Admin          string `json:"admin,omitempty"`
+	Beacon         string `json:"beacon,omitempty"`
+	Heuristic      bool   `json:"heuristic,omitempty"` // only the implementation() getter pointed to it
+}
+
+type ResolveProxyRequestResponse struct {
+	ChainId        string     `json:"chain-id"`
+	Address        string     `json:"contract-address"`
+	Proxy          bool       `json:"proxy"`
+	Implementation string     `json:"implementation,omitempty"` // the last hop's
+	Hops           []ProxyHop `json:"hops"`
+	Heuristic      bool       `json:"heuristic,omitempty"` // a hop came from the implementation() getter
+	AbiName        string     `json:"abi-name,omitempty"`  // registered for the implementation
+	Block          *BlockInfo `json:"block,omitempty"`
+}
+
+// StorageSlotStep is the slot reached after one step of storage-slot.
+type StorageSlotStep struct {
+	Step   string `json:"step"`
+	Slot   string `json:"slot"`
+	Offset int    `json:"offset,omitempty"` // of a packed array element
+}
+
+type GetStorageSlotRequestResponse struct {
+	ChainId   string            `json:"chain-id,omitempty"`
+	Address   string            `json:"contract-address,omitempty"`
+	Namespace string            `json:"namespace,omitempty"`
+	BaseSlot  string            `json:"base-slot"`
+	Steps     []StorageSlotStep `json:"steps"`
+	Slot      string            `json:"slot"`
+	Offset    int               `json:"offset,omitempty"`
+	Value     string            `json:"value,omitempty"` // with read=true
+	Block     *BlockInfo        `json:"block,omitempty"`
+}
+
+// StorageDumpEntry is a non-zero slot of storage-dump under its trie key,
+// the keccak256 hash of the slot.
+type StorageDumpEntry struct {
+	Key    string   `json:"key"`
+	Slot   string   `json:"slot,omitempty"` // when the node or the layout knows it
+	Value  string   `json:"value"`
+	Labels []string `json:"labels,omitempty"` // with a storage layout
+}
+
+type GetStorageDumpRequestResponse struct {
+	ChainId string             `json:"chain-id"`
+	Address string             `json:"contract-address"`
+	Storage []StorageDumpEntry `json:"storage"`
+	NextKey string             `json:"next-key,omitempty"`
+	Block   *BlockInfo         `json:"block"`
+}
+
+// ValueChange is an account field storage-diff found changed.
+type ValueChange struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// StorageChange is a slot whose value differs between the two blocks of
+// storage-diff.
+type StorageChange struct {
+	Key    string   `json:"key,omitempty"`  // trie key, from debug_storageRangeAt
+	Slot   string   `json:"slot,omitempty"` // when the node or the layout knows it
+	Before string   `json:"before"`
+	After  string   `json:"after"`
+	Labels []string `json:"labels,omitempty"` // with a storage layout
+}
+
+type GetStorageDiffRequestResponse struct {
+	ChainId       string          `json:"chain-id"`
+	Address       string          `json:"contract-address"`
+	FromBlock     *BlockInfo      `json:"from-block"`
+	ToBlock       *BlockInfo      `json:"to-block"`
+	Source        string          `json:"source"` // debug_storageRangeAt, slots or storage-layout
+	SlotsCompared int             `json:"slots-compared"`
+	Storage       []StorageChange `json:"storage"`
+	Balance       *ValueChange    `json:"balance,omitempty"` // only when changed
+	Nonce         *ValueChange    `json:"nonce,omitempty"`
+	CodeHash      *ValueChange    `json:"code-hash,omitempty"`
 }
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	utils "generic-evm-api-go/api/pkg/utils"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	maxMulticallCalls  = 500
+	multicallBatchSize = 100 // eth_call requests per JSON-RPC batch
+)
+
+var multicall3TryAggregate, _ = ParseFunctionSignature(
+	"tryAggregate(bool requireSuccess, (address target, bytes callData)[] calls) returns ((bool success, bytes returnData)[] returnData)",
+)
+
+// PreparedCall is an encoded call of a multicall.
+type PreparedCall struct {
+	Target    common.Address
+	Signature *FunctionSignature
+	CallData  []byte
+}
+
+// CallResult is the raw outcome of one call. Err is set when the node failed
+// the call for a reason other than a revert.
+type CallResult struct {
+	Success    bool
+	ReturnData []byte
+	Err        error
+}
+
+// PrepareCalls parses the signature and encodes the arguments of each call.
+func PrepareCalls(calls []MulticallCall) ([]PreparedCall, error) {
+	if len(calls) == 0 {
+		return nil, utils.ErrMalformedRequest("no calls given")
+	}
+	if len(calls) > maxMulticallCalls {
+		return nil, utils.ErrMalformedRequest(fmt.Sprintf("at most %d calls are allowed, got %d", maxMulticallCalls, len(calls)))
+	}
+
+	prepared := make([]PreparedCall, 0, len(calls))
+	for i, call := range calls {
+		if !common.IsHexAddress(call.Address) {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("calls[%d]: address %q is not hex", i, call.Address))
+		}
+		signature, err := ParseFunctionSignature(call.Signature)
+		if err != nil {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("calls[%d]: %v", i, err))
+		}
+		callData, err := signature.EncodeCall(call.Args)
+		if err != nil {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("calls[%d]: %v", i, err))
+		}
+		prepared = append(prepared, PreparedCall{
+			Target:    common.HexToAddress(call.Address),
+			Signature: signature,
+			CallData:  callData,
+		})
+	}
+	return prepared, nil
+}
+
+// TryAggregate runs calls in a single eth_call through Multicall3's
+// tryAggregate(false, ...), so a failing call only marks its own result.
+func TryAggregate(client *ethclient.Client, multicall common.Address, calls []PreparedCall, block *BlockRef) ([]CallResult, error) {
+	type aggregateCall struct {
+		Target   common.Address
+		CallData []byte
+	}
+	type aggregateResult struct {
+		Success    bool
+		ReturnData []byte
+	}
+
+	aggregateCalls := make([]aggregateCall, 0, len(calls))
+	for _, call := range calls {
+		aggregateCalls = append(aggregateCalls, aggregateCall{Target: call.Target, CallData: call.CallData})
+	}
+
+	method := multicall3TryAggregate.Method()
+	input, err := method.Inputs.Pack(false, aggregateCalls)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode tryAggregate: %v", err)
+	}
+
+	output, err := CallContractData(client, multicall, append(method.ID, input...), block)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := method.Outputs.Unpack(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode tryAggregate result: %v", err)
+	}
+	aggregateResults := *abi.ConvertType(values[0], new([]aggregateResult)).(*[]aggregateResult)
+	if len(aggregateResults) != len(calls) {
+		return nil, fmt.Errorf("tryAggregate returned %d results for %d calls", len(aggregateResults), len(calls))
+	}
+
+	results := make([]CallResult, 0, len(calls))
+	for _, result := range aggregateResults {
+		results = append(results, CallResult{Success: result.Success, ReturnData: result.ReturnData})
+	}
+	return results, nil
+}
+
+// BatchCalls sends every call as its own eth_call in JSON-RPC batches, for
+// chains without Multicall3.
+func BatchCalls(client *ethclient.Client, calls []PreparedCall, block *BlockRef) ([]CallResult, error) {
+	results := make([]CallResult, len(calls))
+	returnData := make([]hexutil.Bytes, len(calls))
+
+	for start := 0; start < len(calls); start += multicallBatchSize {
+		end := start + multicallBatchSize
+		if end > len(calls) {
+			end = len(calls)
+		}
+
+		batch := make([]rpc.BatchElem, 0, end-start)
+		for i := start; i < end; i++ {
+			msg := map[string]interface{}{
+				"to":   calls[i].Target,
+				"data": hexutil.Bytes(calls[i].CallData),
+			}
+			batch = append(batch, rpc.BatchElem{
+				Method: "eth_call",
+				Args:   []interface{}{msg, block.rpcArg()},
+				Result: &returnData[i],
+			})
+		}
+
+		if err := client.Client().BatchCallContext(context.Background(), batch); err != nil {
+			return nil, fmt.Errorf("batch eth_call failed: %v", err)
+		}
+
+		for j, elem := range batch {
+			i := start + j
+			if elem.Error == nil {
+				results[i] = CallResult{Success: true, ReturnData: returnData[i]}
+				continue
+			}
+			if data, ok := revertData(elem.Error); ok {
+				results[i] = CallResult{ReturnData: data}
+				continue
+			}
+			results[i] = CallResult{Err: elem.Error}
+		}
+	}
+	return results, nil
+}
+
+// multicallDeployed reports whether Multicall3 has code at block.
+func multicallDeployed(client *ethclient.Client, multicall common.Address, block *BlockRef) (bool, error) {
+	code, err := codeAtBlock(client, multicall, block)
+	if err != nil {
+		return false, fmt.Errorf("get Multicall3 code failed: %v", err)
+	}
+	return len(code) > 0, nil
+}
+
+// FormatCallResult decodes a successful return value with the call's outputs
+// and a failed one as revert data.
+func FormatCallResult(call PreparedCall, result CallResult) MulticallResult {
+	formatted := MulticallResult{
+		Address:   call.Target.Hex(),
+		Signature: call.Signature.Signature(),
+		Success:   result.Success,
+		Response:  hexutil.Encode(result.ReturnData),
+	}
+
+	switch {
+	case result.Err != nil:
+		formatted.Error = result.Err.Error()
+	case !result.Success:
+		formatted.Revert = DecodeRevert(result.ReturnData, nil)
+	case len(call.Signature.Outputs) > 0:
+		decoded, err := DecodeAbiValues(call.Signature.Outputs, result.ReturnData)
+		if err != nil {
+			formatted.Error = err.Error()
+			break
+		}
+		formatted.Decoded = decoded
+		formatted.Outputs = NamedAbiValues(call.Signature.Outputs, decoded)
+	}
+	return formatted
+}
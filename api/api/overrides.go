@@ -0,0 +1,246 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	utils "generic-evm-api-go/api/pkg/utils"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// CallOptions is the caller context of an eth_call and the state override
+// set sent as its third parameter.
+type CallOptions struct {
+	From      *common.Address
+	Value     *big.Int
+	Gas       uint64
+	GasPrice  *big.Int
+	Overrides map[common.Address]OverrideAccount
+}
+
+// OverrideAccount replaces parts of an account for the duration of a call.
+// State replaces the whole storage, StateDiff only the slots it names.
+type OverrideAccount struct {
+	Balance   *hexutil.Big                `json:"balance,omitempty"`
+	Nonce     *hexutil.Uint64             `json:"nonce,omitempty"`
+	Code      *hexutil.Bytes              `json:"code,omitempty"`
+	State     map[common.Hash]common.Hash `json:"state,omitempty"`
+	StateDiff map[common.Hash]common.Hash `json:"stateDiff,omitempty"`
+}
+
+// stateOverrideInput is an override as a request gives it: numbers may be
+// decimal or hex, slots and values numbers or 32-byte hex.
+type stateOverrideInput struct {
+	Balance   interface{}            `json:"balance"`
+	Nonce     interface{}            `json:"nonce"`
+	Code      *string                `json:"code"`
+	State     map[string]interface{} `json:"state"`
+	StateDiff map[string]interface{} `json:"stateDiff"`
+}
+
+// ParseCallOptions reads from, value, gas and gas-price and the override set,
+// a JSON object keyed by address. It returns nil when none is given.
+func ParseCallOptions(from, value, gas, gasPrice string, overrides json.RawMessage) (*CallOptions, error) {
+	opts := &CallOptions{}
+	given := false
+
+	if from != "" {
+		if !common.IsHexAddress(from) {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("from %q is not hex", from))
+		}
+		address := common.HexToAddress(from)
+		opts.From, given = &address, true
+	}
+	if value != "" {
+		n, err := parseUintParam("value", value)
+		if err != nil {
+			return nil, err
+		}
+		opts.Value, given = n, true
+	}
+	if gas != "" {
+		n, err := parseUintParam("gas", gas)
+		if err != nil {
+			return nil, err
+		}
+		if !n.IsUint64() {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("gas %q out of range", gas))
+		}
+		opts.Gas, given = n.Uint64(), true
+	}
+	if gasPrice != "" {
+		n, err := parseUintParam("gas-price", gasPrice)
+		if err != nil {
+			return nil, err
+		}
+		opts.GasPrice, given = n, true
+	}
+
+	if len(overrides) > 0 {
+		parsed, err := parseStateOverrides(overrides)
+		if err != nil {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("overrides: %v", err))
+		}
+		opts.Overrides, given = parsed, true
+	}
+
+	if !given {
+		return nil, nil
+	}
+	return opts, nil
+}
+
+func parseStateOverrides(data json.RawMessage) (map[common.Address]OverrideAccount, error) {
+	var inputs map[string]stateOverrideInput
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&inputs); err != nil {
+		return nil, fmt.Errorf("must be a JSON object keyed by address: %v", err)
+	}
+
+	overrides := make(map[common.Address]OverrideAccount, len(inputs))
+	for address, input := range inputs {
+		if !common.IsHexAddress(address) {
+			return nil, fmt.Errorf("%q is not an address", address)
+		}
+		if input.State != nil && input.StateDiff != nil {
+			return nil, fmt.Errorf("%s: state and stateDiff are exclusive", address)
+		}
+
+		var account OverrideAccount
+		if input.Balance != nil {
+			balance, err := parseBigInt(input.Balance)
+			if err != nil || balance.Sign() < 0 || balance.Cmp(abi.MaxUint256) > 0 {
+				return nil, fmt.Errorf("%s: invalid balance %v", address, input.Balance)
+			}
+			account.Balance = (*hexutil.Big)(balance)
+		}
+		if input.Nonce != nil {
+			nonce, err := parseBigInt(input.Nonce)
+			if err != nil || nonce.Sign() < 0 || !nonce.IsUint64() {
+				return nil, fmt.Errorf("%s: invalid nonce %v", address, input.Nonce)
+			}
+			accountNonce := hexutil.Uint64(nonce.Uint64())
+			account.Nonce = &accountNonce
+		}
+		if input.Code != nil {
+			code, err := hexutil.Decode(*input.Code)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid code: %v", address, err)
+			}
+			accountCode := hexutil.Bytes(code)
+			account.Code = &accountCode
+		}
+
+		var err error
+		if account.State, err = parseStorageOverride(input.State); err != nil {
+			return nil, fmt.Errorf("%s: state: %v", address, err)
+		}
+		if account.StateDiff, err = parseStorageOverride(input.StateDiff); err != nil {
+			return nil, fmt.Errorf("%s: stateDiff: %v", address, err)
+		}
+
+		overrides[common.HexToAddress(address)] = account
+	}
+	return overrides, nil
+}
+
+func parseStorageOverride(slots map[string]interface{}) (map[common.Hash]common.Hash, error) {
+	if slots == nil {
+		return nil, nil
+	}
+
+	storage := make(map[common.Hash]common.Hash, len(slots))
+	for slot, value := range slots {
+		key, err := parseStorageWord(slot)
+		if err != nil {
+			return nil, fmt.Errorf("slot %q: %v", slot, err)
+		}
+		word, err := parseStorageWord(value)
+		if err != nil {
+			return nil, fmt.Errorf("slot %q: value %v: %v", slot, value, err)
+		}
+		storage[key] = word
+	}
+	return storage, nil
+}
+
+// parseStorageWord parses a storage slot or value given as a number or as
+// 32 bytes of hex.
+func parseStorageWord(value interface{}) (common.Hash, error) {
+	n, err := parseBigInt(value)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if n.Sign() < 0 || n.BitLen() > 256 {
+		return common.Hash{}, fmt.Errorf("out of range for a storage word")
+	}
+	return common.BigToHash(n), nil
+}
+
+func parseUintParam(name string, value string) (*big.Int, error) {
+	n, err := parseBigInt(value)
+	if err != nil || n.Sign() < 0 {
+		return nil, utils.ErrMalformedRequest(fmt.Sprintf("invalid %s %q", name, value))
+	}
+	return n, nil
+}
+
+// CallContractWithOptions runs eth_call with the caller context and state
+// overrides of opts. ethclient has no override parameter, so the call is made
+// on the raw RPC client.
+func CallContractWithOptions(client *ethclient.Client, contractAddress common.Address, callData []byte, block *BlockRef, opts *CallOptions) ([]byte, error) {
+	if opts == nil {
+		return CallContractData(client, contractAddress, callData, block)
+	}
+
+	args := []interface{}{opts.callArg(contractAddress, callData), block.rpcArg()}
+	if len(opts.Overrides) > 0 {
+		args = append(args, opts.Overrides)
+	}
+
+	var result hexutil.Bytes
+	if err := client.Client().CallContext(context.Background(), &result, "eth_call", args...); err != nil {
+		return nil, fmt.Errorf("contract call failed: %w", err)
+	}
+	return result, nil
+}
+
+// callArg is the call object of a call to contractAddress under opts, which
+// may be nil.
+func (opts *CallOptions) callArg(contractAddress common.Address, callData []byte) map[string]interface{} {
+	arg := map[string]interface{}{
+		"to":   contractAddress,
+		"data": hexutil.Bytes(callData),
+	}
+	if opts == nil {
+		return arg
+	}
+	if opts.From != nil {
+		arg["from"] = opts.From
+	}
+	if opts.Value != nil {
+		arg["value"] = (*hexutil.Big)(opts.Value)
+	}
+	if opts.Gas != 0 {
+		arg["gas"] = hexutil.Uint64(opts.Gas)
+	}
+	if opts.GasPrice != nil {
+		arg["gasPrice"] = (*hexutil.Big)(opts.GasPrice)
+	}
+	return arg
+}
+
+func (opts *CallOptions) stateOverrides() map[common.Address]OverrideAccount {
+	if opts == nil {
+		return nil
+	}
+	return opts.Overrides
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	utils "generic-evm-api-go/api/pkg/utils"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestParseCallOptionsBalance(t *testing.T) {
+	account := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	tests := []struct {
+		balance string
+		want    string
+		wantErr bool
+	}{
+		{balance: `"0x0"`, want: "0"},
+		{balance: `1000000000000000000`, want: "1000000000000000000"},
+		{balance: `"0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"`, want: abi.MaxUint256.String()},
+		{balance: `"0x10000000000000000000000000000000000000000000000000000000000000000"`, wantErr: true},
+		{balance: `-1`, wantErr: true},
+	}
+	for _, tt := range tests {
+		overrides := json.RawMessage(`{"` + account.Hex() + `": {"balance": ` + tt.balance + `}}`)
+		opts, err := ParseCallOptions("", "", "", "", overrides)
+		if tt.wantErr {
+			var apiErr utils.Error
+			if !errors.As(err, &apiErr) || apiErr.Code != 400 || !strings.Contains(apiErr.Details, "invalid balance") {
+				t.Errorf("balance %s: error = %v, want a 400", tt.balance, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("balance %s: %v", tt.balance, err)
+			continue
+		}
+		if got := opts.Overrides[account].Balance.ToInt().String(); got != tt.want {
+			t.Errorf("balance %s = %s, want %s", tt.balance, got, tt.want)
+		}
+	}
+}
@@ -1,24 +1,44 @@
 package handler
 
-import utils "generic-evm-api-go/api/pkg/utils"
+import (
+	"encoding/json"
+
+	utils "generic-evm-api-go/api/pkg/utils"
+)
 
 type GetEvmContractExtCodeSizeRequestParams struct {
 	ChainId string `query:"chain-id"`
 	JsonRpc string `query:"json-rpc" optional:"true"`
 	Address string `query:"contract-address"`
+	Block   string `query:"block" optional:"true"`
 }
 
 type GetEvmContractCodeRequestParams struct {
 	ChainId string `query:"chain-id"`
 	JsonRpc string `query:"json-rpc" optional:"true"`
 	Address string `query:"contract-address"`
+	Block   string `query:"block" optional:"true"`
 }
 
 type GetEvmContractDataAtMemoryRequestParams struct {
-	ChainId  string `query:"chain-id"`
-	JsonRpc  string `query:"json-rpc" optional:"true"`
-	Address  string `query:"contract-address"`
-	StorgeAt string `query:"storage-at"`
+	ChainId       string `query:"chain-id"`
+	JsonRpc       string `query:"json-rpc" optional:"true"`
+	Address       string `query:"contract-address"`
+	StorgeAt      string `query:"storage-at" optional:"true"`
+	Block         string `query:"block" optional:"true"`
+	Variable      string `query:"variable" optional:"true"`       // path like balances[0xabc] or config.fee
+	StorageLayout string `query:"storage-layout" optional:"true"` // solc storageLayout JSON
+	AbiName       string `query:"abi-name" optional:"true"`       // registered artifact with a storage layout
+	Slots         string `query:"slots" optional:"true"`          // slot list, repeated or one JSON array
+	Start         string `query:"start" optional:"true"`          // first slot of a range
+	Count         string `query:"count" optional:"true"`          // slots in the range
+	SkipZero      string `query:"skip-zero" optional:"true"`      // true to leave out zero slots
+}
+
+// GetEvmContractDataAtMemoryRequestBody is the optional POST body of
+// evm-contract-data-at-memory, used to send a storage layout.
+type GetEvmContractDataAtMemoryRequestBody struct {
+	StorageLayout json.RawMessage `json:"storage-layout"`
 }
 
 type Parameter struct {
@@ -27,15 +47,222 @@ type Parameter struct {
 }
 
 type GetEvmContractCallViewRequestParams struct {
-	ChainId      string            `query:"chain-id"`
-	JsonRpc      string            `query:"json-rpc" optional:"true"`
-	Address      string            `query:"contract-address"`
-	MethodName   string            `query:"method-name" optional:"true"`
-	MethodParams []utils.Parameter `query:"method-inputs" optional:"true"` // {type, data}
+	ChainId       string            `query:"chain-id"`
+	JsonRpc       string            `query:"json-rpc" optional:"true"`
+	Address       string            `query:"contract-address"`
+	MethodName    string            `query:"method-name" optional:"true"`
+	MethodParams  []utils.Parameter `query:"method-inputs" optional:"true"`  // {type, data}
+	MethodOutputs []utils.Parameter `query:"method-outputs" optional:"true"` // {type}
+	Abi           string            `query:"abi" optional:"true"`            // JSON ABI
+	AbiName       string            `query:"abi-name" optional:"true"`       // registered ABI
+	Block         string            `query:"block" optional:"true"`          // number, tag or hash
+	From          string            `query:"from" optional:"true"`
+	Value         string            `query:"value" optional:"true"` // wei
+	Gas           string            `query:"gas" optional:"true"`
+	GasPrice      string            `query:"gas-price" optional:"true"` // wei
+	Overrides     string            `query:"overrides" optional:"true"` // JSON state override set
+	Trace         string            `query:"trace" optional:"true"`     // true for the call tree, opcodes to add opcode steps
+	Execution     string            `query:"execution" optional:"true"` // node (default) or fork
+	Proxy         string            `query:"proxy" optional:"true"`     // true to use the ABI of the proxy's implementation
+}
+
+// GetEvmContractCallViewRequestBody is the optional POST body of
+// evm-contract-call-view, used to send a full contract ABI, JSON arguments
+// and a state override set.
+type GetEvmContractCallViewRequestBody struct {
+	Abi       json.RawMessage `json:"abi"`
+	Args      []interface{}   `json:"args"`
+	Overrides json.RawMessage `json:"overrides"`
 }
 
 type GetEvmContractBalanceRequestParams struct {
 	ChainId string `query:"chain-id"`
 	JsonRpc string `query:"json-rpc" optional:"true"`
 	Address string `query:"address"`
+	Block   string `query:"block" optional:"true"`
+}
+
+type GetContractAbisRequestParams struct {
+	ChainId string `query:"chain-id" optional:"true"`
+}
+
+type RegisterContractAbiRequestParams struct {
+	AbiName string `query:"abi-name"`
+	Abi     string `query:"abi" optional:"true"`
+	ChainId string `query:"chain-id" optional:"true"`
+	Address string `query:"contract-address" optional:"true"`
+}
+
+type RegisterContractAbiRequestBody struct {
+	Abi json.RawMessage `json:"abi"`
+}
+
+type BindContractAbiRequestParams struct {
+	ChainId string `query:"chain-id"`
+	Address string `query:"contract-address"`
+	AbiName string `query:"abi-name"`
+}
+
+type DecodeCalldataRequestParams struct {
+	Calldata  string `query:"calldata"`
+	Signature string `query:"signature" optional:"true"`
+	Abi       string `query:"abi" optional:"true"`
+	AbiName   string `query:"abi-name" optional:"true"`
+	ChainId   string `query:"chain-id" optional:"true"`
+	Address   string `query:"contract-address" optional:"true"`
+}
+
+type DecodeReturnRequestParams struct {
+	Data          string            `query:"data"`
+	Types         string            `query:"types" optional:"true"` // uint112,uint112,uint32
+	Signature     string            `query:"signature" optional:"true"`
+	MethodName    string            `query:"method-name" optional:"true"`
+	MethodOutputs []utils.Parameter `query:"method-outputs" optional:"true"` // {type}
+	Abi           string            `query:"abi" optional:"true"`
+	AbiName       string            `query:"abi-name" optional:"true"`
+	ChainId       string            `query:"chain-id" optional:"true"`
+	Address       string            `query:"contract-address" optional:"true"`
+}
+
+// DecodeRequestBody is the optional POST body of the decode queries, used to
+// send an ABI too large for the query string.
+type DecodeRequestBody struct {
+	Abi json.RawMessage `json:"abi"`
+}
+
+type LookupSelectorRequestParams struct {
+	Selector string `query:"selector"`
+}
+
+type LookupTopicRequestParams struct {
+	Topic string `query:"topic"`
+}
+
+type GetEvmLogsRequestParams struct {
+	ChainId    string    `query:"chain-id"`
+	Address    string    `query:"address" optional:"true"` // comma separated
+	FromBlock  string    `query:"from-block"`
+	ToBlock    string    `query:"to-block" optional:"true"`
+	Event      string    `query:"event" optional:"true"` // event declaration, sets topics[0]
+	Abi        string    `query:"abi" optional:"true"`
+	AbiName    string    `query:"abi-name" optional:"true"`
+	BlockChunk string    `query:"block-chunk" optional:"true"`
+	Limit      string    `query:"limit" optional:"true"`
+	Cursor     string    `query:"cursor" optional:"true"`
+	Topics     [4]string // topics[0..3], each a comma separated OR set
+}
+
+type GetEvmMulticallRequestParams struct {
+	ChainId    string `query:"chain-id"`
+	Block      string `query:"block" optional:"true"`
+	Multicall3 string `query:"multicall-address" optional:"true"` // overrides the chain's Multicall3
+}
+
+// MulticallCall is one call of an evm-multicall request. Signature is a
+// human-readable function signature whose outputs decode the return value.
+type MulticallCall struct {
+	Address   string        `json:"address"`
+	Signature string        `json:"signature"`
+	Args      []interface{} `json:"args"`
+}
+
+type GetEvmMulticallRequestBody struct {
+	Calls []MulticallCall `json:"calls"`
+}
+
+// BatchRequestItem is one query of a batch request. Params are the query
+// parameters of the query; arrays repeat the key, other non-string values are
+// sent as JSON. Body is the POST body for queries that take one.
+type BatchRequestItem struct {
+	Query  string                 `json:"query"`
+	Params map[string]interface{} `json:"params"`
+	Body   json.RawMessage        `json:"body,omitempty"`
+}
+
+type GetEvmSimulateRequestParams struct {
+	ChainId              string            `query:"chain-id"`
+	Block                string            `query:"block" optional:"true"`
+	From                 string            `query:"from" optional:"true"`
+	To                   string            `query:"to" optional:"true"` // empty deploys data as init code
+	Value                string            `query:"value" optional:"true"`
+	Data                 string            `query:"data" optional:"true"`
+	MethodName           string            `query:"method-name" optional:"true"` // signature, or a name with method-inputs
+	MethodParams         []utils.Parameter `query:"method-inputs" optional:"true"`
+	MethodOutputs        []utils.Parameter `query:"method-outputs" optional:"true"`
+	Gas                  string            `query:"gas" optional:"true"`
+	GasPrice             string            `query:"gas-price" optional:"true"`
+	MaxFeePerGas         string            `query:"max-fee-per-gas" optional:"true"`
+	MaxPriorityFeePerGas string            `query:"max-priority-fee-per-gas" optional:"true"`
+	Trace                string            `query:"trace" optional:"true"`
+}
+
+type GetEvmSimulateRequestBody struct {
+	Args []interface{} `json:"args"`
+}
+
+type GetEvmTransactionRequestParams struct {
+	ChainId string `query:"chain-id"`
+	Hash    string `query:"tx-hash"`
+}
+
+type GetEvmBlockRequestParams struct {
+	ChainId   string `query:"chain-id"`
+	Block     string `query:"block" optional:"true"`
+	Timestamp string `query:"timestamp" optional:"true"` // unix seconds, instead of block
+	Full      string `query:"full" optional:"true"`      // true for full transactions and receipts
+}
+
+type GetEvmAddressRequestParams struct {
+	ChainId string `query:"chain-id"`
+	Address string `query:"address"`
+	Block   string `query:"block" optional:"true"`
+}
+
+type ResolveProxyRequestParams struct {
+	ChainId    string `query:"chain-id"`
+	Address    string `query:"contract-address"`
+	Block      string `query:"block" optional:"true"`
+	ResolveAbi string `query:"resolve-abi" optional:"true"` // true to look up the implementation's registered ABI
+}
+
+type GetStorageSlotRequestParams struct {
+	Slot      string `query:"slot" optional:"true"`      // base slot, hex or decimal
+	Namespace string `query:"namespace" optional:"true"` // ERC-7201 namespace id instead of slot
+	Keys      string `query:"keys" optional:"true"`      // steps, repeated or one JSON array
+	Read      string `query:"read" optional:"true"`      // true to read the derived slot
+	ChainId   string `query:"chain-id" optional:"true"`
+	Address   string `query:"contract-address" optional:"true"`
+	Block     string `query:"block" optional:"true"`
+}
+
+type GetStorageDumpRequestParams struct {
+	ChainId       string `query:"chain-id"`
+	Address       string `query:"contract-address"`
+	Block         string `query:"block" optional:"true"`
+	StartKey      string `query:"start-key" optional:"true"`      // next-key of the previous page
+	Limit         string `query:"limit" optional:"true"`          // slots per page
+	StorageLayout string `query:"storage-layout" optional:"true"` // solc storageLayout JSON to label slots with
+	AbiName       string `query:"abi-name" optional:"true"`       // registered artifact with a storage layout
+}
+
+// GetStorageDumpRequestBody is the optional POST body of storage-dump, used
+// to send a storage layout.
+type GetStorageDumpRequestBody struct {
+	StorageLayout json.RawMessage `json:"storage-layout"`
+}
+
+type GetStorageDiffRequestParams struct {
+	ChainId       string `query:"chain-id"`
+	Address       string `query:"contract-address"`
+	FromBlock     string `query:"from-block"`
+	ToBlock       string `query:"to-block" optional:"true"`
+	Slots         string `query:"slots" optional:"true"`          // slots to compare without debug_storageRangeAt
+	StorageLayout string `query:"storage-layout" optional:"true"` // solc storageLayout JSON
+	AbiName       string `query:"abi-name" optional:"true"`       // registered artifact with a storage layout
+}
+
+// GetStorageDiffRequestBody is the optional POST body of storage-diff, used
+// to send a storage layout.
+type GetStorageDiffRequestBody struct {
+	StorageLayout json.RawMessage `json:"storage-layout"`
 }
@@ -0,0 +1,302 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// maxProxyHops bounds how many proxies in a row ResolveProxy follows
+const maxProxyHops = 8
+
+// Proxy kinds reported per hop by resolve-proxy
+const (
+	ProxyKindEIP1967       = "eip-1967"
+	ProxyKindEIP1967Beacon = "eip-1967-beacon"
+	ProxyKindEIP1822       = "eip-1822"
+	ProxyKindOZLegacy      = "oz-legacy"
+	ProxyKindGnosisSafe    = "gnosis-safe"
+	ProxyKindEIP1167       = "eip-1167"
+	ProxyKindEIP3448       = "eip-3448"
+	ProxyKindGetter        = "implementation-getter"
+)
+
+var (
+	// EIP-1967 slots are keccak256 of a label minus one
+	eip1967ImplementationSlot = eip1967Slot("eip1967.proxy.implementation")
+	eip1967AdminSlot          = eip1967Slot("eip1967.proxy.admin")
+	eip1967BeaconSlot         = eip1967Slot("eip1967.proxy.beacon")
+
+	eip1822ProxiableSlot = crypto.Keccak256Hash([]byte("PROXIABLE"))
+
+	// OpenZeppelin (zeppelinos) upgradeability proxies before EIP-1967
+	ozImplementationSlot = crypto.Keccak256Hash([]byte("org.zeppelinos.proxy.implementation"))
+	ozAdminSlot          = crypto.Keccak256Hash([]byte("org.zeppelinos.proxy.admin"))
+
+	// Gnosis Safe proxies keep the singleton in slot 0
+	gnosisMasterCopySlot = common.Hash{}
+
+	implementationSelector = crypto.Keccak256([]byte("implementation()"))[:4]
+	masterCopySelector     = crypto.Keccak256([]byte("masterCopy()"))[:4]
+
+	// EIP-3448 runtime code around the implementation, followed by metadata
+	metaProxyPrefix = common.FromHex("0x363d3d373d3d3d3d60368038038091363936013d73")
+	metaProxySuffix = common.FromHex("0x5af43d3d93803e603457fd5bf3")
+)
+
+func eip1967Slot(label string) common.Hash {
+	slot := new(big.Int).SetBytes(crypto.Keccak256([]byte(label)))
+	return common.BigToHash(slot.Sub(slot, common.Big1))
+}
+
+// ResolveProxy follows address through every proxy it detects at block and
+// returns one hop per proxy, the last hop's implementation being the contract
+// that finally runs. A contract that is not a proxy has no hops.
+func ResolveProxy(client *ethclient.Client, address common.Address, block *BlockRef) ([]ProxyHop, error) {
+	hops := []ProxyHop{}
+	seen := map[common.Address]bool{address: true}
+	for len(hops) < maxProxyHops {
+		hop, err := detectProxy(client, address, block)
+		if err != nil {
+			return nil, err
+		}
+		if hop == nil {
+			break
+		}
+		hops = append(hops, *hop)
+
+		next := common.HexToAddress(hop.Implementation)
+		if seen[next] {
+			break
+		}
+		seen[next] = true
+		address = next
+	}
+	return hops, nil
+}
+
+// ImplementationAbi follows address to its final implementation and returns
+// it with the ABI registered for it on chainId, and whether a hop on the way
+// was only found with the implementation() getter. The ABI is nil when
+// address is not a proxy or nothing is registered for the implementation.
+func ImplementationAbi(client *ethclient.Client, chainId string, address common.Address, block *BlockRef) (common.Address, *RegisteredAbi, bool, error) {
+	hops, err := ResolveProxy(client, address, block)
+	if err != nil || len(hops) == 0 {
+		return common.Address{}, nil, false, err
+	}
+	implementation := common.HexToAddress(hops[len(hops)-1].Implementation)
+	registered, ok := GetAbiRegistry().Lookup(chainId, implementation)
+	if !ok {
+		return implementation, nil, heuristicHops(hops), nil
+	}
+	return implementation, registered, heuristicHops(hops), nil
+}
+
+// detectProxy checks address for each known proxy pattern, bytecode first,
+// then the standard slots, then as a last resort the implementation() getter.
+// It returns nil when address is not a proxy.
+func detectProxy(client *ethclient.Client, address common.Address, block *BlockRef) (*ProxyHop, error) {
+	code, err := codeAtBlock(client, address, block)
+	if err != nil {
+		return nil, fmt.Errorf("get code of %s failed: %v", address.Hex(), err)
+	}
+	if len(code) == 0 {
+		return nil, nil
+	}
+	hop := &ProxyHop{Address: address.Hex()}
+
+	if target, ok := minimalProxyTarget(code); ok {
+		hop.Kind, hop.Implementation = ProxyKindEIP1167, target.Hex()
+		return hop, nil
+	}
+	if target, ok := metaProxyTarget(code); ok {
+		hop.Kind, hop.Implementation = ProxyKindEIP3448, target.Hex()
+		return hop, nil
+	}
+
+	slots, err := proxySlots(client, address, block)
+	if err != nil {
+		return nil, err
+	}
+	if admin, ok := slotAddress(slots[eip1967AdminSlot]); ok {
+		hop.Admin = admin.Hex()
+	}
+
+	if target, ok := slotAddress(slots[eip1967ImplementationSlot]); ok {
+		hop.Kind, hop.Implementation = ProxyKindEIP1967, target.Hex()
+		return hop, nil
+	}
+	if beacon, ok := slotAddress(slots[eip1967BeaconSlot]); ok {
+		target, err := implementationGetter(client, beacon, block)
+		if err != nil {
+			return nil, err
+		}
+		if target != nil {
+			hop.Kind, hop.Beacon, hop.Implementation = ProxyKindEIP1967Beacon, beacon.Hex(), target.Hex()
+			return hop, nil
+		}
+	}
+	if target, ok := slotAddress(slots[eip1822ProxiableSlot]); ok {
+		hop.Kind, hop.Implementation = ProxyKindEIP1822, target.Hex()
+		return hop, nil
+	}
+	if target, ok := slotAddress(slots[ozImplementationSlot]); ok {
+		hop.Kind, hop.Implementation = ProxyKindOZLegacy, target.Hex()
+		if admin, ok := slotAddress(slots[ozAdminSlot]); ok {
+			hop.Admin = admin.Hex()
+		}
+		return hop, nil
+	}
+
+	// Slot 0 is an ordinary variable in most contracts, so a Safe is only
+	// taken when its proxy also answers masterCopy() with the same address
+	if target, ok := slotAddress(slots[gnosisMasterCopySlot]); ok {
+		masterCopy, err := addressGetter(client, address, masterCopySelector, block)
+		if err != nil {
+			return nil, err
+		}
+		if masterCopy != nil && *masterCopy == target {
+			hop.Kind, hop.Implementation = ProxyKindGnosisSafe, target.Hex()
+			return hop, nil
+		}
+	}
+
+	// Beacons and factories answer implementation() too without forwarding
+	// calls, so the getter only counts for code that can delegate
+	if !hasDelegateCall(code) {
+		return nil, nil
+	}
+	target, err := implementationGetter(client, address, block)
+	if err != nil {
+		return nil, err
+	}
+	if target != nil && *target != address {
+		hop.Kind, hop.Implementation, hop.Heuristic = ProxyKindGetter, target.Hex(), true
+		return hop, nil
+	}
+	return nil, nil
+}
+
+// hasDelegateCall reports whether code contains a DELEGATECALL instruction,
+// skipping the data of push instructions.
+func hasDelegateCall(code []byte) bool {
+	for pc := 0; pc < len(code); pc++ {
+		op := vm.OpCode(code[pc])
+		switch {
+		case op == vm.DELEGATECALL:
+			return true
+		case op >= vm.PUSH1 && op <= vm.PUSH32:
+			pc += int(op - vm.PUSH1 + 1)
+		}
+	}
+	return false
+}
+
+// heuristicHops reports whether any hop was only found with the
+// implementation() getter.
+func heuristicHops(hops []ProxyHop) bool {
+	for _, hop := range hops {
+		if hop.Heuristic {
+			return true
+		}
+	}
+	return false
+}
+
+// proxySlots reads every slot a proxy may keep its implementation in with one
+// JSON-RPC batch.
+func proxySlots(client *ethclient.Client, address common.Address, block *BlockRef) (map[common.Hash]common.Hash, error) {
+	keys := []common.Hash{
+		eip1967ImplementationSlot, eip1967AdminSlot, eip1967BeaconSlot,
+		eip1822ProxiableSlot, ozImplementationSlot, ozAdminSlot, gnosisMasterCopySlot,
+	}
+	values := make([]common.Hash, len(keys))
+	batch := make([]rpc.BatchElem, len(keys))
+	for i, key := range keys {
+		batch[i] = rpc.BatchElem{
+			Method: "eth_getStorageAt",
+			Args:   []interface{}{address, key, block.rpcArg()},
+			Result: &values[i],
+		}
+	}
+	if err := client.Client().BatchCallContext(context.Background(), batch); err != nil {
+		return nil, fmt.Errorf("get proxy slots of %s failed: %v", address.Hex(), err)
+	}
+
+	slots := make(map[common.Hash]common.Hash, len(keys))
+	for i, elem := range batch {
+		if elem.Error != nil {
+			return nil, fmt.Errorf("get proxy slots of %s failed: %v", address.Hex(), elem.Error)
+		}
+		slots[keys[i]] = values[i]
+	}
+	return slots, nil
+}
+
+// implementationGetter calls implementation() on address and returns the
+// result when it is a contract.
+func implementationGetter(client *ethclient.Client, address common.Address, block *BlockRef) (*common.Address, error) {
+	target, err := addressGetter(client, address, implementationSelector, block)
+	if err != nil || target == nil {
+		return nil, err
+	}
+	code, err := codeAtBlock(client, *target, block)
+	if err != nil {
+		return nil, fmt.Errorf("get code of %s failed: %v", target.Hex(), err)
+	}
+	if len(code) == 0 {
+		return nil, nil
+	}
+	return target, nil
+}
+
+// addressGetter calls a getter without arguments and returns its result when
+// it is a non-zero address. Calls the node fails, like reverts, and other
+// return data count as absent.
+func addressGetter(client *ethclient.Client, address common.Address, selector []byte, block *BlockRef) (*common.Address, error) {
+	output, err := callAtBlock(client, ethereum.CallMsg{To: &address, Data: selector}, block)
+	if err != nil {
+		var rpcErr rpc.Error
+		if errors.As(err, &rpcErr) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("call %s on %s failed: %v", hexutil.Encode(selector), address.Hex(), err)
+	}
+	if len(output) != common.HashLength {
+		return nil, nil
+	}
+	target, ok := slotAddress(common.BytesToHash(output))
+	if !ok {
+		return nil, nil
+	}
+	return &target, nil
+}
+
+// slotAddress reads a storage word as an address, which must be non-zero with
+// the upper 12 bytes clear.
+func slotAddress(word common.Hash) (common.Address, bool) {
+	if word == (common.Hash{}) || !bytes.Equal(word[:common.HashLength-common.AddressLength], make([]byte, common.HashLength-common.AddressLength)) {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(word[common.HashLength-common.AddressLength:]), true
+}
+
+// metaProxyTarget returns the implementation of EIP-3448 runtime code, which
+// carries its metadata after the proxy code.
+func metaProxyTarget(code []byte) (common.Address, bool) {
+	end := len(metaProxyPrefix) + common.AddressLength
+	if len(code) < end+len(metaProxySuffix) || !bytes.HasPrefix(code, metaProxyPrefix) || !bytes.HasPrefix(code[end:], metaProxySuffix) {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(code[len(metaProxyPrefix):end]), true
+}
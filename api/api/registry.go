@@ -0,0 +1,424 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sirupsen/logrus"
+)
+
+const abiBindingsFile = "bindings.json"
+
+var (
+	abiNameRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+	abiRegistry     *AbiRegistry
+	abiRegistryOnce sync.Once
+)
+
+// RegisteredAbi is a named contract ABI held by the registry, with the
+// storage layout when it was registered from an artifact that has one.
+type RegisteredAbi struct {
+	Name          string
+	Raw           json.RawMessage
+	ABI           abi.ABI
+	StorageLayout *StorageLayout
+}
+
+// AbiRegistry holds named contract ABIs and the contract addresses bound to
+// them per chain. When a directory is configured, registrations are written
+// back to it so they survive restarts.
+type AbiRegistry struct {
+	mu       sync.RWMutex
+	dir      string
+	abis     map[string]*RegisteredAbi
+	bindings map[string]map[common.Address]string // chain id -> address -> abi name
+}
+
+// GetAbiRegistry returns the process wide registry, loading it from the
+// directory in ABI_REGISTRY_DIR on first use.
+func GetAbiRegistry() *AbiRegistry {
+	abiRegistryOnce.Do(func() {
+		abiRegistry = NewAbiRegistry(os.Getenv("ABI_REGISTRY_DIR"))
+		if err := abiRegistry.Load(); err != nil {
+			logrus.Error(fmt.Sprintf("failed to load ABI registry: %v", err))
+		}
+	})
+	return abiRegistry
+}
+
+func NewAbiRegistry(dir string) *AbiRegistry {
+	return &AbiRegistry{
+		dir:      dir,
+		abis:     make(map[string]*RegisteredAbi),
+		bindings: make(map[string]map[common.Address]string),
+	}
+}
+
+// Load reads every <name>.json ABI (or build artifact with an "abi" field)
+// and the bindings.json address bindings from the registry directory.
+func (reg *AbiRegistry) Load() error {
+	if reg.dir == "" {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(reg.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if filepath.Base(file) == abiBindingsFile {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			logrus.Error(fmt.Sprintf("failed to read ABI file %s: %v", file, err))
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		if err := reg.register(name, data, false); err != nil {
+			logrus.Error(fmt.Sprintf("failed to load ABI file %s: %v", file, err))
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(reg.dir, abiBindingsFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var bindings map[string]map[string]string
+	if err := json.Unmarshal(data, &bindings); err != nil {
+		return fmt.Errorf("invalid %s: %v", abiBindingsFile, err)
+	}
+	for chainId, addresses := range bindings {
+		for address, name := range addresses {
+			if err := reg.bind(chainId, address, name, false); err != nil {
+				logrus.Error(fmt.Sprintf("skipping binding %s/%s: %v", chainId, address, err))
+			}
+		}
+	}
+	return nil
+}
+
+// Register stores an ABI under name, replacing any previous one.
+func (reg *AbiRegistry) Register(name string, data []byte) error {
+	return reg.register(name, data, true)
+}
+
+func (reg *AbiRegistry) register(name string, data []byte, persist bool) error {
+	if !abiNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid ABI name %q", name)
+	}
+	// The bindings file shares the directory, EqualFold for case-insensitive
+	// file systems
+	if strings.EqualFold(name+".json", abiBindingsFile) {
+		return fmt.Errorf("ABI name %q is reserved", name)
+	}
+
+	raw := extractArtifactAbi(data)
+	parsedABI, err := ParseAbiJSON(raw)
+	if err != nil {
+		return err
+	}
+
+	// An artifact's storage layout is kept next to the ABI, so the file
+	// written back is an artifact too
+	stored := []byte(raw)
+	var layout *StorageLayout
+	if rawLayout := extractArtifactStorageLayout(data); rawLayout != nil {
+		if layout, err = ParseStorageLayout(rawLayout); err != nil {
+			return err
+		}
+		if stored, err = json.Marshal(map[string]json.RawMessage{"abi": raw, "storageLayout": rawLayout}); err != nil {
+			return err
+		}
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	reg.abis[name] = &RegisteredAbi{Name: name, Raw: raw, ABI: parsedABI, StorageLayout: layout}
+	if persist && reg.dir != "" {
+		return os.WriteFile(filepath.Join(reg.dir, name+".json"), stored, 0o644)
+	}
+	return nil
+}
+
+// Bind associates a contract address on a chain with a registered ABI.
+func (reg *AbiRegistry) Bind(chainId string, address string, name string) error {
+	return reg.bind(chainId, address, name, true)
+}
+
+func (reg *AbiRegistry) bind(chainId string, address string, name string, persist bool) error {
+	if !common.IsHexAddress(address) {
+		return fmt.Errorf("contract address is not hex")
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if _, ok := reg.abis[name]; !ok {
+		return fmt.Errorf("ABI %q is not registered", name)
+	}
+	if reg.bindings[chainId] == nil {
+		reg.bindings[chainId] = make(map[common.Address]string)
+	}
+	reg.bindings[chainId][common.HexToAddress(address)] = name
+
+	if persist && reg.dir != "" {
+		return reg.saveBindings()
+	}
+	return nil
+}
+
+// saveBindings writes the bindings file; the caller must hold the lock.
+func (reg *AbiRegistry) saveBindings() error {
+	bindings := make(map[string]map[string]string, len(reg.bindings))
+	for chainId, addresses := range reg.bindings {
+		bindings[chainId] = make(map[string]string, len(addresses))
+		for address, name := range addresses {
+			bindings[chainId][address.Hex()] = name
+		}
+	}
+
+	data, err := json.MarshalIndent(bindings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(reg.dir, abiBindingsFile), data, 0o644)
+}
+
+func (reg *AbiRegistry) Get(name string) (*RegisteredAbi, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	registered, ok := reg.abis[name]
+	return registered, ok
+}
+
+// Lookup returns the ABI bound to address on chainId, if any.
+func (reg *AbiRegistry) Lookup(chainId string, address common.Address) (*RegisteredAbi, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	name, ok := reg.bindings[chainId][address]
+	if !ok {
+		return nil, false
+	}
+	registered, ok := reg.abis[name]
+	return registered, ok
+}
+
+// MethodsBySelector returns the distinct methods of every registered ABI whose
+// selector matches.
+func (reg *AbiRegistry) MethodsBySelector(selector []byte) []abi.Method {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	seen := make(map[string]struct{})
+	methods := []abi.Method{}
+	for _, registered := range reg.abis {
+		method, err := registered.ABI.MethodById(selector)
+		if err != nil {
+			continue
+		}
+		if _, ok := seen[method.Sig]; ok {
+			continue
+		}
+		seen[method.Sig] = struct{}{}
+		methods = append(methods, *method)
+	}
+
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Sig < methods[j].Sig })
+	return methods
+}
+
+// ErrorsBySelector returns the distinct custom errors of every registered ABI
+// whose selector matches.
+func (reg *AbiRegistry) ErrorsBySelector(selector []byte) []abi.Error {
+	var id [4]byte
+	copy(id[:], selector)
+
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	seen := make(map[string]struct{})
+	customErrors := []abi.Error{}
+	for _, registered := range reg.abis {
+		customError, err := registered.ABI.ErrorByID(id)
+		if err != nil {
+			continue
+		}
+		if _, ok := seen[customError.Sig]; ok {
+			continue
+		}
+		seen[customError.Sig] = struct{}{}
+		customErrors = append(customErrors, *customError)
+	}
+
+	sort.Slice(customErrors, func(i, j int) bool { return customErrors[i].Sig < customErrors[j].Sig })
+	return customErrors
+}
+
+// EventsByTopic returns the distinct events of every registered ABI whose
+// topic matches.
+func (reg *AbiRegistry) EventsByTopic(topic common.Hash) []abi.Event {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	seen := make(map[string]struct{})
+	events := []abi.Event{}
+	for _, registered := range reg.abis {
+		event, err := registered.ABI.EventByID(topic)
+		if err != nil {
+			continue
+		}
+		key := event.String()
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		events = append(events, *event)
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].String() < events[j].String() })
+	return events
+}
+
+// List describes the registered ABIs and their bindings, optionally limited
+// to the bindings of one chain.
+func (reg *AbiRegistry) List(chainId string) []ContractAbiInfo {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	infos := make([]ContractAbiInfo, 0, len(reg.abis))
+	for name, registered := range reg.abis {
+		info := ContractAbiInfo{
+			Name:          name,
+			Functions:     []string{},
+			Events:        []string{},
+			Bindings:      []ContractAbiBinding{},
+			StorageLayout: registered.StorageLayout != nil,
+		}
+		for _, method := range registered.ABI.Methods {
+			info.Functions = append(info.Functions, method.Sig)
+		}
+		for _, event := range registered.ABI.Events {
+			info.Events = append(info.Events, event.Sig)
+		}
+		for bindingChain, addresses := range reg.bindings {
+			if chainId != "" && bindingChain != chainId {
+				continue
+			}
+			for address, boundName := range addresses {
+				if boundName == name {
+					info.Bindings = append(info.Bindings, ContractAbiBinding{ChainId: bindingChain, Address: address.Hex()})
+				}
+			}
+		}
+
+		sort.Strings(info.Functions)
+		sort.Strings(info.Events)
+		sort.Slice(info.Bindings, func(i, j int) bool {
+			if info.Bindings[i].ChainId != info.Bindings[j].ChainId {
+				return info.Bindings[i].ChainId < info.Bindings[j].ChainId
+			}
+			return info.Bindings[i].Address < info.Bindings[j].Address
+		})
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// extractArtifactAbi returns the "abi" field of a build artifact (hardhat,
+// truffle, foundry), or data unchanged when it is a plain ABI.
+func extractArtifactAbi(data []byte) json.RawMessage {
+	var artifact struct {
+		Abi json.RawMessage `json:"abi"`
+	}
+	if err := json.Unmarshal(data, &artifact); err == nil && len(artifact.Abi) > 0 {
+		return artifact.Abi
+	}
+	return data
+}
+
+// resolveContractAbi picks the ABI for a request: an inline ABI wins, then an
+// explicit registry name, then the ABI bound to the contract address.
+func resolveContractAbi(inline []byte, abiName string, chainId string, address string) (*abi.ABI, error) {
+	if len(inline) > 0 {
+		parsedABI, err := ParseAbiJSON(inline)
+		if err != nil {
+			return nil, err
+		}
+		return &parsedABI, nil
+	}
+
+	registry := GetAbiRegistry()
+	if abiName != "" {
+		registered, ok := registry.Get(abiName)
+		if !ok {
+			return nil, fmt.Errorf("ABI %q is not registered", abiName)
+		}
+		return &registered.ABI, nil
+	}
+
+	if common.IsHexAddress(address) {
+		if registered, ok := registry.Lookup(chainId, common.HexToAddress(address)); ok {
+			return &registered.ABI, nil
+		}
+	}
+	return nil, nil
+}
+
+// resolveStorageLayout picks the storage layout for a request like
+// resolveContractAbi: an inline layout, then the one registered under
+// abiName, then the one registered for the contract address.
+func resolveStorageLayout(inline []byte, abiName string, chainId string, address string) (*StorageLayout, error) {
+	if len(inline) > 0 {
+		return ParseStorageLayout(inline)
+	}
+
+	registry := GetAbiRegistry()
+	if abiName != "" {
+		registered, ok := registry.Get(abiName)
+		if !ok {
+			return nil, fmt.Errorf("ABI %q is not registered", abiName)
+		}
+		if registered.StorageLayout == nil {
+			return nil, fmt.Errorf("ABI %q was registered without a storage layout", abiName)
+		}
+		return registered.StorageLayout, nil
+	}
+
+	if common.IsHexAddress(address) {
+		if registered, ok := registry.Lookup(chainId, common.HexToAddress(address)); ok && registered.StorageLayout != nil {
+			return registered.StorageLayout, nil
+		}
+	}
+	return nil, fmt.Errorf("no storage layout, send storage-layout or register the contract's artifact with one")
+}
+
+// extractArtifactStorageLayout returns the "storageLayout" field of a build
+// artifact (solc output, foundry with storageLayout enabled), if any.
+func extractArtifactStorageLayout(data []byte) json.RawMessage {
+	var artifact struct {
+		StorageLayout json.RawMessage `json:"storageLayout"`
+	}
+	if err := json.Unmarshal(data, &artifact); err == nil && len(artifact.StorageLayout) > 0 && string(artifact.StorageLayout) != "null" {
+		return artifact.StorageLayout
+	}
+	return nil
+}
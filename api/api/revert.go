@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var (
+	errorStringSelector = crypto.Keccak256([]byte("Error(string)"))[:4]
+	panicSelector       = crypto.Keccak256([]byte("Panic(uint256)"))[:4]
+	uint256Type, _      = abi.NewType("uint256", "", nil)
+
+	// Solidity panic codes, see the "Panic via assert and Error via require"
+	// section of the Solidity documentation
+	panicReasons = map[uint64]string{
+		0x00: "generic compiler inserted panic",
+		0x01: "assert(false)",
+		0x11: "arithmetic overflow or underflow",
+		0x12: "division or modulo by zero",
+		0x21: "conversion to an invalid enum value",
+		0x22: "access to an incorrectly encoded storage byte array",
+		0x31: "pop() on an empty array",
+		0x32: "array index out of bounds",
+		0x41: "too much memory allocated",
+		0x51: "call to a zero-initialized internal function",
+	}
+)
+
+// Revert is the decoded revert data of a failed call.
+type Revert struct {
+	Data       string                 `json:"data"`
+	Kind       string                 `json:"kind"` // error, panic, custom or unknown
+	Reason     string                 `json:"reason,omitempty"`
+	PanicCode  string                 `json:"panic-code,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Signature  string                 `json:"signature,omitempty"`
+	Args       map[string]interface{} `json:"args,omitempty"`
+	Candidates []string               `json:"candidates,omitempty"`
+}
+
+// RevertError is returned when a call reverts. HandleResponse answers it with
+// 422 and the decoded revert instead of a generic internal error.
+type RevertError struct {
+	Code    uint64     `json:"code"`
+	Message string     `json:"message"`
+	Details string     `json:"details"`
+	Revert  *Revert    `json:"revert"`
+	Trace   *CallFrame `json:"trace,omitempty"`
+	Fork    *ForkInfo  `json:"fork,omitempty"`
+}
+
+func (e *RevertError) Error() string {
+	return fmt.Sprintf("Error (Code: %d, Message: %s)", e.Code, e.Message)
+}
+
+// AsRevertError converts a failed call into a RevertError when the node
+// reported a revert, decoding custom errors with contractAbi when given, then
+// the registry and the signature database. Other errors yield nil.
+func AsRevertError(err error, contractAbi *abi.ABI) *RevertError {
+	data, ok := revertData(err)
+	if !ok {
+		return nil
+	}
+
+	return &RevertError{
+		Code:    422,
+		Message: "Execution reverted",
+		Details: err.Error(),
+		Revert:  DecodeRevert(data, contractAbi),
+	}
+}
+
+// revertData pulls the revert data out of a JSON-RPC error. A revert without
+// data still counts as a revert.
+func revertData(err error) ([]byte, bool) {
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		if encoded, ok := dataErr.ErrorData().(string); ok {
+			if data, err := hexutil.Decode(encoded); err == nil {
+				return data, true
+			}
+		}
+	}
+
+	if strings.Contains(err.Error(), "execution reverted") {
+		return []byte{}, true
+	}
+	return nil, false
+}
+
+// DecodeRevert decodes Error(string), Panic(uint256) and custom errors.
+func DecodeRevert(data []byte, contractAbi *abi.ABI) *Revert {
+	revert := &Revert{
+		Data: hexutil.Encode(data),
+		Kind: "unknown",
+	}
+	if len(data) < 4 {
+		return revert
+	}
+
+	switch {
+	case bytes.Equal(data[:4], errorStringSelector):
+		if reason, err := abi.UnpackRevert(data); err == nil {
+			revert.Kind = "error"
+			revert.Reason = reason
+			revert.Signature = "Error(string)"
+		}
+		return revert
+
+	case bytes.Equal(data[:4], panicSelector):
+		values, err := (abi.Arguments{{Type: uint256Type}}).UnpackValues(data[4:])
+		if err != nil {
+			return revert
+		}
+		code := values[0].(*big.Int)
+		revert.Kind = "panic"
+		revert.Signature = "Panic(uint256)"
+		revert.PanicCode = fmt.Sprintf("0x%02x", code)
+		revert.Reason = "unknown panic code"
+		if code.IsUint64() {
+			if reason, ok := panicReasons[code.Uint64()]; ok {
+				revert.Reason = reason
+			}
+		}
+		return revert
+	}
+
+	candidates := revertCandidates(data[:4], contractAbi)
+	for _, candidate := range candidates {
+		decoded, err := DecodeAbiValues(candidate.Inputs, data[4:])
+		if err != nil {
+			continue
+		}
+		revert.Kind = "custom"
+		revert.Error = candidate.Name
+		revert.Signature = candidate.Sig
+		revert.Args = NamedAbiValues(candidate.Inputs, decoded)
+		break
+	}
+	if len(candidates) > 1 {
+		for _, candidate := range candidates {
+			revert.Candidates = append(revert.Candidates, candidate.Sig)
+		}
+	}
+	return revert
+}
+
+func revertCandidates(selector []byte, contractAbi *abi.ABI) []abi.Error {
+	var id [4]byte
+	copy(id[:], selector)
+
+	seen := make(map[string]struct{})
+	candidates := []abi.Error{}
+	add := func(customError abi.Error) {
+		if _, ok := seen[customError.Sig]; ok {
+			return
+		}
+		seen[customError.Sig] = struct{}{}
+		candidates = append(candidates, customError)
+	}
+
+	if contractAbi != nil {
+		if customError, err := contractAbi.ErrorByID(id); err == nil {
+			add(*customError)
+		}
+	}
+	for _, customError := range GetAbiRegistry().ErrorsBySelector(selector) {
+		add(customError)
+	}
+	for _, customError := range GetSignatureDB().Errors(selector) {
+		add(customError)
+	}
+	return candidates
+}
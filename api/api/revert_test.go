@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	// revert("Not enough Ether provided."), the example of the Solidity
+	// documentation
+	errorStringRevert = "0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"000000000000000000000000000000000000000000000000000000000000001a" +
+		"4e6f7420656e6f7567682045746865722070726f76696465642e000000000000"
+	// an arithmetic overflow in checked math
+	panicOverflowRevert = "0x4e487b71" +
+		"0000000000000000000000000000000000000000000000000000000000000011"
+)
+
+const insufficientBalanceAbi = `[{"type": "error", "name": "InsufficientBalance", "inputs": [
+	{"name": "available", "type": "uint256"},
+	{"name": "required", "type": "uint256"}
+]}]`
+
+func TestDecodeRevert(t *testing.T) {
+	contractAbi, err := ParseAbiJSON([]byte(insufficientBalanceAbi))
+	if err != nil {
+		t.Fatal(err)
+	}
+	insufficientBalance := hexutil.Encode(crypto.Keccak256([]byte("InsufficientBalance(uint256,uint256)"))[:4]) +
+		"0000000000000000000000000000000000000000000000000000000000000064" +
+		"00000000000000000000000000000000000000000000000000000000000000c8"
+
+	tests := []struct {
+		name     string
+		data     string
+		withAbi  bool
+		want     Revert
+		wantArgs map[string]interface{}
+	}{
+		{
+			name: "error string",
+			data: errorStringRevert,
+			want: Revert{Kind: "error", Reason: "Not enough Ether provided.", Signature: "Error(string)"},
+		},
+		{
+			name: "panic",
+			data: panicOverflowRevert,
+			want: Revert{Kind: "panic", Reason: "arithmetic overflow or underflow", PanicCode: "0x11", Signature: "Panic(uint256)"},
+		},
+		{
+			name: "unknown panic code",
+			data: "0x4e487b71" + "0000000000000000000000000000000000000000000000000000000000000099",
+			want: Revert{Kind: "panic", Reason: "unknown panic code", PanicCode: "0x99", Signature: "Panic(uint256)"},
+		},
+		{
+			name: "truncated panic",
+			data: "0x4e487b710011",
+			want: Revert{Kind: "unknown"},
+		},
+		{
+			name: "truncated error string",
+			data: errorStringRevert[:74],
+			want: Revert{Kind: "unknown"},
+		},
+		{
+			name:     "custom error",
+			data:     insufficientBalance,
+			withAbi:  true,
+			want:     Revert{Kind: "custom", Error: "InsufficientBalance", Signature: "InsufficientBalance(uint256,uint256)"},
+			wantArgs: map[string]interface{}{"available": "100", "required": "200"},
+		},
+		{
+			name: "custom error without its ABI",
+			data: insufficientBalance,
+			want: Revert{Kind: "unknown"},
+		},
+		{
+			name: "empty",
+			data: "0x",
+			want: Revert{Kind: "unknown"},
+		},
+		{
+			name: "shorter than a selector",
+			data: "0x4e48",
+			want: Revert{Kind: "unknown"},
+		},
+	}
+	for _, tt := range tests {
+		var got *Revert
+		if tt.withAbi {
+			got = DecodeRevert(hexutil.MustDecode(tt.data), &contractAbi)
+		} else {
+			got = DecodeRevert(hexutil.MustDecode(tt.data), nil)
+		}
+		if !reflect.DeepEqual(got.Args, tt.wantArgs) {
+			t.Errorf("%s: args = %v, want %v", tt.name, got.Args, tt.wantArgs)
+		}
+		tt.want.Data = tt.data
+		tt.want.Args = got.Args
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%s: DecodeRevert = %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+}
+
+// dataError is a JSON-RPC error carrying revert data, like those the node
+// returns from eth_call.
+type dataError struct {
+	message string
+	data    interface{}
+}
+
+func (e *dataError) Error() string          { return e.message }
+func (e *dataError) ErrorCode() int         { return 3 }
+func (e *dataError) ErrorData() interface{} { return e.data }
+
+func TestAsRevertError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		revert bool
+		data   string
+		kind   string
+	}{
+		{
+			name:   "revert with data",
+			err:    &dataError{message: "execution reverted: arithmetic underflow or overflow", data: panicOverflowRevert},
+			revert: true,
+			data:   panicOverflowRevert,
+			kind:   "panic",
+		},
+		{
+			name:   "revert without data",
+			err:    errors.New("execution reverted"),
+			revert: true,
+			data:   "0x",
+			kind:   "unknown",
+		},
+		{
+			name:   "data that is not hex",
+			err:    &dataError{message: "execution reverted", data: map[string]interface{}{"reason": "x"}},
+			revert: true,
+			data:   "0x",
+			kind:   "unknown",
+		},
+		{name: "other node error", err: errors.New("header not found")},
+		{name: "other error with data", err: &dataError{message: "insufficient funds", data: common.Hash{}}},
+	}
+	for _, tt := range tests {
+		got := AsRevertError(tt.err, nil)
+		if !tt.revert {
+			if got != nil {
+				t.Errorf("%s: AsRevertError = %+v, want nil", tt.name, got)
+			}
+			continue
+		}
+		if got == nil {
+			t.Errorf("%s: AsRevertError = nil, want a revert", tt.name)
+			continue
+		}
+		if got.Code != 422 || got.Details != tt.err.Error() || got.Revert.Data != tt.data || got.Revert.Kind != tt.kind {
+			t.Errorf("%s: AsRevertError = %+v with %+v, want code 422, data %s and kind %s", tt.name, got, got.Revert, tt.data, tt.kind)
+		}
+	}
+}
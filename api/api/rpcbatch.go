@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	rpcBatchWindow  = 5 * time.Millisecond
+	rpcBatchMaxSize = 100 // JSON-RPC messages per upstream batch
+)
+
+// batchingTransport coalesces the JSON-RPC requests one client makes
+// concurrently into a single JSON-RPC batch. Requests queue for up to
+// rpcBatchWindow (or until rpcBatchMaxSize messages) and are then sent as one
+// array; the responses are matched back by id. Message ids are unique because
+// every request through a transport comes from the same rpc.Client. When the
+// endpoint does not answer a batch properly the queued requests are sent one
+// by one instead.
+type batchingTransport struct {
+	base http.RoundTripper
+
+	mu    sync.Mutex
+	queue []*queuedRPC
+	size  int
+	timer *time.Timer
+}
+
+type queuedRPC struct {
+	req      *http.Request
+	body     []byte
+	messages []json.RawMessage
+	array    bool
+	done     chan queuedRPCResult
+}
+
+// queuedRPCResult is the answer to a queued request: its share of a batch
+// response, or the upstream response itself when it was sent on its own.
+type queuedRPCResult struct {
+	body []byte
+	resp *http.Response
+	err  error
+}
+
+type rpcMessageId struct {
+	Id json.RawMessage `json:"id"`
+}
+
+func newBatchingTransport(base http.RoundTripper) *batchingTransport {
+	return &batchingTransport{base: base}
+}
+
+func (t *batchingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Method != http.MethodPost {
+		return t.base.RoundTrip(req)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	queued := &queuedRPC{
+		req:  req,
+		body: body,
+		done: make(chan queuedRPCResult, 1),
+	}
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		queued.array = true
+		err = json.Unmarshal(trimmed, &queued.messages)
+	} else {
+		queued.messages = []json.RawMessage{trimmed}
+	}
+	if err != nil || len(queued.messages) == 0 {
+		return t.send(req, body)
+	}
+
+	t.enqueue(queued)
+
+	select {
+	case result := <-queued.done:
+		if result.err != nil || result.resp != nil {
+			return result.resp, result.err
+		}
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": []string{"application/json"}},
+			Body:          io.NopCloser(bytes.NewReader(result.body)),
+			ContentLength: int64(len(result.body)),
+			Request:       req,
+		}, nil
+	case <-req.Context().Done():
+		go func() {
+			if result := <-queued.done; result.resp != nil {
+				result.resp.Body.Close()
+			}
+		}()
+		return nil, req.Context().Err()
+	}
+}
+
+func (t *batchingTransport) enqueue(queued *queuedRPC) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.queue = append(t.queue, queued)
+	t.size += len(queued.messages)
+
+	if t.size >= rpcBatchMaxSize {
+		t.flushLocked()
+		return
+	}
+	if t.timer == nil {
+		t.timer = time.AfterFunc(rpcBatchWindow, func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.flushLocked()
+		})
+	}
+}
+
+func (t *batchingTransport) flushLocked() {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	queue := t.queue
+	t.queue, t.size = nil, 0
+	if len(queue) > 0 {
+		go t.flush(queue)
+	}
+}
+
+// flush sends the queued requests upstream as one batch.
+func (t *batchingTransport) flush(queue []*queuedRPC) {
+	if len(queue) == 1 {
+		t.sendOne(queue[0])
+		return
+	}
+
+	ids := make(map[string]struct{})
+	var messages []json.RawMessage
+	for _, queued := range queue {
+		for _, message := range queued.messages {
+			id, ok := messageId(message)
+			if _, duplicate := ids[id]; !ok || duplicate {
+				t.sendEach(queue)
+				return
+			}
+			ids[id] = struct{}{}
+			messages = append(messages, message)
+		}
+	}
+
+	body, _ := json.Marshal(messages)
+	first := queue[0].req
+	req := first.Clone(context.WithoutCancel(first.Context()))
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	responses, err := t.roundTripBatch(req)
+	if err != nil {
+		t.sendEach(queue)
+		return
+	}
+
+	for _, queued := range queue {
+		answers := make([]json.RawMessage, 0, len(queued.messages))
+		for _, message := range queued.messages {
+			id, _ := messageId(message)
+			if answer, ok := responses[id]; ok {
+				answers = append(answers, answer)
+			}
+		}
+		if len(answers) != len(queued.messages) {
+			go t.sendOne(queued)
+			continue
+		}
+
+		var result []byte
+		if queued.array {
+			result, _ = json.Marshal(answers)
+		} else {
+			result = answers[0]
+		}
+		queued.done <- queuedRPCResult{body: result}
+	}
+}
+
+// roundTripBatch posts a batch and indexes the answers by id.
+func (t *batchingTransport) roundTripBatch(req *http.Request) (map[string]json.RawMessage, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("batch request failed: %s", resp.Status)
+	}
+
+	var answers []json.RawMessage
+	if err := json.Unmarshal(body, &answers); err != nil {
+		return nil, fmt.Errorf("batch response is not an array: %v", err)
+	}
+	responses := make(map[string]json.RawMessage, len(answers))
+	for _, answer := range answers {
+		if id, ok := messageId(answer); ok {
+			responses[id] = answer
+		}
+	}
+	return responses, nil
+}
+
+func (t *batchingTransport) sendEach(queue []*queuedRPC) {
+	for _, queued := range queue {
+		go t.sendOne(queued)
+	}
+}
+
+// sendOne sends a queued request upstream as it was made.
+func (t *batchingTransport) sendOne(queued *queuedRPC) {
+	resp, err := t.send(queued.req, queued.body)
+	queued.done <- queuedRPCResult{resp: resp, err: err}
+}
+
+func (t *batchingTransport) send(req *http.Request, body []byte) (*http.Response, error) {
+	clone := req.Clone(req.Context())
+	clone.Body = io.NopCloser(bytes.NewReader(body))
+	clone.ContentLength = int64(len(body))
+	return t.base.RoundTrip(clone)
+}
+
+// messageId returns the compact JSON id of a JSON-RPC message.
+func messageId(message json.RawMessage) (string, bool) {
+	var msg rpcMessageId
+	if err := json.Unmarshal(message, &msg); err != nil || len(msg.Id) == 0 || string(msg.Id) == "null" {
+		return "", false
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, msg.Id); err != nil {
+		return "", false
+	}
+	return compact.String(), true
+}
@@ -1,15 +1,19 @@
 package handler
 
 import (
-	"context"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"generic-evm-api-go/api/pkg/utils"
+	"math/big"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/sirupsen/logrus"
 )
@@ -22,7 +26,6 @@ func GetVersionRequest(r *http.Request, parameters ...interface{}) (interface{},
 
 func GetEvmContractExtCodeSizeRequest(r *http.Request, parameters ...*GetEvmContractExtCodeSizeRequestParams) (interface{}, error) {
 	var params *GetEvmContractExtCodeSizeRequestParams
-	var client *ethclient.Client
 
 	if len(parameters) > 0 {
 		params = parameters[0]
@@ -35,35 +38,31 @@ func GetEvmContractExtCodeSizeRequest(r *http.Request, parameters ...*GetEvmCont
 			return nil, err
 		}
 	}
-	if params.JsonRpc != "" {
-		client_, err := DialClient(params.JsonRpc)
-		if err != nil {
-			err_ := fmt.Errorf("dial client %v failed: %v", params.JsonRpc, err.Error())
-			logrus.Error(err_)
-			return nil, err_
-		}
-		client = client_
-	} else {
-		chainInfo, err := GetChainInfo(params.ChainId)
-		if err != nil {
-			return nil, err
-		}
-		client_, err := DialClient(chainInfo.RPC)
-		if err != nil {
-			err_ := fmt.Errorf("dial client %v failed: %v", chainInfo.RPC, err.Error())
-			logrus.Error(err_)
-			return nil, err_
-		}
-		client = client_
-	}
 
 	if ok := common.IsHexAddress(params.Address); !ok {
 		err_ := fmt.Errorf("contract address is not hex")
 		logrus.Error(err_)
-		return nil, err_
+		return nil, utils.ErrMalformedRequest(err_.Error())
+	}
+
+	var client *ethclient.Client
+	var err error
+	if params.JsonRpc != "" {
+		client, err = dialRpcClient(r, params.JsonRpc)
+	} else {
+		client, err = dialChainClient(r, params.ChainId)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, blockInfo, err := ResolveBlock(client, params.Block)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
 	}
 
-	_, extCodeSize_, err := ExtCodeSize(client, common.HexToAddress(params.Address))
+	_, extCodeSize_, err := ExtCodeSize(client, common.HexToAddress(params.Address), block)
 	if err != nil {
 		logrus.Error(err)
 		return nil, err
@@ -73,6 +72,7 @@ func GetEvmContractExtCodeSizeRequest(r *http.Request, parameters ...*GetEvmCont
 		ChainId: params.ChainId,
 		Address: params.Address,
 		Size:    fmt.Sprintf("%+v", extCodeSize_),
+		Block:   blockInfo,
 	}, nil
 }
 
@@ -91,18 +91,24 @@ func GetEvmContractCodeRequest(r *http.Request, parameters ...*GetEvmContractCod
 		}
 	}
 
-	chainInfo, err := GetChainInfo(params.ChainId)
+	if ok := common.IsHexAddress(params.Address); !ok {
+		err_ := fmt.Errorf("contract address is not hex")
+		logrus.Error(err_)
+		return nil, utils.ErrMalformedRequest(err_.Error())
+	}
+
+	client, err := dialChainClient(r, params.ChainId)
 	if err != nil {
 		return nil, err
 	}
-	client, err := DialClient(chainInfo.RPC)
+
+	block, blockInfo, err := ResolveBlock(client, params.Block)
 	if err != nil {
-		err_ := fmt.Errorf("dial client %v failed: %v", chainInfo.RPC, err.Error())
-		logrus.Error(err_)
-		return nil, err_
+		logrus.Error(err)
+		return nil, err
 	}
 
-	extCode_, extCodeSize_, err := ExtCodeSize(client, common.HexToAddress(params.Address))
+	extCode_, extCodeSize_, err := ExtCodeSize(client, common.HexToAddress(params.Address), block)
 	if err != nil {
 		logrus.Error(err)
 		return nil, err
@@ -113,6 +119,7 @@ func GetEvmContractCodeRequest(r *http.Request, parameters ...*GetEvmContractCod
 		Address: params.Address,
 		Size:    fmt.Sprintf("%+v", extCodeSize_),
 		Code:    hex.EncodeToString(extCode_),
+		Block:   blockInfo,
 	}, nil
 }
 
@@ -131,31 +138,52 @@ func GetEvmContractDataAtMemoryRequest(r *http.Request, parameters ...*GetEvmCon
 		}
 	}
 
-	chainInfo, err := GetChainInfo(params.ChainId)
-	if err != nil {
+	body := &GetEvmContractDataAtMemoryRequestBody{}
+	if err := utils.ParseJSONBody(r, body); err != nil {
 		return nil, err
 	}
-	client, err := DialClient(chainInfo.RPC)
+	if len(body.StorageLayout) == 0 && params.StorageLayout != "" {
+		body.StorageLayout = json.RawMessage(params.StorageLayout)
+	}
+	slots, err := parseSlotList(r, params)
 	if err != nil {
-		err_ := fmt.Errorf("dial client %v failed: %v", chainInfo.RPC, err.Error())
-		logrus.Error(err_)
-		return nil, err_
+		return nil, err
+	}
+	if params.Variable == "" && params.StorgeAt == "" && slots == nil {
+		return nil, utils.ErrMalformedRequest("give storage-at, variable, slots or start and count")
 	}
 
 	if ok := common.IsHexAddress(params.Address); !ok {
 		err_ := fmt.Errorf("contract address is not hex")
 		logrus.Error(err_)
-		return nil, err_
+		return nil, utils.ErrMalformedRequest(err_.Error())
 	}
 
-	slot, err := strconv.ParseInt(params.StorgeAt, 10, 64)
+	client, err := dialChainClient(r, params.ChainId)
 	if err != nil {
-		err_ := fmt.Errorf("could not parse slot: %v", err.Error())
-		logrus.Error(err_)
-		return nil, err_
+		return nil, err
+	}
+
+	if params.Variable != "" {
+		return getStorageVariable(client, params, body.StorageLayout)
+	}
+	if slots != nil {
+		return getStorageSlots(client, params, slots)
+	}
+
+	slot, err := ParseSlot(params.StorgeAt)
+	if err != nil {
+		logrus.Error(err)
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+
+	block, blockInfo, err := ResolveBlock(client, params.Block)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
 	}
 
-	data, err := GetStorageAt(client, common.HexToAddress(params.Address), slot)
+	data, err := GetStorageAt(client, common.HexToAddress(params.Address), slot, block)
 	if err != nil {
 		logrus.Error(err.Error())
 		return nil, err
@@ -165,6 +193,8 @@ func GetEvmContractDataAtMemoryRequest(r *http.Request, parameters ...*GetEvmCon
 		ChainId: params.ChainId,
 		Address: params.Address,
 		Bytes:   hex.EncodeToString(data),
+		Slot:    slot.Hex(),
+		Block:   blockInfo,
 	}, nil
 }
 
@@ -183,61 +213,189 @@ func GetEvmContractCallViewRequest(r *http.Request, parameters ...*GetEvmContrac
 		}
 	}
 
-	count := 0
-	for key := range r.URL.Query() {
-		if strings.HasPrefix(key, "method-inputs") {
-			count++
-		}
+	body := &GetEvmContractCallViewRequestBody{}
+	if err := utils.ParseJSONBody(r, body); err != nil {
+		return nil, err
+	}
+	if len(body.Abi) == 0 && params.Abi != "" {
+		body.Abi = json.RawMessage(params.Abi)
+	}
+
+	contractAbi, err := resolveContractAbi(body.Abi, params.AbiName, params.ChainId, params.Address)
+	if err != nil {
+		logrus.Error(err)
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+	if contractAbi != nil && len(body.Abi) == 0 && params.AbiName == "" && !abiHasMethod(*contractAbi, params.MethodName) {
+		// a bound ABI without the method falls back to the typed call path
+		contractAbi = nil
 	}
 
-	if count > 0 {
-		// Loop through and parse the parameters
-		for i := 0; i < count; i++ {
-			paramType := r.URL.Query().Get(fmt.Sprintf("method-inputs[%d][type]", i))
-			paramValue := r.URL.Query().Get(fmt.Sprintf("method-inputs[%d][value]", i))
+	if r != nil {
+		inputs, err := utils.ParseIndexedParams(r.URL.Query(), "method-inputs")
+		if err != nil {
+			return nil, err
+		}
+		params.MethodParams = append(params.MethodParams, inputs...)
 
-			if paramType != "" && paramValue != "" {
-				params.MethodParams = append(params.MethodParams, utils.Parameter{
-					Type:  paramType,
-					Value: paramValue,
-				})
-			}
+		outputs, err := utils.ParseIndexedParams(r.URL.Query(), "method-outputs")
+		if err != nil {
+			return nil, err
 		}
-		// Assign methodParams to your params object
-		//params.MethodParams = methodParams
+		params.MethodOutputs = append(params.MethodOutputs, outputs...)
+	}
+
+	args, err := parseCallArgs(r, params.MethodParams, body.Args)
+	if err != nil {
+		return nil, err
 	}
 
-	fmt.Printf("\n paramters input: %+v", params)
+	if len(body.Overrides) == 0 && params.Overrides != "" {
+		body.Overrides = json.RawMessage(params.Overrides)
+	}
+	opts, err := ParseCallOptions(params.From, params.Value, params.Gas, params.GasPrice, body.Overrides)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
 
-	chainInfo, err := GetChainInfo(params.ChainId)
+	forked, err := parseExecution(params.Execution)
 	if err != nil {
 		return nil, err
 	}
-	client, err := DialClient(chainInfo.RPC)
+	traceCalls, traceSteps, err := parseTrace(params.Trace)
 	if err != nil {
-		err_ := fmt.Errorf("dial client %v failed: %v", chainInfo.RPC, err.Error())
-		logrus.Error(err_)
-		return nil, err_
+		return nil, err
+	}
+	if traceSteps && !forked {
+		return nil, utils.ErrMalformedRequest("trace=opcodes needs execution=fork")
+	}
+	proxied, err := parseFlag("proxy", params.Proxy)
+	if err != nil {
+		return nil, err
 	}
 
 	if ok := common.IsHexAddress(params.Address); !ok {
 		err_ := fmt.Errorf("contract address is not hex")
 		logrus.Error(err_)
-		return nil, err_
+		return nil, utils.ErrMalformedRequest(err_.Error())
 	}
 
-	result, err := CallContract(client, common.HexToAddress(params.Address), params.MethodName, params.MethodParams)
+	client, err := dialChainClient(r, params.ChainId)
 	if err != nil {
-		err_ := fmt.Errorf("failed to call contract %v: %w", params.Address, err)
-		logrus.Error(err_)
-		return nil, err_
+		return nil, err
 	}
-	return &GetEvmContractCallViewRequestResponse{
-		ChainId:    params.ChainId,
-		Address:    params.Address,
-		MethodName: params.MethodName,
-		Response:   hex.EncodeToString(result),
-	}, nil
+
+	block, blockInfo, err := ResolveBlock(client, params.Block)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+	address := common.HexToAddress(params.Address)
+
+	var proxyInfo *ProxyInfo
+	if proxied && contractAbi == nil {
+		implementation, registered, heuristic, err := ImplementationAbi(client, params.ChainId, address, block)
+		if err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+		if registered != nil && abiHasMethod(registered.ABI, params.MethodName) {
+			contractAbi = &registered.ABI
+			proxyInfo = &ProxyInfo{Implementation: implementation.Hex(), AbiName: registered.Name, Heuristic: heuristic}
+		}
+	}
+
+	var method *abi.Method
+	var signature *FunctionSignature
+	var callData []byte
+	if contractAbi != nil {
+		method_, values, err := ResolveAbiMethod(*contractAbi, params.MethodName, args)
+		if err != nil {
+			logrus.Error(err)
+			return nil, utils.ErrMalformedRequest(err.Error())
+		}
+		callData_, err := GetCallBytes(*contractAbi, method_.Name, values...)
+		if err != nil {
+			logrus.Error(err)
+			return nil, utils.ErrMalformedRequest(err.Error())
+		}
+		method, callData = method_, callData_
+	} else {
+		signature_, err := resolveCallSignature(params.MethodName, params.MethodParams, params.MethodOutputs)
+		if err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+		callData_, err := signature_.EncodeCall(args)
+		if err != nil {
+			err_ := fmt.Errorf("failed to construct call data: %v", err)
+			logrus.Error(err_)
+			return nil, utils.ErrMalformedRequest(err_.Error())
+		}
+		signature, callData = signature_, callData_
+	}
+
+	methods := []abi.Method{}
+	if method != nil {
+		methods = append(methods, *method)
+	} else {
+		methods = append(methods, signature.Method())
+	}
+
+	var call func() ([]byte, error)
+	var callTrace *CallFrame
+	var forkInfo *ForkInfo
+	if forked {
+		fork, err := NewFork(client, params.ChainId, block)
+		if err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+		if err := fork.ApplyOverrides(opts.stateOverrides()); err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+		result, err := fork.Call(address, callData, opts, traceCalls, traceSteps)
+		if err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+		if result.Trace != nil {
+			callTrace = decodeCallTrace(result.Trace, params.ChainId, methods, contractAbi)
+		}
+		forkInfo = fork.Info(result)
+		call = func() ([]byte, error) { return result.ReturnData, result.Err }
+	} else {
+		if traceCalls {
+			callTrace, err = TraceCall(client, params.ChainId, opts.callArg(address, callData), block, opts.stateOverrides(), methods, contractAbi)
+			if err != nil {
+				logrus.Error(err)
+				return nil, err
+			}
+		}
+		call = func() ([]byte, error) { return CallContractWithOptions(client, address, callData, block, opts) }
+	}
+
+	var response *GetEvmContractCallViewRequestResponse
+	if contractAbi != nil {
+		response, err = callViewWithAbi(params, *contractAbi, method, call)
+	} else {
+		response, err = callViewWithSignature(params, signature, call)
+	}
+	if err != nil {
+		var revertErr *RevertError
+		if errors.As(err, &revertErr) {
+			revertErr.Trace = callTrace
+			revertErr.Fork = forkInfo
+		}
+		return nil, err
+	}
+	response.Block = blockInfo
+	response.Trace = callTrace
+	response.Fork = forkInfo
+	response.Proxy = proxyInfo
+	return response, nil
 }
 
 func GetEvmContractBalanceRequest(r *http.Request, parameters ...*GetEvmContractBalanceRequestParams) (interface{}, error) {
@@ -255,19 +413,25 @@ func GetEvmContractBalanceRequest(r *http.Request, parameters ...*GetEvmContract
 		}
 	}
 
-	chainInfo, err := GetChainInfo(params.ChainId)
+	if ok := common.IsHexAddress(params.Address); !ok {
+		err_ := fmt.Errorf("contract address is not hex")
+		logrus.Error(err_)
+		return nil, utils.ErrMalformedRequest(err_.Error())
+	}
+
+	client, err := dialChainClient(r, params.ChainId)
 	if err != nil {
 		return nil, err
 	}
-	client, err := DialClient(chainInfo.RPC)
+
+	block, blockInfo, err := ResolveBlock(client, params.Block)
 	if err != nil {
-		err_ := fmt.Errorf("dial client %v failed: %v", chainInfo.RPC, err.Error())
-		logrus.Error(err_)
-		return nil, err_
+		logrus.Error(err)
+		return nil, err
 	}
 
 	address := common.HexToAddress(params.Address)
-	balance, err := client.BalanceAt(context.Background(), address, nil) // nil for latest block
+	balance, err := balanceAtBlock(client, address, block)
 	if err != nil {
 		err_ := fmt.Errorf("get balance failed: %v", err.Error())
 		logrus.Error(err_)
@@ -278,5 +442,1136 @@ func GetEvmContractBalanceRequest(r *http.Request, parameters ...*GetEvmContract
 		ChainId: params.ChainId,
 		Address: params.Address,
 		Balance: balance.String(),
+		Block:   blockInfo,
+	}, nil
+}
+
+func GetContractAbisRequest(r *http.Request, parameters ...*GetContractAbisRequestParams) (interface{}, error) {
+	var params *GetContractAbisRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &GetContractAbisRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			return nil, err
+		}
+	}
+
+	return &GetContractAbisRequestResponse{
+		Abis: GetAbiRegistry().List(params.ChainId),
+	}, nil
+}
+
+func RegisterContractAbiRequest(r *http.Request, parameters ...*RegisterContractAbiRequestParams) (interface{}, error) {
+	var params *RegisterContractAbiRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &RegisterContractAbiRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.RequireAdmin(r); err != nil {
+			return nil, err
+		}
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			return nil, err
+		}
+	}
+
+	body := &RegisterContractAbiRequestBody{}
+	if err := utils.ParseJSONBody(r, body); err != nil {
+		return nil, err
+	}
+	if len(body.Abi) == 0 {
+		if params.Abi == "" {
+			return nil, utils.ErrMalformedRequest("Missing fields: abi")
+		}
+		body.Abi = json.RawMessage(params.Abi)
+	}
+
+	registry := GetAbiRegistry()
+	if err := registry.Register(params.AbiName, body.Abi); err != nil {
+		err_ := fmt.Errorf("register ABI %v failed: %v", params.AbiName, err)
+		logrus.Error(err_)
+		return nil, utils.ErrMalformedRequest(err_.Error())
+	}
+
+	bindings := []ContractAbiBinding{}
+	if params.ChainId != "" && params.Address != "" {
+		if err := registry.Bind(params.ChainId, params.Address, params.AbiName); err != nil {
+			err_ := fmt.Errorf("bind ABI %v failed: %v", params.AbiName, err)
+			logrus.Error(err_)
+			return nil, utils.ErrMalformedRequest(err_.Error())
+		}
+		bindings = append(bindings, ContractAbiBinding{
+			ChainId: params.ChainId,
+			Address: common.HexToAddress(params.Address).Hex(),
+		})
+	}
+
+	return &RegisterContractAbiRequestResponse{
+		AbiName:  params.AbiName,
+		Bindings: bindings,
+	}, nil
+}
+
+func BindContractAbiRequest(r *http.Request, parameters ...*BindContractAbiRequestParams) (interface{}, error) {
+	var params *BindContractAbiRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &BindContractAbiRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.RequireAdmin(r); err != nil {
+			return nil, err
+		}
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := GetAbiRegistry().Bind(params.ChainId, params.Address, params.AbiName); err != nil {
+		err_ := fmt.Errorf("bind ABI %v failed: %v", params.AbiName, err)
+		logrus.Error(err_)
+		return nil, utils.ErrMalformedRequest(err_.Error())
+	}
+
+	return &RegisterContractAbiRequestResponse{
+		AbiName: params.AbiName,
+		Bindings: []ContractAbiBinding{{
+			ChainId: params.ChainId,
+			Address: common.HexToAddress(params.Address).Hex(),
+		}},
+	}, nil
+}
+
+func DecodeCalldataRequest(r *http.Request, parameters ...*DecodeCalldataRequestParams) (interface{}, error) {
+	var params *DecodeCalldataRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &DecodeCalldataRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			return nil, err
+		}
+	}
+
+	body := &DecodeRequestBody{}
+	if err := utils.ParseJSONBody(r, body); err != nil {
+		return nil, err
+	}
+	if len(body.Abi) == 0 && params.Abi != "" {
+		body.Abi = json.RawMessage(params.Abi)
+	}
+
+	data, err := decodeHexParam("calldata", params.Calldata)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 4 {
+		return nil, utils.ErrMalformedRequest("calldata is shorter than a selector")
+	}
+
+	candidates, sources, err := calldataCandidates(params, body.Abi, data[:4])
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	method, decoded, err := DecodeCalldata(data, candidates)
+	if err != nil {
+		logrus.Error(err)
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+
+	var signatures []string
+	if len(candidates) > 1 {
+		for _, candidate := range candidates {
+			signatures = append(signatures, candidate.Sig)
+		}
+	}
+
+	return &DecodeCalldataRequestResponse{
+		Selector:   hexutil.Encode(data[:4]),
+		Function:   method.RawName,
+		Signature:  method.Sig,
+		Args:       decoded,
+		NamedArgs:  NamedAbiValues(method.Inputs, decoded),
+		Source:     sources[method.Sig],
+		Candidates: signatures,
 	}, nil
 }
+
+func DecodeReturnRequest(r *http.Request, parameters ...*DecodeReturnRequestParams) (interface{}, error) {
+	var params *DecodeReturnRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &DecodeReturnRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			return nil, err
+		}
+
+		outputs, err := utils.ParseIndexedParams(r.URL.Query(), "method-outputs")
+		if err != nil {
+			return nil, err
+		}
+		params.MethodOutputs = append(params.MethodOutputs, outputs...)
+	}
+
+	body := &DecodeRequestBody{}
+	if err := utils.ParseJSONBody(r, body); err != nil {
+		return nil, err
+	}
+	if len(body.Abi) == 0 && params.Abi != "" {
+		body.Abi = json.RawMessage(params.Abi)
+	}
+
+	data, err := decodeHexParam("data", params.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs, err := resolveReturnOutputs(params, body.Abi)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	decoded, err := DecodeAbiValues(outputs, data)
+	if err != nil {
+		logrus.Error(err)
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+
+	types := make([]string, 0, len(outputs))
+	for _, output := range outputs {
+		types = append(types, output.Type.String())
+	}
+
+	return &DecodeReturnRequestResponse{
+		Types:   types,
+		Decoded: decoded,
+		Outputs: NamedAbiValues(outputs, decoded),
+	}, nil
+}
+
+func LookupSelectorRequest(r *http.Request, parameters ...*LookupSelectorRequestParams) (interface{}, error) {
+	var params *LookupSelectorRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &LookupSelectorRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			return nil, err
+		}
+	}
+
+	selector, err := decodeHexParam("selector", params.Selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(selector) < 4 {
+		return nil, utils.ErrMalformedRequest("selector must be 4 bytes")
+	}
+
+	return &LookupSelectorRequestResponse{
+		Selector: hexutil.Encode(selector[:4]),
+		Matches:  GetSignatureDB().LookupSelector(selector[:4]),
+	}, nil
+}
+
+func LookupTopicRequest(r *http.Request, parameters ...*LookupTopicRequestParams) (interface{}, error) {
+	var params *LookupTopicRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &LookupTopicRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			return nil, err
+		}
+	}
+
+	topic, err := decodeHexParam("topic", params.Topic)
+	if err != nil {
+		return nil, err
+	}
+	if len(topic) != common.HashLength {
+		return nil, utils.ErrMalformedRequest("topic must be 32 bytes")
+	}
+
+	return &LookupTopicRequestResponse{
+		Topic:   common.BytesToHash(topic).Hex(),
+		Matches: GetSignatureDB().LookupTopic(common.BytesToHash(topic)),
+	}, nil
+}
+
+func GetEvmLogsRequest(r *http.Request, parameters ...*GetEvmLogsRequestParams) (interface{}, error) {
+	var params *GetEvmLogsRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &GetEvmLogsRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			return nil, err
+		}
+		for i := range params.Topics {
+			if topics := r.URL.Query().Get(fmt.Sprintf("topics[%d]", i)); topics != "" {
+				params.Topics[i] = topics
+			}
+		}
+	}
+
+	body := &DecodeRequestBody{}
+	if err := utils.ParseJSONBody(r, body); err != nil {
+		return nil, err
+	}
+	if len(body.Abi) == 0 && params.Abi != "" {
+		body.Abi = json.RawMessage(params.Abi)
+	}
+
+	query, resolver, err := buildLogFilter(params, body.Abi)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	chunk, limit, err := parseLogPaging(params)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dialChainClient(r, params.ChainId)
+	if err != nil {
+		return nil, err
+	}
+
+	fromBlock, err := resolveBlockNumber(client, params.FromBlock)
+	if err != nil {
+		return nil, err
+	}
+	toBlock, err := resolveBlockNumber(client, params.ToBlock)
+	if err != nil {
+		return nil, err
+	}
+	from := LogCursor{Block: fromBlock}
+	if params.Cursor != "" {
+		if from, err = parseLogCursor(client, params.Cursor); err != nil {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("invalid cursor %q", params.Cursor))
+		}
+		fromBlock = from.Block
+	}
+	if fromBlock > toBlock {
+		return nil, utils.ErrMalformedRequest(fmt.Sprintf("from-block %d is after to-block %d", fromBlock, toBlock))
+	}
+
+	logs, next, err := FilterLogsChunked(client, query, from, toBlock, chunk, limit)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	response := &GetEvmLogsRequestResponse{
+		ChainId:   params.ChainId,
+		FromBlock: fromBlock,
+		ToBlock:   toBlock,
+		Logs:      make([]EvmLog, 0, len(logs)),
+	}
+	for _, log := range logs {
+		response.Logs = append(response.Logs, resolver.DecodeLog(log))
+	}
+	if next != nil {
+		response.NextCursor = next.String()
+	}
+	return response, nil
+}
+
+func GetEvmMulticallRequest(r *http.Request, parameters ...*GetEvmMulticallRequestParams) (interface{}, error) {
+	var params *GetEvmMulticallRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &GetEvmMulticallRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			return nil, err
+		}
+	}
+
+	body := &GetEvmMulticallRequestBody{}
+	if err := utils.ParseJSONBody(r, body); err != nil {
+		return nil, err
+	}
+
+	calls, err := PrepareCalls(body.Calls)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	multicallAddress := params.Multicall3
+	if multicallAddress == "" {
+		if chainInfo, err := GetChainInfo(params.ChainId); err == nil {
+			multicallAddress = chainInfo.Multicall3
+		}
+	}
+	if multicallAddress != "" && !common.IsHexAddress(multicallAddress) {
+		return nil, utils.ErrMalformedRequest(fmt.Sprintf("multicall-address %q is not hex", multicallAddress))
+	}
+
+	client, err := dialChainClient(r, params.ChainId)
+	if err != nil {
+		return nil, err
+	}
+
+	block, blockInfo, err := ResolveBlock(client, params.Block)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	response := &GetEvmMulticallRequestResponse{
+		ChainId: params.ChainId,
+		Via:     "batch",
+		Results: make([]MulticallResult, 0, len(calls)),
+		Block:   blockInfo,
+	}
+
+	var results []CallResult
+	if multicallAddress != "" {
+		multicall := common.HexToAddress(multicallAddress)
+		deployed, err := multicallDeployed(client, multicall, block)
+		if err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+		if deployed {
+			results, err = TryAggregate(client, multicall, calls, block)
+			if err != nil {
+				err_ := fmt.Errorf("multicall through %v failed: %w", multicall.Hex(), err)
+				logrus.Error(err_)
+				return nil, err_
+			}
+			response.Via = "multicall3"
+			response.Multicall3 = multicall.Hex()
+		}
+	}
+	if results == nil {
+		results, err = BatchCalls(client, calls, block)
+		if err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+	}
+
+	for i, call := range calls {
+		response.Results = append(response.Results, FormatCallResult(call, results[i]))
+	}
+	return response, nil
+}
+
+func GetEvmSimulateRequest(r *http.Request, parameters ...*GetEvmSimulateRequestParams) (interface{}, error) {
+	var params *GetEvmSimulateRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &GetEvmSimulateRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			return nil, err
+		}
+
+		inputs, err := utils.ParseIndexedParams(r.URL.Query(), "method-inputs")
+		if err != nil {
+			return nil, err
+		}
+		params.MethodParams = append(params.MethodParams, inputs...)
+
+		outputs, err := utils.ParseIndexedParams(r.URL.Query(), "method-outputs")
+		if err != nil {
+			return nil, err
+		}
+		params.MethodOutputs = append(params.MethodOutputs, outputs...)
+	}
+
+	body := &GetEvmSimulateRequestBody{}
+	if err := utils.ParseJSONBody(r, body); err != nil {
+		return nil, err
+	}
+
+	tx := &SimulationTx{}
+	if params.From != "" {
+		if !common.IsHexAddress(params.From) {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("from %q is not hex", params.From))
+		}
+		tx.From = common.HexToAddress(params.From)
+	}
+	if params.To != "" {
+		if !common.IsHexAddress(params.To) {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("to %q is not hex", params.To))
+		}
+		to := common.HexToAddress(params.To)
+		tx.To = &to
+	}
+
+	for _, field := range []struct {
+		name  string
+		value string
+		out   **big.Int
+	}{
+		{"value", params.Value, &tx.Value},
+		{"gas-price", params.GasPrice, &tx.GasPrice},
+		{"max-fee-per-gas", params.MaxFeePerGas, &tx.MaxFeePerGas},
+		{"max-priority-fee-per-gas", params.MaxPriorityFeePerGas, &tx.MaxPriorityFeePerGas},
+	} {
+		if field.value == "" {
+			continue
+		}
+		n, err := parseUintParam(field.name, field.value)
+		if err != nil {
+			return nil, err
+		}
+		*field.out = n
+	}
+	if params.Gas != "" {
+		gas, err := parseUintParam("gas", params.Gas)
+		if err != nil {
+			return nil, err
+		}
+		if !gas.IsUint64() {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("gas %q out of range", params.Gas))
+		}
+		tx.Gas = gas.Uint64()
+	}
+	if tx.GasPrice != nil && (tx.MaxFeePerGas != nil || tx.MaxPriorityFeePerGas != nil) {
+		return nil, utils.ErrMalformedRequest("gas-price cannot be combined with max-fee-per-gas or max-priority-fee-per-gas")
+	}
+
+	trace, err := parseFlag("trace", params.Trace)
+	if err != nil {
+		return nil, err
+	}
+
+	var signature *FunctionSignature
+	switch {
+	case params.Data != "" && params.MethodName != "":
+		return nil, utils.ErrMalformedRequest("give either data or method-name, not both")
+	case params.Data != "":
+		data, err := decodeHexParam("data", params.Data)
+		if err != nil {
+			return nil, err
+		}
+		tx.Data = data
+	case params.MethodName != "":
+		if tx.To == nil {
+			return nil, utils.ErrMalformedRequest("method-name needs a to address")
+		}
+		signature_, err := resolveCallSignature(params.MethodName, params.MethodParams, params.MethodOutputs)
+		if err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+		args, err := parseCallArgs(r, params.MethodParams, body.Args)
+		if err != nil {
+			return nil, err
+		}
+		data, err := signature_.EncodeCall(args)
+		if err != nil {
+			err_ := fmt.Errorf("failed to construct call data: %v", err)
+			logrus.Error(err_)
+			return nil, utils.ErrMalformedRequest(err_.Error())
+		}
+		signature, tx.Data = signature_, data
+	}
+
+	var contractAbi *abi.ABI
+	if tx.To != nil {
+		contractAbi, _ = resolveContractAbi(nil, "", params.ChainId, tx.To.Hex())
+	}
+
+	client, err := dialChainClient(r, params.ChainId)
+	if err != nil {
+		return nil, err
+	}
+
+	block, blockInfo, err := ResolveBlock(client, params.Block)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	response, err := Simulate(client, tx, block, signature, contractAbi)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+	response.ChainId = params.ChainId
+	response.Block = blockInfo
+	if signature != nil {
+		response.Signature = signature.Signature()
+	}
+
+	if trace {
+		methods := []abi.Method{}
+		if signature != nil {
+			methods = append(methods, signature.Method())
+		}
+		response.Trace, err = TraceCall(client, params.ChainId, tx.arg(nil), block, nil, methods, contractAbi)
+		if err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+func GetEvmTransactionRequest(r *http.Request, parameters ...*GetEvmTransactionRequestParams) (interface{}, error) {
+	var params *GetEvmTransactionRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &GetEvmTransactionRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			return nil, err
+		}
+	}
+
+	hash, err := decodeHexParam("tx-hash", params.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(hash) != common.HashLength {
+		return nil, utils.ErrMalformedRequest(fmt.Sprintf("tx-hash must be %d bytes", common.HashLength))
+	}
+
+	client, err := dialChainClient(r, params.ChainId)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, raw, receipt, err := GetTransaction(client, common.BytesToHash(hash))
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	response := &GetEvmTransactionRequestResponse{
+		ChainId:     params.ChainId,
+		Pending:     tx.BlockHash == nil,
+		Transaction: FormatTransaction(params.ChainId, tx, raw),
+	}
+	if receipt != nil {
+		response.Receipt = FormatReceipt(params.ChainId, receipt)
+	}
+	return response, nil
+}
+
+func GetEvmBlockRequest(r *http.Request, parameters ...*GetEvmBlockRequestParams) (interface{}, error) {
+	var params *GetEvmBlockRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &GetEvmBlockRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			return nil, err
+		}
+	}
+
+	if params.Block != "" && params.Timestamp != "" {
+		return nil, utils.ErrMalformedRequest("give either block or timestamp, not both")
+	}
+	full, err := parseFlag("full", params.Full)
+	if err != nil {
+		return nil, err
+	}
+	block, err := ParseBlockParam(params.Block)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dialChainClient(r, params.ChainId)
+	if err != nil {
+		return nil, err
+	}
+
+	var searchTimestamp *uint64
+	if params.Timestamp != "" {
+		timestamp, err := strconv.ParseUint(params.Timestamp, 10, 64)
+		if err != nil {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("invalid timestamp %q", params.Timestamp))
+		}
+		number, err := BlockAtTimestamp(client, timestamp)
+		if err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+		block = &BlockRef{Number: new(big.Int).SetUint64(number)}
+		searchTimestamp = &timestamp
+	}
+
+	result, err := GetBlock(client, block)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	var receipts []*rpcReceipt
+	if full && result.Hash != nil {
+		txHashes := make([]common.Hash, len(result.Transactions))
+		for i, raw := range result.Transactions {
+			var tx struct {
+				Hash common.Hash `json:"hash"`
+			}
+			if err := json.Unmarshal(raw, &tx); err != nil {
+				err_ := fmt.Errorf("transaction %d: %v", i, err)
+				logrus.Error(err_)
+				return nil, err_
+			}
+			txHashes[i] = tx.Hash
+		}
+		receipts, err = GetBlockReceipts(client, *result.Hash, txHashes)
+		if err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+	} else if full {
+		// a pending block has no receipts yet
+		receipts = make([]*rpcReceipt, len(result.Transactions))
+	}
+
+	response, err := FormatBlock(params.ChainId, result, receipts)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+	if tag := strings.ToLower(strings.TrimSpace(params.Block)); tag != "" {
+		if _, ok := blockTags[tag]; ok {
+			response.Tag = tag
+		}
+	} else if searchTimestamp == nil {
+		response.Tag = "latest"
+	}
+	response.SearchTimestamp = searchTimestamp
+	return response, nil
+}
+
+func GetEvmAddressRequest(r *http.Request, parameters ...*GetEvmAddressRequestParams) (interface{}, error) {
+	var params *GetEvmAddressRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &GetEvmAddressRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			return nil, err
+		}
+	}
+
+	if ok := common.IsHexAddress(params.Address); !ok {
+		return nil, utils.ErrMalformedRequest("address is not hex")
+	}
+
+	client, err := dialChainClient(r, params.ChainId)
+	if err != nil {
+		return nil, err
+	}
+
+	block, blockInfo, err := ResolveBlock(client, params.Block)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	info, err := GetAddressInfo(client, common.HexToAddress(params.Address), block)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+	info.ChainId = params.ChainId
+	info.Block = blockInfo
+	return info, nil
+}
+
+func ResolveProxyRequest(r *http.Request, parameters ...*ResolveProxyRequestParams) (interface{}, error) {
+	var params *ResolveProxyRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &ResolveProxyRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			return nil, err
+		}
+	}
+
+	if ok := common.IsHexAddress(params.Address); !ok {
+		return nil, utils.ErrMalformedRequest("contract address is not hex")
+	}
+	resolveAbi, err := parseFlag("resolve-abi", params.ResolveAbi)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dialChainClient(r, params.ChainId)
+	if err != nil {
+		return nil, err
+	}
+
+	block, blockInfo, err := ResolveBlock(client, params.Block)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	hops, err := ResolveProxy(client, common.HexToAddress(params.Address), block)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	response := &ResolveProxyRequestResponse{
+		ChainId:   params.ChainId,
+		Address:   params.Address,
+		Proxy:     len(hops) > 0,
+		Hops:      hops,
+		Heuristic: heuristicHops(hops),
+		Block:     blockInfo,
+	}
+	if len(hops) > 0 {
+		implementation := hops[len(hops)-1].Implementation
+		response.Implementation = implementation
+		if resolveAbi {
+			if registered, ok := GetAbiRegistry().Lookup(params.ChainId, common.HexToAddress(implementation)); ok {
+				response.AbiName = registered.Name
+			}
+		}
+	}
+	return response, nil
+}
+
+func GetStorageSlotRequest(r *http.Request, parameters ...*GetStorageSlotRequestParams) (interface{}, error) {
+	var params *GetStorageSlotRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &GetStorageSlotRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			return nil, err
+		}
+	}
+
+	var base common.Hash
+	switch {
+	case params.Slot != "" && params.Namespace != "":
+		return nil, utils.ErrMalformedRequest("give either slot or namespace, not both")
+	case params.Namespace != "":
+		base = NamespaceSlot(params.Namespace)
+	case params.Slot != "":
+		slot, err := ParseSlot(params.Slot)
+		if err != nil {
+			return nil, utils.ErrMalformedRequest(err.Error())
+		}
+		base = slot
+	default:
+		return nil, utils.ErrMalformedRequest("give slot or namespace")
+	}
+
+	keys, err := parseListParam(r, "keys", params.Keys)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := DeriveStorageSlot(base, keys)
+	if err != nil {
+		logrus.Error(err)
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+	read, err := parseFlag("read", params.Read)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetStorageSlotRequestResponse{
+		Namespace: params.Namespace,
+		BaseSlot:  base.Hex(),
+		Steps:     steps,
+		Slot:      base.Hex(),
+	}
+	if len(steps) > 0 {
+		response.Slot = steps[len(steps)-1].Slot
+		response.Offset = steps[len(steps)-1].Offset
+	}
+	if !read {
+		return response, nil
+	}
+
+	if params.ChainId == "" || !common.IsHexAddress(params.Address) {
+		return nil, utils.ErrMalformedRequest("read=true needs chain-id and a hex contract-address")
+	}
+	client, err := dialChainClient(r, params.ChainId)
+	if err != nil {
+		return nil, err
+	}
+
+	block, blockInfo, err := ResolveBlock(client, params.Block)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	data, err := GetStorageAt(client, common.HexToAddress(params.Address), common.HexToHash(response.Slot), block)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+	response.ChainId = params.ChainId
+	response.Address = params.Address
+	response.Value = hexutil.Encode(data)
+	response.Block = blockInfo
+	return response, nil
+}
+
+func GetStorageDumpRequest(r *http.Request, parameters ...*GetStorageDumpRequestParams) (interface{}, error) {
+	var params *GetStorageDumpRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &GetStorageDumpRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			return nil, err
+		}
+	}
+
+	body := &GetStorageDumpRequestBody{}
+	if err := utils.ParseJSONBody(r, body); err != nil {
+		return nil, err
+	}
+	if len(body.StorageLayout) == 0 && params.StorageLayout != "" {
+		body.StorageLayout = json.RawMessage(params.StorageLayout)
+	}
+	start, limit, err := parseStorageDumpPaging(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok := common.IsHexAddress(params.Address); !ok {
+		err_ := fmt.Errorf("contract address is not hex")
+		logrus.Error(err_)
+		return nil, utils.ErrMalformedRequest(err_.Error())
+	}
+
+	// A layout registered for the contract labels the dump without being
+	// asked for, one that was asked for has to be found
+	var annotator *StorageAnnotator
+	layout, err := resolveStorageLayout(body.StorageLayout, params.AbiName, params.ChainId, params.Address)
+	if err != nil && (len(body.StorageLayout) > 0 || params.AbiName != "") {
+		logrus.Error(err)
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+	if layout != nil {
+		if annotator, err = layout.Annotator(); err != nil {
+			logrus.Error(err)
+			return nil, utils.ErrMalformedRequest(err.Error())
+		}
+	}
+
+	client, err := dialChainClient(r, params.ChainId)
+	if err != nil {
+		return nil, err
+	}
+
+	_, blockInfo, err := ResolveBlock(client, params.Block)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+	stateBlock, blockInfo, err := StorageStateBlock(client, blockInfo)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	entries, next, err := DumpStorage(client, common.HexToAddress(params.Address), stateBlock, start, limit, annotator)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	response := &GetStorageDumpRequestResponse{
+		ChainId: params.ChainId,
+		Address: params.Address,
+		Storage: entries,
+		Block:   blockInfo,
+	}
+	if next != nil {
+		response.NextKey = next.Hex()
+	}
+	return response, nil
+}
+
+func GetStorageDiffRequest(r *http.Request, parameters ...*GetStorageDiffRequestParams) (interface{}, error) {
+	var params *GetStorageDiffRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &GetStorageDiffRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			return nil, err
+		}
+	}
+
+	body := &GetStorageDiffRequestBody{}
+	if err := utils.ParseJSONBody(r, body); err != nil {
+		return nil, err
+	}
+	if len(body.StorageLayout) == 0 && params.StorageLayout != "" {
+		body.StorageLayout = json.RawMessage(params.StorageLayout)
+	}
+
+	values, err := parseListParam(r, "slots", params.Slots)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) > maxStorageDiffSlots {
+		return nil, utils.ErrMalformedRequest(fmt.Sprintf("at most %d slots can be compared at once", maxStorageDiffSlots))
+	}
+	slots := make([]common.Hash, 0, len(values))
+	for _, value := range values {
+		slot, err := ParseSlot(value)
+		if err != nil {
+			return nil, utils.ErrMalformedRequest(err.Error())
+		}
+		slots = append(slots, slot)
+	}
+
+	if ok := common.IsHexAddress(params.Address); !ok {
+		err_ := fmt.Errorf("contract address is not hex")
+		logrus.Error(err_)
+		return nil, utils.ErrMalformedRequest(err_.Error())
+	}
+	address := common.HexToAddress(params.Address)
+
+	var annotator *StorageAnnotator
+	layout, err := resolveStorageLayout(body.StorageLayout, params.AbiName, params.ChainId, params.Address)
+	if err != nil && (len(body.StorageLayout) > 0 || params.AbiName != "") {
+		logrus.Error(err)
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+	if layout != nil {
+		if annotator, err = layout.Annotator(); err != nil {
+			logrus.Error(err)
+			return nil, utils.ErrMalformedRequest(err.Error())
+		}
+	}
+
+	client, err := dialChainClient(r, params.ChainId)
+	if err != nil {
+		return nil, err
+	}
+
+	_, fromInfo, err := ResolveBlock(client, params.FromBlock)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+	_, toInfo, err := ResolveBlock(client, params.ToBlock)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	diff := &GetStorageDiffRequestResponse{
+		ChainId:   params.ChainId,
+		Address:   params.Address,
+		FromBlock: fromInfo,
+		ToBlock:   toInfo,
+	}
+
+	// The full storage of both states when the node can dump it, or else the
+	// slots given and those of the layout
+	if err := debugStorageDiff(client, address, fromInfo, toInfo, annotator, diff); err != nil {
+		if !storageDiffFallback(err) || (len(slots) == 0 && annotator == nil) {
+			logrus.Error(err)
+			if errors.Is(err, errTooManySlots) || errors.Is(err, errHeadState) {
+				return nil, utils.ErrMalformedRequest(err.Error())
+			}
+			return nil, err
+		}
+
+		diff.Source = StorageDiffSourceSlots
+		if annotator != nil {
+			diff.Source = StorageDiffSourceLayout
+		}
+		diff.Storage, diff.SlotsCompared, err = DiffStorageSlots(client, address, blockRefOf(fromInfo), blockRefOf(toInfo), slots, annotator)
+		if err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+	}
+
+	if err := DiffAccount(client, address, blockRefOf(fromInfo), blockRefOf(toInfo), diff); err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+	return diff, nil
+}
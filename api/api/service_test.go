@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"errors"
+	"testing"
+
+	utils "generic-evm-api-go/api/pkg/utils"
+)
+
+func TestInvalidContractAddress(t *testing.T) {
+	// Chain 0 is not supported, so a handler dialing before it checks the
+	// address fails with that instead
+	handlers := map[string]func() (interface{}, error){
+		"ext-code-size": func() (interface{}, error) {
+			return GetEvmContractExtCodeSizeRequest(nil, &GetEvmContractExtCodeSizeRequestParams{ChainId: "0", Address: "0x12"})
+		},
+		"code": func() (interface{}, error) {
+			return GetEvmContractCodeRequest(nil, &GetEvmContractCodeRequestParams{ChainId: "0", Address: "0x12"})
+		},
+		"data-at-memory": func() (interface{}, error) {
+			return GetEvmContractDataAtMemoryRequest(nil, &GetEvmContractDataAtMemoryRequestParams{ChainId: "0", Address: "0x12", StorgeAt: "0"})
+		},
+		"call-view": func() (interface{}, error) {
+			return GetEvmContractCallViewRequest(nil, &GetEvmContractCallViewRequestParams{ChainId: "0", Address: "0x12", MethodName: "owner"})
+		},
+		"balance": func() (interface{}, error) {
+			return GetEvmContractBalanceRequest(nil, &GetEvmContractBalanceRequestParams{ChainId: "0", Address: "not-an-address"})
+		},
+	}
+	for name, handler := range handlers {
+		_, err := handler()
+		var apiErr utils.Error
+		if !errors.As(err, &apiErr) || apiErr.Code != 400 || apiErr.Details != "contract address is not hex" {
+			t.Errorf("%s: error = %v, want a 400 for the address", name, err)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package handler
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed signatures.txt
+var bundledSignatures string
+
+var (
+	signatureDB     *SignatureDB
+	signatureDBOnce sync.Once
+)
+
+// SignatureEntry is one known function, error or event declaration.
+type SignatureEntry struct {
+	Kind        string `json:"kind"`        // function, error or event
+	Signature   string `json:"signature"`   // canonical text signature
+	Declaration string `json:"declaration"` // as written, with names and indexed markers
+	Source      string `json:"source"`
+
+	function *FunctionSignature
+}
+
+// Method returns the entry as an abi.Method for calldata decoding.
+func (e *SignatureEntry) Method() abi.Method {
+	return e.function.Method()
+}
+
+// CustomError returns the entry as an abi.Error for revert data decoding.
+func (e *SignatureEntry) CustomError() abi.Error {
+	return abi.NewError(e.function.Name, e.function.Inputs)
+}
+
+// Event returns the entry as an abi.Event for log decoding.
+func (e *SignatureEntry) Event() abi.Event {
+	return abi.NewEvent(e.function.Name, e.function.Name, false, e.function.Inputs)
+}
+
+// SignatureDB maps 4-byte selectors (functions and errors) and 32-byte event
+// topics to every known declaration. It works offline: it is seeded from the
+// bundled signatures.txt and extended from SIGNATURE_DB_FILE.
+type SignatureDB struct {
+	mu        sync.RWMutex
+	selectors map[[4]byte][]*SignatureEntry
+	topics    map[common.Hash][]*SignatureEntry
+}
+
+// GetSignatureDB returns the process wide signature database, loading it on
+// first use.
+func GetSignatureDB() *SignatureDB {
+	signatureDBOnce.Do(func() {
+		signatureDB = NewSignatureDB()
+		if err := signatureDB.Load(bundledSignatures, "bundled"); err != nil {
+			logrus.Error(fmt.Sprintf("failed to load bundled signatures: %v", err))
+		}
+
+		if file := os.Getenv("SIGNATURE_DB_FILE"); file != "" {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				logrus.Error(fmt.Sprintf("failed to read signature file %s: %v", file, err))
+				return
+			}
+			if err := signatureDB.Load(string(data), "local"); err != nil {
+				logrus.Error(fmt.Sprintf("failed to load signature file %s: %v", file, err))
+			}
+		}
+	})
+	return signatureDB
+}
+
+func NewSignatureDB() *SignatureDB {
+	return &SignatureDB{
+		selectors: make(map[[4]byte][]*SignatureEntry),
+		topics:    make(map[common.Hash][]*SignatureEntry),
+	}
+}
+
+// Load adds every declaration in text, one per line. Blank lines and lines
+// starting with # are skipped; a bad line is reported with its number.
+func (db *SignatureDB) Load(text string, source string) error {
+	var failures []string
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := db.Add(line, source); err != nil {
+			failures = append(failures, fmt.Sprintf("line %d: %v", i+1, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// Add parses a "function ...", "error ..." or "event ..." declaration. A
+// declaration without a keyword is taken to be a function.
+func (db *SignatureDB) Add(declaration string, source string) error {
+	kind := "function"
+	body := declaration
+	for _, keyword := range []string{"function", "error", "event"} {
+		if strings.HasPrefix(declaration, keyword+" ") {
+			kind, body = keyword, strings.TrimSpace(declaration[len(keyword):])
+			break
+		}
+	}
+	body = strings.TrimSpace(strings.TrimSuffix(body, "anonymous"))
+
+	function, err := ParseFunctionSignature(body)
+	if err != nil {
+		return err
+	}
+
+	entry := &SignatureEntry{
+		Kind:        kind,
+		Signature:   function.Signature(),
+		Declaration: declaration,
+		Source:      source,
+		function:    function,
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if kind == "event" {
+		topic := crypto.Keccak256Hash([]byte(entry.Signature))
+		db.topics[topic] = appendSignatureEntry(db.topics[topic], entry)
+		return nil
+	}
+
+	var selector [4]byte
+	copy(selector[:], function.Selector())
+	db.selectors[selector] = appendSignatureEntry(db.selectors[selector], entry)
+	return nil
+}
+
+// appendSignatureEntry skips exact duplicates so a local file may repeat
+// bundled declarations.
+func appendSignatureEntry(entries []*SignatureEntry, entry *SignatureEntry) []*SignatureEntry {
+	for _, existing := range entries {
+		if existing.Kind == entry.Kind && existing.Declaration == entry.Declaration {
+			return entries
+		}
+	}
+	return append(entries, entry)
+}
+
+// LookupSelector returns every function and error declaration for selector.
+func (db *SignatureDB) LookupSelector(selector []byte) []*SignatureEntry {
+	var key [4]byte
+	copy(key[:], selector)
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return sortedSignatureEntries(db.selectors[key])
+}
+
+// LookupTopic returns every event declaration for topic.
+func (db *SignatureDB) LookupTopic(topic common.Hash) []*SignatureEntry {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return sortedSignatureEntries(db.topics[topic])
+}
+
+// Methods returns the distinct functions known for selector.
+func (db *SignatureDB) Methods(selector []byte) []abi.Method {
+	seen := make(map[string]struct{})
+	methods := []abi.Method{}
+	for _, entry := range db.LookupSelector(selector) {
+		if _, ok := seen[entry.Signature]; ok || entry.Kind != "function" {
+			continue
+		}
+		seen[entry.Signature] = struct{}{}
+		methods = append(methods, entry.Method())
+	}
+	return methods
+}
+
+// Errors returns the custom errors known for selector.
+func (db *SignatureDB) Errors(selector []byte) []abi.Error {
+	customErrors := []abi.Error{}
+	for _, entry := range db.LookupSelector(selector) {
+		if entry.Kind == "error" {
+			customErrors = append(customErrors, entry.CustomError())
+		}
+	}
+	return customErrors
+}
+
+// Events returns the events known for topic.
+func (db *SignatureDB) Events(topic common.Hash) []abi.Event {
+	events := []abi.Event{}
+	for _, entry := range db.LookupTopic(topic) {
+		events = append(events, entry.Event())
+	}
+	return events
+}
+
+func sortedSignatureEntries(entries []*SignatureEntry) []*SignatureEntry {
+	sorted := make([]*SignatureEntry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Kind != sorted[j].Kind {
+			return sorted[i].Kind < sorted[j].Kind
+		}
+		return sorted[i].Declaration < sorted[j].Declaration
+	})
+	return sorted
+}
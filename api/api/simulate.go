@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// nativeDecimals is the decimals of the native unit of every supported chain
+const nativeDecimals = 18
+
+// SimulationTx is an unsigned transaction to simulate. A nil To deploys Data
+// as init code.
+type SimulationTx struct {
+	From                 common.Address
+	To                   *common.Address
+	Value                *big.Int
+	Data                 []byte
+	Gas                  uint64
+	GasPrice             *big.Int
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+}
+
+// arg is the transaction as the call object of eth_call, eth_estimateGas and
+// eth_createAccessList.
+func (tx *SimulationTx) arg(accessList *types.AccessList) map[string]interface{} {
+	arg := map[string]interface{}{
+		"from": tx.From,
+		"data": hexutil.Bytes(tx.Data),
+	}
+	if tx.To != nil {
+		arg["to"] = tx.To
+	}
+	if tx.Value != nil {
+		arg["value"] = (*hexutil.Big)(tx.Value)
+	}
+	if tx.Gas != 0 {
+		arg["gas"] = hexutil.Uint64(tx.Gas)
+	}
+	if tx.GasPrice != nil {
+		arg["gasPrice"] = (*hexutil.Big)(tx.GasPrice)
+	}
+	if tx.MaxFeePerGas != nil {
+		arg["maxFeePerGas"] = (*hexutil.Big)(tx.MaxFeePerGas)
+	}
+	if tx.MaxPriorityFeePerGas != nil {
+		arg["maxPriorityFeePerGas"] = (*hexutil.Big)(tx.MaxPriorityFeePerGas)
+	}
+	if accessList != nil {
+		arg["accessList"] = accessList
+	}
+	return arg
+}
+
+type accessListResult struct {
+	AccessList *types.AccessList `json:"accessList"`
+	GasUsed    hexutil.Uint64    `json:"gasUsed"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// Simulate runs tx with eth_call and, when it succeeds, estimates its gas with
+// and without the access list from eth_createAccessList and prices it at the
+// current base fee and tip. A revert is reported in the response, decoded with
+// contractAbi when given; steps the node cannot run are listed in Errors.
+func Simulate(client *ethclient.Client, tx *SimulationTx, block *BlockRef, signature *FunctionSignature, contractAbi *abi.ABI) (*GetEvmSimulateRequestResponse, error) {
+	ctx := context.Background()
+	response := &GetEvmSimulateRequestResponse{
+		From:   tx.From.Hex(),
+		Errors: map[string]string{},
+	}
+	if tx.To != nil {
+		response.To = tx.To.Hex()
+	}
+
+	var returnData hexutil.Bytes
+	if err := client.Client().CallContext(ctx, &returnData, "eth_call", tx.arg(nil), block.rpcArg()); err != nil {
+		revertErr := AsRevertError(err, contractAbi)
+		if revertErr == nil {
+			return nil, fmt.Errorf("simulation failed: %w", err)
+		}
+		response.ReturnData = revertErr.Revert.Data
+		response.Revert = revertErr.Revert
+		return response, nil
+	}
+	response.Success = true
+	response.ReturnData = hexutil.Encode(returnData)
+
+	if signature != nil && len(signature.Outputs) > 0 {
+		decoded, err := DecodeAbiValues(signature.Outputs, returnData)
+		if err != nil {
+			response.Errors["decode"] = err.Error()
+		} else {
+			response.Decoded = decoded
+			response.Outputs = NamedAbiValues(signature.Outputs, decoded)
+		}
+	}
+
+	var estimate hexutil.Uint64
+	if err := client.Client().CallContext(ctx, &estimate, "eth_estimateGas", tx.arg(nil), block.rpcArg()); err != nil {
+		response.Errors["gas-estimate"] = err.Error()
+		return response, nil
+	}
+	response.GasEstimate = uint64(estimate)
+	gas := response.GasEstimate
+
+	var accessList accessListResult
+	err := client.Client().CallContext(ctx, &accessList, "eth_createAccessList", tx.arg(nil), block.rpcArg())
+	switch {
+	case err != nil:
+		response.Errors["access-list"] = err.Error()
+	case accessList.Error != "":
+		response.Errors["access-list"] = accessList.Error
+	case accessList.AccessList != nil:
+		response.AccessList = *accessList.AccessList
+		response.AccessListGasUsed = uint64(accessList.GasUsed)
+
+		var withList hexutil.Uint64
+		if err := client.Client().CallContext(ctx, &withList, "eth_estimateGas", tx.arg(accessList.AccessList), block.rpcArg()); err != nil {
+			response.Errors["gas-estimate-with-access-list"] = err.Error()
+			break
+		}
+		response.GasEstimateWithAccessList = uint64(withList)
+		response.GasSaved = int64(estimate) - int64(withList)
+		if uint64(withList) < gas {
+			gas = uint64(withList)
+		}
+	}
+
+	fee, err := EstimateFee(client, tx, gas)
+	if err != nil {
+		response.Errors["fee"] = err.Error()
+	}
+	response.Fee = fee
+	return response, nil
+}
+
+// EstimateFee prices gas at the gas price of tx, or at the base fee of the
+// next block plus the tip (capped by the max fee) for EIP-1559 chains. Chains
+// without fee history fall back to eth_gasPrice.
+func EstimateFee(client *ethclient.Client, tx *SimulationTx, gas uint64) (*SimulationFee, error) {
+	ctx := context.Background()
+	fee := &SimulationFee{Gas: gas}
+
+	price := tx.GasPrice
+	if price == nil {
+		history, err := client.FeeHistory(ctx, 1, nil, nil)
+		if err == nil && len(history.BaseFee) > 0 && history.BaseFee[len(history.BaseFee)-1] != nil {
+			baseFee := history.BaseFee[len(history.BaseFee)-1]
+			tip := tx.MaxPriorityFeePerGas
+			if tip == nil {
+				if tip, err = client.SuggestGasTipCap(ctx); err != nil {
+					return nil, fmt.Errorf("get priority fee failed: %v", err)
+				}
+			}
+			price = new(big.Int).Add(baseFee, tip)
+			if tx.MaxFeePerGas != nil && price.Cmp(tx.MaxFeePerGas) > 0 {
+				price = tx.MaxFeePerGas
+			}
+			fee.BaseFee, fee.PriorityFee = baseFee.String(), tip.String()
+		} else {
+			if price, err = client.SuggestGasPrice(ctx); err != nil {
+				return nil, fmt.Errorf("get gas price failed: %v", err)
+			}
+		}
+	}
+
+	total := new(big.Int).Mul(price, new(big.Int).SetUint64(gas))
+	fee.GasPrice = price.String()
+	fee.Fee = total.String()
+	fee.FeeNative = formatUnits(total, nativeDecimals)
+	return fee, nil
+}
+
+// formatUnits renders an integer amount with decimals as a decimal string,
+// e.g. 1500000000000000 with 18 decimals as 0.0015.
+func formatUnits(amount *big.Int, decimals int) string {
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	whole, frac := new(big.Int).QuoRem(new(big.Int).Abs(amount), unit, new(big.Int))
+
+	formatted := whole.String()
+	if frac.Sign() != 0 {
+		digits := fmt.Sprintf("%0*s", decimals, frac.String())
+		formatted += "." + strings.TrimRight(digits, "0")
+	}
+	if amount.Sign() < 0 {
+		formatted = "-" + formatted
+	}
+	return formatted
+}
@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	utils "generic-evm-api-go/api/pkg/utils"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// maxStorageDiffSlots caps the slots a storage-diff compares per block, the
+// non-zero slots of each state with debug_storageRangeAt or the slots read
+// otherwise.
+const maxStorageDiffSlots = 10000
+
+// Sources storage-diff reports the compared slots came from
+const (
+	StorageDiffSourceDebug  = "debug_storageRangeAt"
+	StorageDiffSourceSlots  = "slots"
+	StorageDiffSourceLayout = "storage-layout"
+)
+
+// storageEntry is a non-zero slot of a dumped state, with the slot when
+// known.
+type storageEntry struct {
+	Slot  *common.Hash
+	Value common.Hash
+}
+
+// DumpAllStorage pages through every non-zero slot of address in the state
+// before the first transaction of stateBlock, keyed by trie key. It stops
+// after limit slots and reports whether the dump is complete.
+func DumpAllStorage(client *ethclient.Client, address common.Address, stateBlock common.Hash, limit int) (map[common.Hash]storageEntry, bool, error) {
+	entries := make(map[common.Hash]storageEntry)
+	start := common.Hash{}
+	for {
+		page, err := storageRangeAt(client, address, stateBlock, start, maxStorageDumpLimit)
+		if err != nil {
+			return nil, false, err
+		}
+		for key, stored := range page.Storage {
+			entries[key] = storageEntry{Slot: stored.Key, Value: stored.Value}
+		}
+		if page.NextKey == nil {
+			return entries, true, nil
+		}
+		if len(entries) >= limit {
+			return entries, false, nil
+		}
+		start = *page.NextKey
+	}
+}
+
+// DiffStorageDumps compares two dumps of a contract's storage: every trie key
+// whose value differs, slots absent from one side being zero there, and how
+// many keys were compared. annotator, when given, recovers the slots of known
+// variables and labels every change.
+func DiffStorageDumps(before, after map[common.Hash]storageEntry, annotator *StorageAnnotator) ([]StorageChange, int) {
+	keys := make([]common.Hash, 0, len(before)+len(after))
+	for key := range before {
+		keys = append(keys, key)
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Cmp(keys[j]) < 0 })
+
+	changes := []StorageChange{}
+	for _, key := range keys {
+		from, to := before[key], after[key]
+		if from.Value == to.Value {
+			continue
+		}
+		change := StorageChange{Key: key.Hex(), Before: from.Value.Hex(), After: to.Value.Hex()}
+		preimage := from.Slot
+		if preimage == nil {
+			preimage = to.Slot
+		}
+		if slot := annotator.slotOf(key, preimage); slot != nil {
+			change.Slot = slot.Hex()
+			change.Labels = annotator.Labels(*slot)
+		}
+		changes = append(changes, change)
+	}
+	return changes, len(keys)
+}
+
+// DiffStorageSlots reads slots of address at both blocks in JSON-RPC batches
+// and returns those whose value differs. With an annotator, the words of the
+// layout's variables are compared too, including the data of dynamic arrays
+// and byte strings as long as the longer of the two. It returns how many
+// slots were compared.
+func DiffStorageSlots(client *ethclient.Client, address common.Address, from, to *BlockRef, slots []common.Hash, annotator *StorageAnnotator) ([]StorageChange, int, error) {
+	before := NewStorageReader(client, address, from)
+	after := NewStorageReader(client, address, to)
+
+	seen := make(map[common.Hash]bool)
+	var compared []common.Hash
+	add := func(slots []common.Hash) error {
+		for _, slot := range slots {
+			if seen[slot] {
+				continue
+			}
+			seen[slot] = true
+			compared = append(compared, slot)
+		}
+		if len(compared) > maxStorageDiffSlots {
+			return utils.ErrMalformedRequest(fmt.Sprintf("at most %d slots can be compared at once", maxStorageDiffSlots))
+		}
+		if err := before.Prefetch(compared); err != nil {
+			return err
+		}
+		return after.Prefetch(compared)
+	}
+
+	if err := add(slots); err != nil {
+		return nil, 0, err
+	}
+	if annotator != nil {
+		if err := add(annotator.Slots()); err != nil {
+			return nil, 0, err
+		}
+		data, err := annotator.DataSlots(before, after)
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := add(data); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	changes := []StorageChange{}
+	for _, slot := range compared {
+		from, err := before.Word(slot)
+		if err != nil {
+			return nil, 0, err
+		}
+		to, err := after.Word(slot)
+		if err != nil {
+			return nil, 0, err
+		}
+		if from == to {
+			continue
+		}
+		changes = append(changes, StorageChange{
+			Slot:   slot.Hex(),
+			Before: from.Hex(),
+			After:  to.Hex(),
+			Labels: annotator.Labels(slot),
+		})
+	}
+	return changes, len(compared), nil
+}
+
+// DiffAccount compares the balance, nonce and code of address at both
+// blocks, filling in the fields of diff that changed.
+func DiffAccount(client *ethclient.Client, address common.Address, from, to *BlockRef, diff *GetStorageDiffRequestResponse) error {
+	before, err := GetAddressInfo(client, address, from)
+	if err != nil {
+		return err
+	}
+	after, err := GetAddressInfo(client, address, to)
+	if err != nil {
+		return err
+	}
+
+	if before.Balance != after.Balance {
+		diff.Balance = &ValueChange{Before: before.Balance, After: after.Balance}
+	}
+	if before.Nonce != after.Nonce {
+		diff.Nonce = &ValueChange{Before: fmt.Sprint(before.Nonce), After: fmt.Sprint(after.Nonce)}
+	}
+	if before.CodeHash != after.CodeHash {
+		diff.CodeHash = &ValueChange{Before: before.CodeHash, After: after.CodeHash}
+	}
+	return nil
+}
+
+// errTooManySlots is returned by debugStorageDiff for a contract with more
+// than maxStorageDiffSlots non-zero slots.
+var errTooManySlots = fmt.Errorf("the contract has more than %d non-zero slots, give slots or a storage layout to compare", maxStorageDiffSlots)
+
+// errHeadState is returned by debugStorageDiff for the head block, whose
+// final state debug_storageRangeAt cannot read before a child is mined.
+var errHeadState = errors.New("debug_storageRangeAt cannot read the final state of the head block, give an earlier to-block, or slots or a storage layout to compare")
+
+// debugStorageDiff fills in diff with the changes between the full storage of
+// address at the end of from and at the end of to, read with
+// debug_storageRangeAt.
+func debugStorageDiff(client *ethclient.Client, address common.Address, from, to *BlockInfo, annotator *StorageAnnotator, diff *GetStorageDiffRequestResponse) error {
+	fromState, fromInfo, err := StorageStateBlock(client, from)
+	if err != nil {
+		return err
+	}
+	toState, toInfo, err := StorageStateBlock(client, to)
+	if err != nil {
+		return err
+	}
+	// StorageStateBlock reads the head's parent instead, which would compare
+	// other blocks than asked for
+	if fromInfo.Number != from.Number || toInfo.Number != to.Number {
+		return errHeadState
+	}
+
+	before, complete, err := DumpAllStorage(client, address, fromState, maxStorageDiffSlots)
+	if err != nil {
+		return err
+	}
+	if !complete {
+		return errTooManySlots
+	}
+	after, complete, err := DumpAllStorage(client, address, toState, maxStorageDiffSlots)
+	if err != nil {
+		return err
+	}
+	if !complete {
+		return errTooManySlots
+	}
+
+	diff.Source = StorageDiffSourceDebug
+	diff.Storage, diff.SlotsCompared = DiffStorageDumps(before, after, annotator)
+	return nil
+}
+
+// storageDiffFallback reports whether storage-diff should compare given slots
+// instead after debugStorageDiff failed with err.
+func storageDiffFallback(err error) bool {
+	var apiErr utils.Error
+	return errors.Is(err, errTooManySlots) || errors.Is(err, errHeadState) || (errors.As(err, &apiErr) && apiErr.Code == 501)
+}
+
+func blockRefOf(info *BlockInfo) *BlockRef {
+	return &BlockRef{Number: new(big.Int).SetUint64(info.Number)}
+}
@@ -0,0 +1,409 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+
+	utils "generic-evm-api-go/api/pkg/utils"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	defaultStorageDumpLimit = 256
+	maxStorageDumpLimit     = 1024
+)
+
+// maxRegionWords bounds the data of a dynamic array or byte string, which
+// the layout gives no length for: a slot further past its start is taken to
+// belong to something else.
+var maxRegionWords = new(big.Int).Lsh(common.Big1, 64)
+
+// storageRange is a page of debug_storageRangeAt: non-zero slots keyed by the
+// keccak256 hash of the slot the storage trie keeps them under, with the slot
+// itself when the node recorded its preimage.
+type storageRange struct {
+	Storage map[common.Hash]struct {
+		Key   *common.Hash `json:"key"`
+		Value common.Hash  `json:"value"`
+	} `json:"storage"`
+	NextKey *common.Hash `json:"nextKey"`
+}
+
+// StorageStateBlock finds what to hand debug_storageRangeAt for the state at
+// the end of block. The method reads the state before a transaction of a
+// block, so that is the child block at transaction 0. The head has no child
+// yet, so its parent's state is read instead and the block returned says so.
+func StorageStateBlock(client *ethclient.Client, block *BlockInfo) (common.Hash, *BlockInfo, error) {
+	if block.Tag == "pending" {
+		return common.Hash{}, nil, utils.ErrMalformedRequest("the storage of the pending block cannot be dumped")
+	}
+
+	var child *struct {
+		Hash       common.Hash `json:"hash"`
+		ParentHash common.Hash `json:"parentHash"`
+	}
+	if err := client.Client().CallContext(context.Background(), &child, "eth_getBlockByNumber", rpc.BlockNumber(block.Number+1), false); err != nil {
+		return common.Hash{}, nil, fmt.Errorf("get block %d failed: %v", block.Number+1, err)
+	}
+	if child != nil {
+		if child.ParentHash != common.HexToHash(block.Hash) {
+			return common.Hash{}, nil, utils.ErrMalformedRequest(fmt.Sprintf("block %s is not canonical", block.Hash))
+		}
+		return child.Hash, block, nil
+	}
+
+	if block.Number == 0 {
+		return common.Hash{}, nil, utils.ErrMalformedRequest("the storage of the genesis block cannot be dumped")
+	}
+	_, parent, err := ResolveBlock(client, fmt.Sprint(block.Number-1))
+	if err != nil {
+		return common.Hash{}, nil, err
+	}
+	return common.HexToHash(block.Hash), parent, nil
+}
+
+// DumpStorage reads up to limit non-zero slots of address with
+// debug_storageRangeAt, from trie key start on, in the state before the first
+// transaction of stateBlock. Entries come in trie key order; next is the key
+// the following page starts at and nil after the last page. annotator, when
+// given, recovers the slots of known variables and labels every entry.
+func DumpStorage(client *ethclient.Client, address common.Address, stateBlock common.Hash, start common.Hash, limit int, annotator *StorageAnnotator) ([]StorageDumpEntry, *common.Hash, error) {
+	page, err := storageRangeAt(client, address, stateBlock, start, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys := make([]common.Hash, 0, len(page.Storage))
+	for key := range page.Storage {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Cmp(keys[j]) < 0 })
+
+	entries := make([]StorageDumpEntry, 0, len(keys))
+	for _, key := range keys {
+		stored := page.Storage[key]
+		entry := StorageDumpEntry{Key: key.Hex(), Value: stored.Value.Hex()}
+		if slot := annotator.slotOf(key, stored.Key); slot != nil {
+			entry.Slot = slot.Hex()
+			entry.Labels = annotator.Labels(*slot)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, page.NextKey, nil
+}
+
+func storageRangeAt(client *ethclient.Client, address common.Address, stateBlock common.Hash, start common.Hash, limit int) (*storageRange, error) {
+	var page storageRange
+	if err := client.Client().CallContext(context.Background(), &page, "debug_storageRangeAt", stateBlock, 0, address, hexutil.Bytes(start.Bytes()), limit); err != nil {
+		if debugUnsupported(err) {
+			return nil, utils.ErrNotImplemented(fmt.Sprintf("the node does not support debug_storageRangeAt, the chain RPC needs the debug namespace enabled: %v", err))
+		}
+		return nil, fmt.Errorf("storage range of %s failed: %w", address.Hex(), err)
+	}
+	return &page, nil
+}
+
+// StorageAnnotator names the slots of a storage layout. Statically placed
+// words are known by slot and by their trie key; the data of arrays and byte
+// strings is matched by the region it falls in. Mapping entries hash their
+// key in and cannot be named.
+type StorageAnnotator struct {
+	layout  *StorageLayout
+	words   []common.Hash
+	labels  map[common.Hash][]string
+	hashed  map[common.Hash]common.Hash
+	regions []storageRegion
+}
+
+// storageRegion is the data of an array, or of a long byte string when base
+// is nil, starting at start. length is nil for dynamic data, whose length is
+// kept at slot.
+type storageRegion struct {
+	label  string
+	slot   common.Hash
+	start  *big.Int
+	length *big.Int
+	base   *StorageLayoutType
+	size   int
+}
+
+// Annotator indexes the slots of every variable of the layout.
+func (l *StorageLayout) Annotator() (*StorageAnnotator, error) {
+	a := &StorageAnnotator{
+		layout: l,
+		labels: make(map[common.Hash][]string),
+		hashed: make(map[common.Hash]common.Hash),
+	}
+	for _, entry := range l.Storage {
+		if err := a.add(entry.Label, common.Hash{}, entry); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Labels names what slot holds: one label per variable packed into it. A nil
+// annotator has none.
+func (a *StorageAnnotator) Labels(slot common.Hash) []string {
+	if a == nil {
+		return nil
+	}
+	labels := append([]string(nil), a.labels[slot]...)
+	n := slot.Big()
+	for i := range a.regions {
+		labels = append(labels, a.regions[i].labels(a.layout, n)...)
+	}
+	return labels
+}
+
+// Slot recovers the slot of a trie key when it is a statically placed word.
+func (a *StorageAnnotator) Slot(key common.Hash) (common.Hash, bool) {
+	slot, ok := a.hashed[key]
+	return slot, ok
+}
+
+// slotOf is the slot of a trie key: its preimage when the node gave one, or
+// else the word of the layout hashing to it.
+func (a *StorageAnnotator) slotOf(key common.Hash, preimage *common.Hash) *common.Hash {
+	if preimage != nil {
+		return preimage
+	}
+	if a == nil {
+		return nil
+	}
+	if slot, ok := a.Slot(key); ok {
+		return &slot
+	}
+	return nil
+}
+
+// Slots lists the statically placed words of the layout in layout order,
+// static arrays up to maxLayoutSlots words each.
+func (a *StorageAnnotator) Slots() []common.Hash {
+	return a.words
+}
+
+// DataSlots lists the words of the dynamic arrays and long byte strings of
+// the layout, each up to maxLayoutSlots words. The length of each is read
+// from every reader and the longest taken, so data that shrank between two
+// states is still covered.
+func (a *StorageAnnotator) DataSlots(readers ...*StorageReader) ([]common.Hash, error) {
+	var slots []common.Hash
+	for _, region := range a.regions {
+		if region.length != nil {
+			continue
+		}
+		words := new(big.Int)
+		for _, reader := range readers {
+			word, err := reader.Word(region.slot)
+			if err != nil {
+				return nil, err
+			}
+			if n := region.dataWords(word); n.Cmp(words) > 0 {
+				words = n
+			}
+		}
+		for i := int64(0); i < maxLayoutSlots && big.NewInt(i).Cmp(words) < 0; i++ {
+			slots = append(slots, common.BigToHash(new(big.Int).Add(region.start, big.NewInt(i))))
+		}
+	}
+	return slots, nil
+}
+
+func (a *StorageAnnotator) add(label string, base common.Hash, entry StorageLayoutEntry) error {
+	slot, err := parseLayoutSlot(entry.Slot)
+	if err != nil {
+		return err
+	}
+	typ, err := a.layout.typeOf(entry.Type)
+	if err != nil {
+		return err
+	}
+	return a.addVariable(label, addSlot(base, slot.Big()), typ)
+}
+
+func (a *StorageAnnotator) addVariable(label string, slot common.Hash, typ *StorageLayoutType) error {
+	switch {
+	case typ.Encoding == "mapping":
+		// Entries sit at keccak256(key . slot), the slot itself stays empty
+		return nil
+
+	case typ.Encoding == "bytes":
+		a.addWord(slot, label)
+		a.regions = append(a.regions, storageRegion{label: label, slot: slot, start: crypto.Keccak256Hash(slot.Bytes()).Big()})
+
+	case typ.Encoding == "dynamic_array":
+		a.addWord(slot, label+".length")
+		base, size, err := a.element(typ)
+		if err != nil {
+			return err
+		}
+		a.regions = append(a.regions, storageRegion{label: label, slot: slot, start: crypto.Keccak256Hash(slot.Bytes()).Big(), base: base, size: size})
+
+	case len(typ.Members) > 0:
+		for _, member := range typ.Members {
+			if err := a.add(label+"."+member.Label, slot, member); err != nil {
+				return err
+			}
+		}
+
+	case typ.Base != "":
+		length, err := staticArrayLength(typ)
+		if err != nil {
+			return err
+		}
+		base, size, err := a.element(typ)
+		if err != nil {
+			return err
+		}
+		region := storageRegion{label: label, start: slot.Big(), length: length, base: base, size: size}
+		a.regions = append(a.regions, region)
+		words := region.words()
+		for i := int64(0); i < maxLayoutSlots && big.NewInt(i).Cmp(words) < 0; i++ {
+			word := addSlot(slot, big.NewInt(i))
+			a.words = append(a.words, word)
+			a.hashed[crypto.Keccak256Hash(word.Bytes())] = word
+		}
+
+	default:
+		a.addWord(slot, label)
+	}
+	return nil
+}
+
+func (a *StorageAnnotator) addWord(slot common.Hash, label string) {
+	if _, ok := a.labels[slot]; !ok {
+		a.words = append(a.words, slot)
+	}
+	a.labels[slot] = append(a.labels[slot], label)
+	a.hashed[crypto.Keccak256Hash(slot.Bytes())] = slot
+}
+
+func (a *StorageAnnotator) element(array *StorageLayoutType) (*StorageLayoutType, int, error) {
+	base, err := a.layout.typeOf(array.Base)
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := layoutSize(base)
+	if err != nil {
+		return nil, 0, err
+	}
+	return base, size, nil
+}
+
+// words is how many slots the region spans, elements of up to 16 bytes
+// sharing a slot.
+func (r *storageRegion) words() *big.Int {
+	if r.length == nil {
+		return maxRegionWords
+	}
+	if r.size <= 16 {
+		perSlot := big.NewInt(int64(32 / r.size))
+		words := new(big.Int).Add(r.length, perSlot)
+		return words.Sub(words, common.Big1).Div(words, perSlot)
+	}
+	return new(big.Int).Mul(r.length, big.NewInt(int64((r.size+31)/32)))
+}
+
+// dataWords is how many slots the data of a dynamic region spans given the
+// word at its slot: the length of an array, or of a long byte string as
+// length*2+1.
+func (r *storageRegion) dataWords(word common.Hash) *big.Int {
+	if r.base == nil {
+		if word[common.HashLength-1]&1 == 0 {
+			return new(big.Int)
+		}
+		length := new(big.Int).Rsh(word.Big(), 1)
+		return length.Add(length, big.NewInt(31)).Div(length, big.NewInt(32))
+	}
+	sized := *r
+	sized.length = word.Big()
+	return sized.words()
+}
+
+// labels names slot when it falls in the region: the elements packed into
+// it, or the struct members of the element it is a word of.
+func (r *storageRegion) labels(layout *StorageLayout, slot *big.Int) []string {
+	word := new(big.Int).Sub(slot, r.start)
+	if word.Sign() < 0 || word.Cmp(r.words()) >= 0 {
+		return nil
+	}
+
+	if r.base == nil {
+		return []string{fmt.Sprintf("%s (data word %s)", r.label, word)}
+	}
+	if r.size <= 16 {
+		perSlot := big.NewInt(int64(32 / r.size))
+		first := new(big.Int).Mul(word, perSlot)
+		last := new(big.Int).Add(first, perSlot)
+		last.Sub(last, common.Big1)
+		if r.length != nil && last.Cmp(r.length) >= 0 {
+			last.Sub(r.length, common.Big1)
+		}
+		if first.Cmp(last) == 0 {
+			return []string{fmt.Sprintf("%s[%s]", r.label, first)}
+		}
+		return []string{fmt.Sprintf("%s[%s..%s]", r.label, first, last)}
+	}
+
+	index, within := new(big.Int).DivMod(word, big.NewInt(int64((r.size+31)/32)), new(big.Int))
+	element := fmt.Sprintf("%s[%s]", r.label, index)
+	var labels []string
+	for _, member := range r.base.Members {
+		memberSlot, err := parseLayoutSlot(member.Slot)
+		if err != nil {
+			continue
+		}
+		memberType, err := layout.typeOf(member.Type)
+		if err != nil {
+			continue
+		}
+		words := int64(1)
+		if memberType.Encoding == "inplace" {
+			if size, err := layoutSize(memberType); err == nil {
+				words = int64((size + 31) / 32)
+			}
+		}
+		offset := new(big.Int).Sub(within, memberSlot.Big())
+		if offset.Sign() >= 0 && offset.Cmp(big.NewInt(words)) < 0 {
+			labels = append(labels, element+"."+member.Label)
+		}
+	}
+	if len(labels) == 0 {
+		labels = append(labels, element)
+	}
+	return labels
+}
+
+// parseStorageDumpPaging reads the start key and page size of storage-dump.
+func parseStorageDumpPaging(params *GetStorageDumpRequestParams) (common.Hash, int, error) {
+	var start common.Hash
+	if params.StartKey != "" {
+		key, err := hexutil.Decode(params.StartKey)
+		if err != nil || len(key) != common.HashLength {
+			return common.Hash{}, 0, utils.ErrMalformedRequest(fmt.Sprintf("invalid start-key %q, expected the 32-byte next-key of a previous page", params.StartKey))
+		}
+		start = common.BytesToHash(key)
+	}
+
+	limit := defaultStorageDumpLimit
+	if params.Limit != "" {
+		n, err := strconv.Atoi(params.Limit)
+		if err != nil || n <= 0 {
+			return common.Hash{}, 0, utils.ErrMalformedRequest(fmt.Sprintf("invalid limit %q", params.Limit))
+		}
+		limit = n
+	}
+	if limit > maxStorageDumpLimit {
+		limit = maxStorageDumpLimit
+	}
+	return start, limit, nil
+}
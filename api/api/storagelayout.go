@@ -0,0 +1,741 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	utils "generic-evm-api-go/api/pkg/utils"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// maxLayoutSlots caps the storage words one variable may decode from, so a
+// large array or string has to be read element by element.
+const maxLayoutSlots = 1024
+
+// StorageLayout is the storageLayout output of solc: the state variables of
+// a contract and the types they refer to by id.
+type StorageLayout struct {
+	Storage []StorageLayoutEntry         `json:"storage"`
+	Types   map[string]StorageLayoutType `json:"types"`
+}
+
+// StorageLayoutEntry is a state variable or struct member at slot (decimal,
+// relative to the struct for members) and byte offset within it.
+type StorageLayoutEntry struct {
+	Label  string `json:"label"`
+	Offset int    `json:"offset"`
+	Slot   string `json:"slot"`
+	Type   string `json:"type"`
+}
+
+// StorageLayoutType describes a type of the layout. Encoding is inplace,
+// mapping, dynamic_array or bytes.
+type StorageLayoutType struct {
+	Encoding      string               `json:"encoding"`
+	Label         string               `json:"label"`
+	NumberOfBytes string               `json:"numberOfBytes"`
+	Key           string               `json:"key,omitempty"`
+	Value         string               `json:"value,omitempty"`
+	Base          string               `json:"base,omitempty"`
+	Members       []StorageLayoutEntry `json:"members,omitempty"`
+}
+
+// StorageLocation is where a value lives: the slot its first word is in, the
+// byte offset from the right of that word and its layout type id. Indexes
+// are the dynamic array indexes taken on the way, which CheckIndexes bounds
+// against the stored lengths.
+type StorageLocation struct {
+	Slot    common.Hash
+	Offset  int
+	Type    string
+	Indexes []StorageIndex
+}
+
+// StorageIndex is an index into the dynamic array whose length is at
+// LengthSlot.
+type StorageIndex struct {
+	Array      string
+	LengthSlot common.Hash
+	Index      *big.Int
+}
+
+// ParseStorageLayout reads a solc storage layout, given on its own or as the
+// storageLayout field of a build artifact.
+func ParseStorageLayout(data []byte) (*StorageLayout, error) {
+	if rawLayout := extractArtifactStorageLayout(data); rawLayout != nil {
+		data = rawLayout
+	}
+
+	var layout StorageLayout
+	if err := json.Unmarshal(data, &layout); err != nil {
+		return nil, fmt.Errorf("invalid storage layout: %v", err)
+	}
+	if layout.Storage == nil || (len(layout.Storage) > 0 && layout.Types == nil) {
+		return nil, fmt.Errorf("invalid storage layout: expected storage and types")
+	}
+	return &layout, nil
+}
+
+func (l *StorageLayout) typeOf(id string) (*StorageLayoutType, error) {
+	typ, ok := l.Types[id]
+	if !ok {
+		return nil, fmt.Errorf("storage layout has no type %s", id)
+	}
+	return &typ, nil
+}
+
+// storagePathStep is one .member or [key] step of a variable path.
+type storagePathStep struct {
+	Member string
+	Key    string
+}
+
+// parseStoragePath splits a path like balances[0xabc], config.fee or
+// allowance[0xa]["0xb"] into the variable name and its steps.
+func parseStoragePath(path string) (string, []storagePathStep, error) {
+	path = strings.TrimSpace(path)
+	end := 0
+	for end < len(path) && path[end] != '.' && path[end] != '[' {
+		end++
+	}
+	name := strings.TrimSpace(path[:end])
+	if name == "" {
+		return "", nil, fmt.Errorf("invalid variable path %q", path)
+	}
+
+	var steps []storagePathStep
+	for i := end; i < len(path); {
+		switch path[i] {
+		case '.':
+			j := i + 1
+			for j < len(path) && path[j] != '.' && path[j] != '[' {
+				j++
+			}
+			member := strings.TrimSpace(path[i+1 : j])
+			if member == "" {
+				return "", nil, fmt.Errorf("invalid variable path %q: empty member", path)
+			}
+			steps = append(steps, storagePathStep{Member: member})
+			i = j
+		case '[':
+			j := i + 1
+			for j < len(path) && path[j] == ' ' {
+				j++
+			}
+			if j < len(path) && (path[j] == '"' || path[j] == '\'') {
+				quote := path[j]
+				k := strings.IndexByte(path[j+1:], quote)
+				if k == -1 {
+					return "", nil, fmt.Errorf("invalid variable path %q: unterminated string key", path)
+				}
+				key := path[j+1 : j+1+k]
+				j = j + 1 + k + 1
+				for j < len(path) && path[j] == ' ' {
+					j++
+				}
+				if j >= len(path) || path[j] != ']' {
+					return "", nil, fmt.Errorf("invalid variable path %q: expected ]", path)
+				}
+				steps = append(steps, storagePathStep{Key: key})
+				i = j + 1
+				continue
+			}
+			k := strings.IndexByte(path[i:], ']')
+			if k == -1 {
+				return "", nil, fmt.Errorf("invalid variable path %q: expected ]", path)
+			}
+			key := strings.TrimSpace(path[i+1 : i+k])
+			if key == "" {
+				return "", nil, fmt.Errorf("invalid variable path %q: empty key", path)
+			}
+			steps = append(steps, storagePathStep{Key: key})
+			i += k + 1
+		default:
+			return "", nil, fmt.Errorf("invalid variable path %q at %q", path, path[i:])
+		}
+	}
+	return name, steps, nil
+}
+
+// Locate computes the storage location of a variable path: struct members
+// add their slot and offset, mapping keys hash into keccak256(key . slot),
+// and array indexes step through the elements from the array's slot, or from
+// keccak256(slot) for dynamic arrays. Static array indexes are checked here,
+// dynamic ones are kept in the location for CheckIndexes.
+func (l *StorageLayout) Locate(path string) (*StorageLocation, error) {
+	name, steps, err := parseStoragePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var location *StorageLocation
+	for _, entry := range l.Storage {
+		if entry.Label == name {
+			slot, err := parseLayoutSlot(entry.Slot)
+			if err != nil {
+				return nil, err
+			}
+			location = &StorageLocation{Slot: slot, Offset: entry.Offset, Type: entry.Type}
+			break
+		}
+	}
+	if location == nil {
+		return nil, fmt.Errorf("storage layout has no variable %s", name)
+	}
+
+	var indexes []StorageIndex
+	walked := name
+	for _, step := range steps {
+		typ, err := l.typeOf(location.Type)
+		if err != nil {
+			return nil, err
+		}
+
+		if step.Member != "" {
+			if len(typ.Members) == 0 {
+				return nil, fmt.Errorf("%s is not a struct, it has no member %s", typ.Label, step.Member)
+			}
+			var member *StorageLayoutEntry
+			for i := range typ.Members {
+				if typ.Members[i].Label == step.Member {
+					member = &typ.Members[i]
+					break
+				}
+			}
+			if member == nil {
+				return nil, fmt.Errorf("%s has no member %s", typ.Label, step.Member)
+			}
+			slot, err := parseLayoutSlot(member.Slot)
+			if err != nil {
+				return nil, err
+			}
+			location = &StorageLocation{Slot: addSlot(location.Slot, slot.Big()), Offset: member.Offset, Type: member.Type}
+			walked += "." + step.Member
+			continue
+		}
+
+		switch {
+		case typ.Encoding == "mapping":
+			keyType, err := l.typeOf(typ.Key)
+			if err != nil {
+				return nil, err
+			}
+			key, err := encodeLayoutKey(keyType, step)
+			if err != nil {
+				return nil, err
+			}
+			location = &StorageLocation{Slot: MappingSlot(key, location.Slot), Type: typ.Value}
+
+		case typ.Encoding == "dynamic_array":
+			index, err := parseLayoutIndex(step)
+			if err != nil {
+				return nil, err
+			}
+			indexes = append(indexes, StorageIndex{Array: walked, LengthSlot: location.Slot, Index: index})
+			location, err = l.element(typ, crypto.Keccak256Hash(location.Slot.Bytes()), index)
+			if err != nil {
+				return nil, err
+			}
+
+		case typ.Base != "":
+			index, err := parseLayoutIndex(step)
+			if err != nil {
+				return nil, err
+			}
+			length, err := staticArrayLength(typ)
+			if err != nil {
+				return nil, err
+			}
+			if index.Cmp(length) >= 0 {
+				return nil, fmt.Errorf("index %s out of range for %s", index, typ.Label)
+			}
+			location, err = l.element(typ, location.Slot, index)
+			if err != nil {
+				return nil, err
+			}
+
+		default:
+			return nil, fmt.Errorf("%s cannot be indexed", typ.Label)
+		}
+		walked += "[" + step.Key + "]"
+	}
+	location.Indexes = indexes
+	return location, nil
+}
+
+// CheckIndexes reads the length of every dynamic array location indexes into
+// and fails when an index is past it, where the slot would read as zero.
+func CheckIndexes(reader *StorageReader, location *StorageLocation) error {
+	slots := make([]common.Hash, len(location.Indexes))
+	for i, index := range location.Indexes {
+		slots[i] = index.LengthSlot
+	}
+	if err := reader.Prefetch(slots); err != nil {
+		return err
+	}
+	for _, index := range location.Indexes {
+		length, err := reader.Word(index.LengthSlot)
+		if err != nil {
+			return err
+		}
+		if index.Index.Cmp(length.Big()) >= 0 {
+			return utils.ErrMalformedRequest(fmt.Sprintf("index %s out of range for %s of length %s", index.Index, index.Array, length.Big()))
+		}
+	}
+	return nil
+}
+
+// element locates element index of an array whose data starts at slot.
+func (l *StorageLayout) element(array *StorageLayoutType, slot common.Hash, index *big.Int) (*StorageLocation, error) {
+	base, err := l.typeOf(array.Base)
+	if err != nil {
+		return nil, err
+	}
+	size, err := layoutSize(base)
+	if err != nil {
+		return nil, err
+	}
+	elementSlot, offset := ArrayElementSlot(slot, index, size)
+	return &StorageLocation{Slot: elementSlot, Offset: offset, Type: array.Base}, nil
+}
+
+func parseLayoutSlot(value string) (common.Hash, error) {
+	slot, ok := new(big.Int).SetString(value, 10)
+	if !ok || slot.Sign() < 0 || slot.Cmp(abi.MaxUint256) > 0 {
+		return common.Hash{}, fmt.Errorf("storage layout has an invalid slot %q", value)
+	}
+	return common.BigToHash(slot), nil
+}
+
+func parseLayoutIndex(step storagePathStep) (*big.Int, error) {
+	index, err := parseBigInt(step.Key)
+	if err != nil || index.Sign() < 0 {
+		return nil, fmt.Errorf("invalid array index %q", step.Key)
+	}
+	return index, nil
+}
+
+func layoutSize(typ *StorageLayoutType) (int, error) {
+	size, err := strconv.Atoi(typ.NumberOfBytes)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("storage layout type %s has an invalid size %q", typ.Label, typ.NumberOfBytes)
+	}
+	return size, nil
+}
+
+// staticArrayLength reads the outer length of a static array from its label,
+// e.g. 3 for uint8[2][3].
+func staticArrayLength(typ *StorageLayoutType) (*big.Int, error) {
+	start := strings.LastIndexByte(typ.Label, '[')
+	if start == -1 || !strings.HasSuffix(typ.Label, "]") {
+		return nil, fmt.Errorf("%s is not a static array", typ.Label)
+	}
+	length, ok := new(big.Int).SetString(typ.Label[start+1:len(typ.Label)-1], 10)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a static array", typ.Label)
+	}
+	return length, nil
+}
+
+// staticArrayCount is the length of a static array about to be decoded. The
+// label it is read from is caller-supplied, so it has to be within
+// maxLayoutSlots and fill exactly the bytes the layout gives the array.
+func (l *StorageLayout) staticArrayCount(typ *StorageLayoutType) (int, error) {
+	length, err := staticArrayLength(typ)
+	if err != nil {
+		return 0, err
+	}
+	if length.Sign() <= 0 || length.Cmp(big.NewInt(maxLayoutSlots)) > 0 {
+		return 0, utils.ErrMalformedRequest(fmt.Sprintf("%s has %s elements, read them by index", typ.Label, length))
+	}
+	base, err := l.typeOf(typ.Base)
+	if err != nil {
+		return 0, err
+	}
+	size, err := layoutSize(base)
+	if err != nil {
+		return 0, err
+	}
+	arraySize, err := layoutSize(typ)
+	if err != nil {
+		return 0, err
+	}
+	count := int(length.Int64())
+	if arrayWords(count, size)*32 != arraySize {
+		return 0, utils.ErrMalformedRequest(fmt.Sprintf("storage layout type %s has %d elements but is %d bytes", typ.Label, count, arraySize))
+	}
+	return count, nil
+}
+
+// arrayWords is the number of slots count elements of size bytes take, packed
+// into shared slots when up to 16 bytes each.
+func arrayWords(count, size int) int {
+	if size <= 16 {
+		return (count + 32/size - 1) / (32 / size)
+	}
+	return count * ((size + 31) / 32)
+}
+
+// layoutAbiType maps an elementary layout type onto the ABI type its value
+// decodes as. Contracts are addresses and enums the smallest uint holding
+// them; user-defined value types and function types have none.
+func layoutAbiType(typ *StorageLayoutType) (abi.Type, bool) {
+	label := typ.Label
+	switch {
+	case label == "address payable", strings.HasPrefix(label, "contract "):
+		label = "address"
+	case strings.HasPrefix(label, "enum "):
+		size, err := layoutSize(typ)
+		if err != nil {
+			return abi.Type{}, false
+		}
+		label = fmt.Sprintf("uint%d", size*8)
+	}
+	if strings.ContainsAny(label, " ([") {
+		return abi.Type{}, false
+	}
+	abiType, err := ParseAbiType(label)
+	if err != nil {
+		return abi.Type{}, false
+	}
+	switch abiType.T {
+	case abi.UintTy, abi.IntTy, abi.AddressTy, abi.BoolTy, abi.FixedBytesTy:
+		return abiType, true
+	}
+	return abi.Type{}, false
+}
+
+// encodeLayoutKey encodes a mapping key the way solc hashes it.
+func encodeLayoutKey(keyType *StorageLayoutType, step storagePathStep) ([]byte, error) {
+	if keyType.Encoding == "bytes" {
+		if keyType.Label == "string" {
+			return []byte(step.Key), nil
+		}
+		key, err := hexutil.Decode(step.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bytes key %q: %v", step.Key, err)
+		}
+		return key, nil
+	}
+
+	abiType, ok := layoutAbiType(keyType)
+	if !ok {
+		return nil, fmt.Errorf("unsupported mapping key type %s", keyType.Label)
+	}
+	return EncodeMappingKey(abiType, step.Key)
+}
+
+// StorageReader reads the storage words of one contract at one block,
+// fetching missing words in JSON-RPC batches and keeping them for reuse.
+type StorageReader struct {
+	client  *ethclient.Client
+	address common.Address
+	block   *BlockRef
+	words   map[common.Hash]common.Hash
+}
+
+func NewStorageReader(client *ethclient.Client, address common.Address, block *BlockRef) *StorageReader {
+	return &StorageReader{
+		client:  client,
+		address: address,
+		block:   block,
+		words:   make(map[common.Hash]common.Hash),
+	}
+}
+
+// Prefetch reads every slot not read yet.
+func (s *StorageReader) Prefetch(slots []common.Hash) error {
+	var missing []common.Hash
+	for _, slot := range slots {
+		if _, ok := s.words[slot]; !ok {
+			missing = append(missing, slot)
+		}
+	}
+
+	for start := 0; start < len(missing); start += rpcBatchMaxSize {
+		end := min(start+rpcBatchMaxSize, len(missing))
+		values := make([]hexutil.Bytes, end-start)
+		batch := make([]rpc.BatchElem, end-start)
+		for i := range batch {
+			batch[i] = rpc.BatchElem{
+				Method: "eth_getStorageAt",
+				Args:   []interface{}{s.address, missing[start+i], s.block.rpcArg()},
+				Result: &values[i],
+			}
+		}
+		if err := s.client.Client().BatchCallContext(context.Background(), batch); err != nil {
+			return fmt.Errorf("failed to get storage: %v", err)
+		}
+		for i, elem := range batch {
+			if elem.Error != nil {
+				return fmt.Errorf("failed to get storage at %s: %v", missing[start+i].Hex(), elem.Error)
+			}
+			s.words[missing[start+i]] = common.BytesToHash(values[i])
+		}
+	}
+	return nil
+}
+
+// Word returns the storage word at slot.
+func (s *StorageReader) Word(slot common.Hash) (common.Hash, error) {
+	if err := s.Prefetch([]common.Hash{slot}); err != nil {
+		return common.Hash{}, err
+	}
+	return s.words[slot], nil
+}
+
+// budgetReader reads the slots of one variable through a StorageReader and
+// fails once they add up to more than maxLayoutSlots distinct slots, however
+// deeply its arrays nest.
+type budgetReader struct {
+	*StorageReader
+	spent map[common.Hash]bool
+}
+
+func newBudgetReader(reader *StorageReader) *budgetReader {
+	return &budgetReader{StorageReader: reader, spent: make(map[common.Hash]bool)}
+}
+
+func (b *budgetReader) spend(slots []common.Hash) error {
+	for _, slot := range slots {
+		b.spent[slot] = true
+	}
+	if len(b.spent) > maxLayoutSlots {
+		return utils.ErrMalformedRequest(fmt.Sprintf("value spans more than %d slots, read it by member or index", maxLayoutSlots))
+	}
+	return nil
+}
+
+// Prefetch reads every slot not read yet, charging them to the budget.
+func (b *budgetReader) Prefetch(slots []common.Hash) error {
+	if err := b.spend(slots); err != nil {
+		return err
+	}
+	return b.StorageReader.Prefetch(slots)
+}
+
+// Word returns the storage word at slot, charging it to the budget.
+func (b *budgetReader) Word(slot common.Hash) (common.Hash, error) {
+	if err := b.spend([]common.Hash{slot}); err != nil {
+		return common.Hash{}, err
+	}
+	return b.StorageReader.Word(slot)
+}
+
+// DecodeStorageValue reads and decodes the value at location. Elementary
+// values are formatted like ABI values, strings and bytes are joined from
+// their slots, structs become objects keyed by member and arrays lists.
+// Mappings cannot be read whole and need a key, and a value may span at most
+// maxLayoutSlots slots.
+func (l *StorageLayout) DecodeStorageValue(storage *StorageReader, location *StorageLocation) (interface{}, error) {
+	reader := newBudgetReader(storage)
+	typ, err := l.typeOf(location.Type)
+	if err != nil {
+		return nil, err
+	}
+	if typ.Encoding == "inplace" {
+		size, err := layoutSize(typ)
+		if err != nil {
+			return nil, err
+		}
+		if err := prefetchSlots(reader, location.Slot, (size+31)/32); err != nil {
+			return nil, err
+		}
+	}
+	return l.decode(reader, location, typ)
+}
+
+func (l *StorageLayout) decode(reader *budgetReader, location *StorageLocation, typ *StorageLayoutType) (interface{}, error) {
+	switch typ.Encoding {
+	case "mapping":
+		return nil, utils.ErrMalformedRequest(fmt.Sprintf("%s cannot be read whole, give a key like name[key]", typ.Label))
+
+	case "bytes":
+		return decodeStorageBytes(reader, location.Slot, typ.Label == "string")
+
+	case "dynamic_array":
+		word, err := reader.Word(location.Slot)
+		if err != nil {
+			return nil, err
+		}
+		length := word.Big()
+		if length.Sign() == 0 {
+			return []interface{}{}, nil
+		}
+		base, err := l.typeOf(typ.Base)
+		if err != nil {
+			return nil, err
+		}
+		size, err := layoutSize(base)
+		if err != nil {
+			return nil, err
+		}
+		if length.Cmp(big.NewInt(maxLayoutSlots)) > 0 {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("%s has %s elements, read them by index", typ.Label, length))
+		}
+		count := int(length.Int64())
+		words := arrayWords(count, size)
+		if words > maxLayoutSlots {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("%s spans %d slots, read it by index", typ.Label, words))
+		}
+		data := crypto.Keccak256Hash(location.Slot.Bytes())
+		if err := prefetchSlots(reader, data, words); err != nil {
+			return nil, err
+		}
+		return l.decodeElements(reader, typ, data, count)
+
+	case "inplace":
+		if len(typ.Members) > 0 {
+			fields := make(map[string]interface{}, len(typ.Members))
+			for _, member := range typ.Members {
+				slot, err := parseLayoutSlot(member.Slot)
+				if err != nil {
+					return nil, err
+				}
+				memberType, err := l.typeOf(member.Type)
+				if err != nil {
+					return nil, err
+				}
+				value, err := l.decode(reader, &StorageLocation{Slot: addSlot(location.Slot, slot.Big()), Offset: member.Offset, Type: member.Type}, memberType)
+				if err != nil {
+					return nil, err
+				}
+				fields[member.Label] = value
+			}
+			return fields, nil
+		}
+		if typ.Base != "" {
+			count, err := l.staticArrayCount(typ)
+			if err != nil {
+				return nil, err
+			}
+			return l.decodeElements(reader, typ, location.Slot, count)
+		}
+		return decodeStorageElementary(reader, location, typ)
+	}
+	return nil, fmt.Errorf("unsupported storage encoding %q of %s", typ.Encoding, typ.Label)
+}
+
+func (l *StorageLayout) decodeElements(reader *budgetReader, array *StorageLayoutType, slot common.Hash, count int) (interface{}, error) {
+	base, err := l.typeOf(array.Base)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]interface{}, count)
+	for i := range items {
+		element, err := l.element(array, slot, big.NewInt(int64(i)))
+		if err != nil {
+			return nil, err
+		}
+		if items[i], err = l.decode(reader, element, base); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// decodeStorageElementary unpacks a value of up to 32 bytes from its offset
+// in the word and formats it like an ABI value, or as hex when the type has
+// no ABI equivalent.
+func decodeStorageElementary(reader *budgetReader, location *StorageLocation, typ *StorageLayoutType) (interface{}, error) {
+	size, err := layoutSize(typ)
+	if err != nil {
+		return nil, err
+	}
+	if location.Offset+size > 32 {
+		return nil, fmt.Errorf("%s at offset %d does not fit its slot", typ.Label, location.Offset)
+	}
+	word, err := reader.Word(location.Slot)
+	if err != nil {
+		return nil, err
+	}
+	raw := word[32-location.Offset-size : 32-location.Offset]
+
+	abiType, ok := layoutAbiType(typ)
+	if !ok {
+		return hexutil.Encode(raw), nil
+	}
+	encoded := make([]byte, 32)
+	switch {
+	case abiType.T == abi.FixedBytesTy:
+		copy(encoded, raw)
+	case abiType.T == abi.IntTy && raw[0]&0x80 != 0:
+		for i := range encoded {
+			encoded[i] = 0xff
+		}
+		copy(encoded[32-size:], raw)
+	default:
+		copy(encoded[32-size:], raw)
+	}
+	decoded, err := DecodeAbiValues(abi.Arguments{{Type: abiType}}, encoded)
+	if err != nil {
+		return hexutil.Encode(raw), nil
+	}
+	return decoded[0], nil
+}
+
+// decodeStorageBytes reads a string or bytes value. Up to 31 bytes are kept
+// in the slot itself with length*2 in the lowest byte; longer values store
+// length*2+1 there and their data from keccak256(slot) on.
+func decodeStorageBytes(reader *budgetReader, slot common.Hash, text bool) (interface{}, error) {
+	word, err := reader.Word(slot)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if word[31]&1 == 0 {
+		length := int(word[31]) / 2
+		if length > 31 {
+			return nil, fmt.Errorf("invalid short string length %d at slot %s", length, slot.Hex())
+		}
+		data = append(data, word[:length]...)
+	} else {
+		length := new(big.Int).Rsh(word.Big(), 1)
+		if length.Cmp(big.NewInt(maxLayoutSlots*32)) > 0 {
+			return nil, fmt.Errorf("value at slot %s is %s bytes long, over the %d byte limit", slot.Hex(), length, maxLayoutSlots*32)
+		}
+		size := int(length.Int64())
+		start := crypto.Keccak256Hash(slot.Bytes())
+		words := (size + 31) / 32
+		if err := prefetchSlots(reader, start, words); err != nil {
+			return nil, err
+		}
+		for i := 0; i < words; i++ {
+			chunk, err := reader.Word(addSlot(start, big.NewInt(int64(i))))
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, chunk.Bytes()...)
+		}
+		data = data[:size]
+	}
+
+	if text && utf8.Valid(data) {
+		return string(data), nil
+	}
+	return hexutil.Encode(data), nil
+}
+
+// prefetchSlots reads count consecutive slots from slot in one go.
+func prefetchSlots(reader *budgetReader, slot common.Hash, count int) error {
+	if count > maxLayoutSlots {
+		return utils.ErrMalformedRequest(fmt.Sprintf("value spans %d slots, over the %d slot limit", count, maxLayoutSlots))
+	}
+	slots := make([]common.Hash, count)
+	for i := range slots {
+		slots[i] = addSlot(slot, big.NewInt(int64(i)))
+	}
+	return reader.Prefetch(slots)
+}
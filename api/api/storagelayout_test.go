@@ -0,0 +1,385 @@
+package handler
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	utils "generic-evm-api-go/api/pkg/utils"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// testLayout is the solc storage layout of
+//
+//	contract C {
+//		struct Config { uint16 fee; uint256 cap; }
+//		address owner;
+//		bool paused;
+//		mapping(address => uint256) balances;
+//		string name;
+//		address[] owners;
+//		Config config;
+//		uint128[4] limits;
+//		mapping(string => uint256) ids;
+//		uint256[][] nested;
+//	}
+const testLayout = `{
+	"storage": [
+		{"astId": 3, "contract": "C.sol:C", "label": "owner", "offset": 0, "slot": "0", "type": "t_address"},
+		{"astId": 5, "contract": "C.sol:C", "label": "paused", "offset": 20, "slot": "0", "type": "t_bool"},
+		{"astId": 9, "contract": "C.sol:C", "label": "balances", "offset": 0, "slot": "1", "type": "t_mapping(t_address,t_uint256)"},
+		{"astId": 11, "contract": "C.sol:C", "label": "name", "offset": 0, "slot": "2", "type": "t_string_storage"},
+		{"astId": 14, "contract": "C.sol:C", "label": "owners", "offset": 0, "slot": "3", "type": "t_array(t_address)dyn_storage"},
+		{"astId": 17, "contract": "C.sol:C", "label": "config", "offset": 0, "slot": "4", "type": "t_struct(Config)8_storage"},
+		{"astId": 21, "contract": "C.sol:C", "label": "limits", "offset": 0, "slot": "6", "type": "t_array(t_uint128)4_storage"},
+		{"astId": 25, "contract": "C.sol:C", "label": "ids", "offset": 0, "slot": "8", "type": "t_mapping(t_string_memory_ptr,t_uint256)"},
+		{"astId": 29, "contract": "C.sol:C", "label": "nested", "offset": 0, "slot": "9", "type": "t_array(t_array(t_uint256)dyn_storage)dyn_storage"}
+	],
+	"types": {
+		"t_address": {"encoding": "inplace", "label": "address", "numberOfBytes": "20"},
+		"t_bool": {"encoding": "inplace", "label": "bool", "numberOfBytes": "1"},
+		"t_uint16": {"encoding": "inplace", "label": "uint16", "numberOfBytes": "2"},
+		"t_uint128": {"encoding": "inplace", "label": "uint128", "numberOfBytes": "16"},
+		"t_uint256": {"encoding": "inplace", "label": "uint256", "numberOfBytes": "32"},
+		"t_string_storage": {"encoding": "bytes", "label": "string", "numberOfBytes": "32"},
+		"t_string_memory_ptr": {"encoding": "bytes", "label": "string", "numberOfBytes": "32"},
+		"t_mapping(t_address,t_uint256)": {"encoding": "mapping", "key": "t_address", "label": "mapping(address => uint256)", "numberOfBytes": "32", "value": "t_uint256"},
+		"t_mapping(t_string_memory_ptr,t_uint256)": {"encoding": "mapping", "key": "t_string_memory_ptr", "label": "mapping(string => uint256)", "numberOfBytes": "32", "value": "t_uint256"},
+		"t_array(t_address)dyn_storage": {"base": "t_address", "encoding": "dynamic_array", "label": "address[]", "numberOfBytes": "32"},
+		"t_array(t_uint256)dyn_storage": {"base": "t_uint256", "encoding": "dynamic_array", "label": "uint256[]", "numberOfBytes": "32"},
+		"t_array(t_array(t_uint256)dyn_storage)dyn_storage": {"base": "t_array(t_uint256)dyn_storage", "encoding": "dynamic_array", "label": "uint256[][]", "numberOfBytes": "32"},
+		"t_array(t_uint128)4_storage": {"base": "t_uint128", "encoding": "inplace", "label": "uint128[4]", "numberOfBytes": "64"},
+		"t_struct(Config)8_storage": {"encoding": "inplace", "label": "struct C.Config", "numberOfBytes": "64", "members": [
+			{"astId": 5, "contract": "C.sol:C", "label": "fee", "offset": 0, "slot": "0", "type": "t_uint16"},
+			{"astId": 7, "contract": "C.sol:C", "label": "cap", "offset": 0, "slot": "1", "type": "t_uint256"}
+		]}
+	}
+}`
+
+func mustTestLayout(t *testing.T) *StorageLayout {
+	t.Helper()
+	layout, err := ParseStorageLayout([]byte(testLayout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layout
+}
+
+// memoryStorage is a StorageReader over the given words, which has to be
+// every word the test reads as it has no client to fetch others with.
+func memoryStorage(words map[common.Hash]common.Hash) *StorageReader {
+	reader := NewStorageReader(nil, common.Address{}, nil)
+	for slot, word := range words {
+		reader.words[slot] = word
+	}
+	return reader
+}
+
+// errorText is the message of err, the details for API errors.
+func errorText(err error) string {
+	var apiErr utils.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Details
+	}
+	return err.Error()
+}
+
+func slotN(n int64) common.Hash {
+	return common.BigToHash(big.NewInt(n))
+}
+
+func TestStorageLayoutLocate(t *testing.T) {
+	layout := mustTestLayout(t)
+	holder := common.LeftPadBytes(common.FromHex("0xd8da6bf26964af9d7eed9e03e53415d37aa96045"), 32)
+	nestedData := crypto.Keccak256Hash(slotN(9).Bytes())
+	innerArray := addSlot(nestedData, big.NewInt(1))
+
+	tests := []struct {
+		path    string
+		want    StorageLocation
+		wantErr string
+	}{
+		{path: "owner", want: StorageLocation{Slot: slotN(0), Type: "t_address"}},
+		{path: "paused", want: StorageLocation{Slot: slotN(0), Offset: 20, Type: "t_bool"}},
+		{
+			path: "balances[0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045]",
+			want: StorageLocation{Slot: MappingSlot(holder, slotN(1)), Type: "t_uint256"},
+		},
+		{path: `ids["alice"]`, want: StorageLocation{Slot: MappingSlot([]byte("alice"), slotN(8)), Type: "t_uint256"}},
+		{path: "ids[alice]", want: StorageLocation{Slot: MappingSlot([]byte("alice"), slotN(8)), Type: "t_uint256"}},
+		{path: "config.fee", want: StorageLocation{Slot: slotN(4), Type: "t_uint16"}},
+		{path: "config.cap", want: StorageLocation{Slot: slotN(5), Type: "t_uint256"}},
+		{path: "limits[1]", want: StorageLocation{Slot: slotN(6), Offset: 16, Type: "t_uint128"}},
+		{path: "limits[2]", want: StorageLocation{Slot: slotN(7), Type: "t_uint128"}},
+		{
+			path: "owners[2]",
+			want: StorageLocation{
+				Slot:    addSlot(crypto.Keccak256Hash(slotN(3).Bytes()), big.NewInt(2)),
+				Type:    "t_address",
+				Indexes: []StorageIndex{{Array: "owners", LengthSlot: slotN(3), Index: big.NewInt(2)}},
+			},
+		},
+		{
+			path: "nested[1][5]",
+			want: StorageLocation{
+				Slot: addSlot(crypto.Keccak256Hash(innerArray.Bytes()), big.NewInt(5)),
+				Type: "t_uint256",
+				Indexes: []StorageIndex{
+					{Array: "nested", LengthSlot: slotN(9), Index: big.NewInt(1)},
+					{Array: "nested[1]", LengthSlot: innerArray, Index: big.NewInt(5)},
+				},
+			},
+		},
+		{path: "missing", wantErr: "storage layout has no variable missing"},
+		{path: "limits[4]", wantErr: "index 4 out of range for uint128[4]"},
+		{path: "owners[-1]", wantErr: `invalid array index "-1"`},
+		{path: "owner.x", wantErr: "address is not a struct"},
+		{path: "config.nope", wantErr: "struct C.Config has no member nope"},
+		{path: "owner[1]", wantErr: "address cannot be indexed"},
+		{path: "balances[0x12]", wantErr: "invalid address key"},
+		{path: "balances[0x12", wantErr: "expected ]"},
+		{path: "config.", wantErr: "empty member"},
+	}
+	for _, tt := range tests {
+		got, err := layout.Locate(tt.path)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Locate(%q) error = %v, want %q", tt.path, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Locate(%q): %v", tt.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("Locate(%q) = %+v, want %+v", tt.path, *got, tt.want)
+		}
+	}
+}
+
+func TestCheckIndexes(t *testing.T) {
+	layout := mustTestLayout(t)
+	innerArray := addSlot(crypto.Keccak256Hash(slotN(9).Bytes()), big.NewInt(1))
+	storage := memoryStorage(map[common.Hash]common.Hash{
+		slotN(3):   slotN(2), // owners.length
+		slotN(9):   slotN(2), // nested.length
+		innerArray: slotN(5), // nested[1].length
+	})
+
+	tests := []struct {
+		path    string
+		wantErr string
+	}{
+		{path: "owners[1]"},
+		{path: "owners[2]", wantErr: "index 2 out of range for owners of length 2"},
+		{path: "nested[1][4]"},
+		{path: "nested[1][5]", wantErr: "index 5 out of range for nested[1] of length 5"},
+		{path: "limits[3]"},
+	}
+	for _, tt := range tests {
+		location, err := layout.Locate(tt.path)
+		if err != nil {
+			t.Fatalf("Locate(%q): %v", tt.path, err)
+		}
+		err = CheckIndexes(storage, location)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("CheckIndexes(%q): %v", tt.path, err)
+			}
+			continue
+		}
+		var apiErr utils.Error
+		if !errors.As(err, &apiErr) || apiErr.Code != 400 || !strings.Contains(apiErr.Details, tt.wantErr) {
+			t.Errorf("CheckIndexes(%q) error = %v, want a 400 with %q", tt.path, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDecodeStorageBytes(t *testing.T) {
+	slot := slotN(2)
+	data := crypto.Keccak256Hash(slot.Bytes())
+	long := "a string that takes more than one slot"
+
+	// solc keeps up to 31 bytes left aligned in the slot with length*2 in the
+	// lowest byte, longer values store length*2+1 and their data from
+	// keccak256(slot) on
+	tests := []struct {
+		name    string
+		words   map[common.Hash]common.Hash
+		text    bool
+		want    interface{}
+		wantErr string
+	}{
+		{
+			name:  "short string",
+			words: map[common.Hash]common.Hash{slot: common.HexToHash("0x6162630000000000000000000000000000000000000000000000000000000006")},
+			text:  true,
+			want:  "abc",
+		},
+		{
+			name:  "short bytes",
+			words: map[common.Hash]common.Hash{slot: common.HexToHash("0x6162630000000000000000000000000000000000000000000000000000000006")},
+			want:  "0x616263",
+		},
+		{name: "empty string", words: map[common.Hash]common.Hash{slot: {}}, text: true, want: ""},
+		{
+			name: "31 bytes stay in the slot",
+			words: map[common.Hash]common.Hash{
+				slot: common.BytesToHash(append([]byte(strings.Repeat("x", 31)), 62)),
+			},
+			text: true,
+			want: strings.Repeat("x", 31),
+		},
+		{
+			name: "long string",
+			words: map[common.Hash]common.Hash{
+				slot:                         slotN(int64(len(long)*2 + 1)),
+				data:                         common.BytesToHash([]byte(long[:32])),
+				addSlot(data, big.NewInt(1)): common.BytesToHash(common.RightPadBytes([]byte(long[32:]), 32)),
+			},
+			text: true,
+			want: long,
+		},
+		{
+			name:  "string that is not UTF-8",
+			words: map[common.Hash]common.Hash{slot: common.HexToHash("0xff00000000000000000000000000000000000000000000000000000000000002")},
+			text:  true,
+			want:  "0xff",
+		},
+		{
+			name:    "short length past the slot",
+			words:   map[common.Hash]common.Hash{slot: slotN(64)},
+			wantErr: "invalid short string length 32",
+		},
+		{
+			name:    "long length past the limit",
+			words:   map[common.Hash]common.Hash{slot: slotN(2*maxLayoutSlots*32 + 3)},
+			wantErr: "over the 32768 byte limit",
+		},
+	}
+	for _, tt := range tests {
+		got, err := decodeStorageBytes(newBudgetReader(memoryStorage(tt.words)), slot, tt.text)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: decodeStorageBytes = %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeStorageValue(t *testing.T) {
+	layout := mustTestLayout(t)
+	ownersData := crypto.Keccak256Hash(slotN(3).Bytes())
+	storage := memoryStorage(map[common.Hash]common.Hash{
+		// paused and owner packed into slot 0
+		slotN(0):                           common.HexToHash("0x0000000000000000000001d8da6bf26964af9d7eed9e03e53415d37aa96045"),
+		slotN(3):                           slotN(2),
+		ownersData:                         common.HexToHash("0x0000000000000000000000000000000000000000000000000000000000000001"),
+		addSlot(ownersData, big.NewInt(1)): common.HexToHash("0x0000000000000000000000000000000000000000000000000000000000000002"),
+		slotN(4):                           slotN(30),
+		slotN(5):                           slotN(1000),
+		// limits[0] and limits[1], then limits[2] and limits[3]
+		slotN(6): common.HexToHash("0x0000000000000000000000000000000200000000000000000000000000000001"),
+		slotN(7): common.HexToHash("0x0000000000000000000000000000000400000000000000000000000000000003"),
+	})
+
+	tests := []struct {
+		path    string
+		want    interface{}
+		wantErr string
+	}{
+		{path: "owner", want: "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"},
+		{path: "paused", want: true},
+		{path: "owners", want: []interface{}{"0x0000000000000000000000000000000000000001", "0x0000000000000000000000000000000000000002"}},
+		{path: "config", want: map[string]interface{}{"fee": "30", "cap": "1000"}},
+		{path: "limits", want: []interface{}{"1", "2", "3", "4"}},
+		{path: "balances", wantErr: "cannot be read whole"},
+	}
+	for _, tt := range tests {
+		location, err := layout.Locate(tt.path)
+		if err != nil {
+			t.Fatalf("Locate(%q): %v", tt.path, err)
+		}
+		got, err := layout.DecodeStorageValue(storage, location)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(errorText(err), tt.wantErr) {
+				t.Errorf("DecodeStorageValue(%q) error = %v, want %q", tt.path, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("DecodeStorageValue(%q): %v", tt.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("DecodeStorageValue(%q) = %#v, want %#v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeStorageValueStaticArrayLength(t *testing.T) {
+	// Labels that disagree with numberOfBytes, as a hand-edited layout could
+	layout, err := ParseStorageLayout([]byte(`{
+		"storage": [
+			{"astId": 1, "contract": "C.sol:C", "label": "huge", "offset": 0, "slot": "0", "type": "t_array(t_uint256)99999999999_storage"},
+			{"astId": 2, "contract": "C.sol:C", "label": "short", "offset": 0, "slot": "1", "type": "t_array(t_uint256)3_storage"},
+			{"astId": 3, "contract": "C.sol:C", "label": "packed", "offset": 0, "slot": "2", "type": "t_array(t_uint128)3_storage"}
+		],
+		"types": {
+			"t_uint128": {"encoding": "inplace", "label": "uint128", "numberOfBytes": "16"},
+			"t_uint256": {"encoding": "inplace", "label": "uint256", "numberOfBytes": "32"},
+			"t_array(t_uint256)99999999999_storage": {"base": "t_uint256", "encoding": "inplace", "label": "uint256[99999999999]", "numberOfBytes": "32"},
+			"t_array(t_uint256)3_storage": {"base": "t_uint256", "encoding": "inplace", "label": "uint256[3]", "numberOfBytes": "64"},
+			"t_array(t_uint128)3_storage": {"base": "t_uint128", "encoding": "inplace", "label": "uint128[3]", "numberOfBytes": "64"}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := memoryStorage(map[common.Hash]common.Hash{
+		slotN(0): {}, slotN(1): {}, slotN(2): {}, slotN(3): slotN(1),
+	})
+
+	tests := []struct {
+		path    string
+		want    interface{}
+		wantErr string
+	}{
+		{path: "huge", wantErr: "uint256[99999999999] has 99999999999 elements"},
+		{path: "short", wantErr: "uint256[3] has 3 elements but is 64 bytes"},
+		{path: "packed", want: []interface{}{"0", "0", "1"}},
+	}
+	for _, tt := range tests {
+		location, err := layout.Locate(tt.path)
+		if err != nil {
+			t.Fatalf("Locate(%q): %v", tt.path, err)
+		}
+		got, err := layout.DecodeStorageValue(storage, location)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(errorText(err), tt.wantErr) {
+				t.Errorf("DecodeStorageValue(%q) error = %v, want %q", tt.path, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("DecodeStorageValue(%q): %v", tt.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("DecodeStorageValue(%q) = %#v, want %#v", tt.path, got, tt.want)
+		}
+	}
+}
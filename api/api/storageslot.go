@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// maxStorageReadSlots caps the slots of one multi-slot storage read
+const maxStorageReadSlots = 1000
+
+// ParseSlot reads a storage slot given as 0x hex of up to 32 bytes or as a
+// uint256 decimal.
+func ParseSlot(value string) (common.Hash, error) {
+	value = strings.TrimSpace(value)
+	base, digits := 10, value
+	if strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X") {
+		base, digits = 16, value[2:]
+	}
+	slot, ok := new(big.Int).SetString(digits, base)
+	if !ok || digits == "" || slot.Sign() < 0 || slot.Cmp(abi.MaxUint256) > 0 {
+		return common.Hash{}, fmt.Errorf("invalid slot %q, expected 32-byte hex or a uint256 decimal", value)
+	}
+	return common.BigToHash(slot), nil
+}
+
+// NamespaceSlot is the ERC-7201 root of a namespace id:
+// keccak256(abi.encode(uint256(keccak256(id)) - 1)) & ~bytes32(uint256(0xff)).
+func NamespaceSlot(id string) common.Hash {
+	inner := new(big.Int).SetBytes(crypto.Keccak256([]byte(id)))
+	inner.Sub(inner, common.Big1).And(inner, abi.MaxUint256)
+	root := crypto.Keccak256Hash(common.BigToHash(inner).Bytes())
+	root[common.HashLength-1] = 0
+	return root
+}
+
+// MappingSlot is the slot of a mapping value: keccak256(key . slot), with the
+// key padded to a word for value types and as is for strings and bytes.
+func MappingSlot(key []byte, slot common.Hash) common.Hash {
+	return crypto.Keccak256Hash(key, slot.Bytes())
+}
+
+// ArrayElementSlot locates element index of size bytes in array data starting
+// at slot, returning its slot and byte offset. Elements of up to 16 bytes
+// share slots, larger ones start a new slot each.
+func ArrayElementSlot(slot common.Hash, index *big.Int, size int) (common.Hash, int) {
+	if size <= 16 {
+		perSlot := big.NewInt(int64(32 / size))
+		word, position := new(big.Int).QuoRem(index, perSlot, new(big.Int))
+		return addSlot(slot, word), int(position.Int64()) * size
+	}
+	words := big.NewInt(int64((size + 31) / 32))
+	return addSlot(slot, new(big.Int).Mul(index, words)), 0
+}
+
+// addSlot adds n to slot modulo 2^256.
+func addSlot(slot common.Hash, n *big.Int) common.Hash {
+	sum := new(big.Int).Add(slot.Big(), n)
+	return common.BigToHash(sum.And(sum, abi.MaxUint256))
+}
+
+// EncodeMappingKey pads a value type key to the word solc hashes: numbers,
+// bools and addresses on the left, fixed bytes on the right.
+func EncodeMappingKey(keyType abi.Type, key string) ([]byte, error) {
+	value, err := ParseAbiValue(keyType, key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s key %q: %v", keyType.String(), key, err)
+	}
+	encoded, err := abi.Arguments{{Type: keyType}}.Pack(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s key %q: %v", keyType.String(), key, err)
+	}
+	return encoded, nil
+}
+
+// DeriveStorageSlot applies steps to the slot base, one per nesting level:
+//
+//	<type>:<key>          mapping key of a Solidity type, e.g. address:0xabc,
+//	                      uint256:5, bytes32:0x.., string:alice or bytes:0x..
+//	index:<i>[:<bytes>]   dynamic array element, 32 bytes unless given
+//	field:<n>             n slots further, a struct member or static element
+//
+// It returns the slot after every step; the last one is the derived slot.
+func DeriveStorageSlot(base common.Hash, steps []string) ([]StorageSlotStep, error) {
+	derived := make([]StorageSlotStep, 0, len(steps))
+	slot := base
+	for _, step := range steps {
+		kind, value, ok := strings.Cut(strings.TrimSpace(step), ":")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid step %q, expected <type>:<key>, index:<i> or field:<n>", step)
+		}
+
+		offset := 0
+		switch kind {
+		case "index":
+			indexValue, sizeValue, sized := strings.Cut(value, ":")
+			index, err := parseBigInt(indexValue)
+			if err != nil || index.Sign() < 0 {
+				return nil, fmt.Errorf("invalid array index in step %q", step)
+			}
+			size := 32
+			if sized {
+				var err error
+				if size, err = strconv.Atoi(sizeValue); err != nil || size <= 0 {
+					return nil, fmt.Errorf("invalid element size in step %q", step)
+				}
+			}
+			slot, offset = ArrayElementSlot(crypto.Keccak256Hash(slot.Bytes()), index, size)
+
+		case "field":
+			n, err := parseBigInt(value)
+			if err != nil || n.Sign() < 0 {
+				return nil, fmt.Errorf("invalid field offset in step %q", step)
+			}
+			slot = addSlot(slot, n)
+
+		case "string":
+			slot = MappingSlot([]byte(value), slot)
+
+		case "bytes":
+			key, err := hexutil.Decode(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid bytes key in step %q: %v", step, err)
+			}
+			slot = MappingSlot(key, slot)
+
+		default:
+			keyType, err := ParseAbiType(kind)
+			if err != nil {
+				return nil, fmt.Errorf("invalid key type in step %q: %v", step, err)
+			}
+			switch keyType.T {
+			case abi.UintTy, abi.IntTy, abi.AddressTy, abi.BoolTy, abi.FixedBytesTy:
+			default:
+				return nil, fmt.Errorf("%s cannot be a mapping key", keyType.String())
+			}
+			key, err := EncodeMappingKey(keyType, value)
+			if err != nil {
+				return nil, err
+			}
+			slot = MappingSlot(key, slot)
+		}
+		derived = append(derived, StorageSlotStep{Step: step, Slot: slot.Hex(), Offset: offset})
+	}
+	return derived, nil
+}
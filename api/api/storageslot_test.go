@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	// keccak256 of the slots 0 and 1, where the data of dynamic arrays and
+	// long strings declared there starts
+	slot0Data = common.HexToHash("0x290decd9548b62a8d60345a988386fc84ba6bc95484008f6362f93160ef3e563")
+	slot1Data = common.HexToHash("0xb10e2d527612073b26eecdfd717e6a320cf44b4afac2b0732d9fcbe2b7fa0cf6")
+)
+
+func TestNamespaceSlot(t *testing.T) {
+	tests := []struct {
+		id   string
+		want string
+	}{
+		// the example of ERC-7201
+		{id: "example.main", want: "0x183a6125c38840424c4a85fa12bab2ab606c4b6d0e7cc73c0c06ba5300eab500"},
+		// OpenZeppelin Contracts 5
+		{id: "openzeppelin.storage.ERC20", want: "0x52c63247e1f47db19d5ce0460030c497f067ca4cebf71ba98eeadabe20bace00"},
+		{id: "openzeppelin.storage.Ownable", want: "0x9016d09d72d40fdae2fd8ceac6b6234c7706214fd39c1cd1e609a0528c199300"},
+	}
+	for _, tt := range tests {
+		if got := NamespaceSlot(tt.id).Hex(); got != tt.want {
+			t.Errorf("NamespaceSlot(%q) = %s, want %s", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestMappingSlot(t *testing.T) {
+	tests := []struct {
+		name string
+		key  []byte
+		slot common.Hash
+		want []byte // the preimage solc hashes
+	}{
+		{
+			name: "address key",
+			key:  common.LeftPadBytes(common.FromHex("0xd8da6bf26964af9d7eed9e03e53415d37aa96045"), 32),
+			slot: common.BigToHash(big.NewInt(3)),
+			want: common.FromHex("0x000000000000000000000000d8da6bf26964af9d7eed9e03e53415d37aa96045" +
+				"0000000000000000000000000000000000000000000000000000000000000003"),
+		},
+		{
+			name: "string key",
+			key:  []byte("alice"),
+			slot: common.Hash{},
+			want: append([]byte("alice"), make([]byte, 32)...),
+		},
+	}
+	for _, tt := range tests {
+		if got, want := MappingSlot(tt.key, tt.slot), crypto.Keccak256Hash(tt.want); got != want {
+			t.Errorf("%s: MappingSlot = %s, want %s", tt.name, got.Hex(), want.Hex())
+		}
+	}
+}
+
+func TestArrayElementSlot(t *testing.T) {
+	maxSlot := common.BigToHash(abi.MaxUint256)
+	tests := []struct {
+		name   string
+		slot   common.Hash
+		index  int64
+		size   int
+		want   common.Hash
+		offset int
+	}{
+		{name: "word elements", slot: slot0Data, index: 2, size: 32, want: addSlot(slot0Data, big.NewInt(2))},
+		{name: "first uint128", slot: slot0Data, index: 0, size: 16, want: slot0Data},
+		{name: "second uint128 shares the slot", slot: slot0Data, index: 1, size: 16, want: slot0Data, offset: 16},
+		{name: "uint128 in the next slot", slot: slot0Data, index: 3, size: 16, want: addSlot(slot0Data, big.NewInt(1)), offset: 16},
+		{name: "bytes1 packing", slot: slot0Data, index: 33, size: 1, want: addSlot(slot0Data, big.NewInt(1)), offset: 1},
+		{name: "addresses take a slot each", slot: slot0Data, index: 1, size: 20, want: addSlot(slot0Data, big.NewInt(1))},
+		{name: "two-word structs", slot: slot0Data, index: 2, size: 64, want: addSlot(slot0Data, big.NewInt(4))},
+		{name: "wraps around", slot: maxSlot, index: 1, size: 32, want: common.Hash{}},
+	}
+	for _, tt := range tests {
+		got, offset := ArrayElementSlot(tt.slot, big.NewInt(tt.index), tt.size)
+		if got != tt.want || offset != tt.offset {
+			t.Errorf("%s: ArrayElementSlot = (%s, %d), want (%s, %d)", tt.name, got.Hex(), offset, tt.want.Hex(), tt.offset)
+		}
+	}
+}
+
+func TestDeriveStorageSlot(t *testing.T) {
+	holder := common.FromHex("0x000000000000000000000000d8da6bf26964af9d7eed9e03e53415d37aa96045")
+	balance := MappingSlot(holder, common.Hash{})
+
+	tests := []struct {
+		name    string
+		base    common.Hash
+		steps   []string
+		want    []StorageSlotStep
+		wantErr bool
+	}{
+		{
+			name:  "array element",
+			base:  common.Hash{},
+			steps: []string{"index:0"},
+			want:  []StorageSlotStep{{Step: "index:0", Slot: slot0Data.Hex()}},
+		},
+		{
+			name:  "packed array element",
+			base:  common.BigToHash(big.NewInt(1)),
+			steps: []string{"index:1:16"},
+			want:  []StorageSlotStep{{Step: "index:1:16", Slot: slot1Data.Hex(), Offset: 16}},
+		},
+		{
+			name:  "mapping then struct member",
+			base:  common.Hash{},
+			steps: []string{"address:0xd8da6bf26964af9d7eed9e03e53415d37aa96045", "field:2"},
+			want: []StorageSlotStep{
+				{Step: "address:0xd8da6bf26964af9d7eed9e03e53415d37aa96045", Slot: balance.Hex()},
+				{Step: "field:2", Slot: addSlot(balance, big.NewInt(2)).Hex()},
+			},
+		},
+		{
+			name:  "uint key",
+			base:  common.BigToHash(big.NewInt(3)),
+			steps: []string{"uint256:5"},
+			want:  []StorageSlotStep{{Step: "uint256:5", Slot: MappingSlot(common.BigToHash(big.NewInt(5)).Bytes(), common.BigToHash(big.NewInt(3))).Hex()}},
+		},
+		{
+			name:  "bytes32 key",
+			base:  common.Hash{},
+			steps: []string{"bytes4:0xa9059cbb"},
+			want:  []StorageSlotStep{{Step: "bytes4:0xa9059cbb", Slot: MappingSlot(common.RightPadBytes(common.FromHex("0xa9059cbb"), 32), common.Hash{}).Hex()}},
+		},
+		{
+			name:  "string key",
+			base:  common.Hash{},
+			steps: []string{"string:alice"},
+			want:  []StorageSlotStep{{Step: "string:alice", Slot: MappingSlot([]byte("alice"), common.Hash{}).Hex()}},
+		},
+		{
+			name:  "bytes key",
+			base:  common.Hash{},
+			steps: []string{"bytes:0x0102"},
+			want:  []StorageSlotStep{{Step: "bytes:0x0102", Slot: MappingSlot([]byte{1, 2}, common.Hash{}).Hex()}},
+		},
+		{name: "no steps", base: common.Hash{}, steps: []string{}, want: []StorageSlotStep{}},
+		{name: "missing value", steps: []string{"index"}, wantErr: true},
+		{name: "empty value", steps: []string{"string:"}, wantErr: true},
+		{name: "negative index", steps: []string{"index:-1"}, wantErr: true},
+		{name: "zero element size", steps: []string{"index:1:0"}, wantErr: true},
+		{name: "invalid field", steps: []string{"field:x"}, wantErr: true},
+		{name: "invalid bytes key", steps: []string{"bytes:zz"}, wantErr: true},
+		{name: "unknown key type", steps: []string{"uint7:1"}, wantErr: true},
+		{name: "array key type", steps: []string{"uint256[]:1"}, wantErr: true},
+		{name: "key out of range", steps: []string{"uint8:300"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := DeriveStorageSlot(tt.base, tt.steps)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: DeriveStorageSlot(%v) = %v, want an error", tt.name, tt.steps, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: DeriveStorageSlot(%v): %v", tt.name, tt.steps, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: DeriveStorageSlot(%v) = %v, want %v", tt.name, tt.steps, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	utils "generic-evm-api-go/api/pkg/utils"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// callTracerFrame is a frame as the callTracer reports it, from a node's
+// debug_traceCall or from a Fork.
+type callTracerFrame struct {
+	Type         string            `json:"type"`
+	From         common.Address    `json:"from"`
+	To           *common.Address   `json:"to"`
+	Value        *hexutil.Big      `json:"value"`
+	Gas          hexutil.Uint64    `json:"gas"`
+	GasUsed      hexutil.Uint64    `json:"gasUsed"`
+	Input        hexutil.Bytes     `json:"input"`
+	Output       hexutil.Bytes     `json:"output"`
+	Error        string            `json:"error"`
+	RevertReason string            `json:"revertReason"`
+	Calls        []callTracerFrame `json:"calls"`
+}
+
+// TraceCall runs the call object arg with debug_traceCall and the callTracer
+// and decodes every frame of the call tree. The top frame is decoded with
+// methods and contractAbi, the caller's view of the call; inner frames with
+// the ABI bound to their address on chainId, then the registry and the
+// signature database. Nodes without the debug namespace answer with a 501.
+func TraceCall(
+	client *ethclient.Client,
+	chainId string,
+	arg map[string]interface{},
+	block *BlockRef,
+	overrides map[common.Address]OverrideAccount,
+	methods []abi.Method,
+	contractAbi *abi.ABI,
+) (*CallFrame, error) {
+	config := map[string]interface{}{"tracer": "callTracer"}
+	if len(overrides) > 0 {
+		config["stateOverrides"] = overrides
+	}
+
+	var frame *callTracerFrame
+	if err := client.Client().CallContext(context.Background(), &frame, "debug_traceCall", arg, block.rpcArg(), config); err != nil {
+		if debugUnsupported(err) {
+			return nil, utils.ErrNotImplemented(fmt.Sprintf("the node does not support debug_traceCall, the chain RPC needs the debug namespace enabled: %v", err))
+		}
+		return nil, fmt.Errorf("trace call failed: %w", err)
+	}
+	if frame == nil {
+		return nil, fmt.Errorf("trace call failed: the node returned no trace")
+	}
+
+	return decodeCallTrace(frame, chainId, methods, contractAbi), nil
+}
+
+// decodeCallTrace decodes a callTracer call tree like TraceCall.
+func decodeCallTrace(frame *callTracerFrame, chainId string, methods []abi.Method, contractAbi *abi.ABI) *CallFrame {
+	decoder := &traceDecoder{chainId: chainId, methods: methods, contractAbi: contractAbi}
+	return decoder.decode(frame, true)
+}
+
+// debugUnsupported reports whether err says the node does not serve the debug
+// method called, either as the JSON-RPC method not found code or as one of
+// the messages nodes and providers send instead.
+func debugUnsupported(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == -32601 {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	if !strings.Contains(message, "method") && !strings.Contains(message, "debug_") {
+		return false
+	}
+	for _, phrase := range []string{"does not exist", "not available", "not found", "not supported", "unsupported", "not allowed", "not whitelisted"} {
+		if strings.Contains(message, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+type traceDecoder struct {
+	chainId     string
+	methods     []abi.Method
+	contractAbi *abi.ABI
+}
+
+func (d *traceDecoder) decode(frame *callTracerFrame, top bool) *CallFrame {
+	decoded := &CallFrame{
+		Type:    frame.Type,
+		From:    frame.From.Hex(),
+		Gas:     uint64(frame.Gas),
+		GasUsed: uint64(frame.GasUsed),
+		Input:   hexutil.Encode(frame.Input),
+		Error:   frame.Error,
+	}
+	if frame.To != nil {
+		decoded.To = frame.To.Hex()
+	}
+	if frame.Value != nil {
+		decoded.Value = frame.Value.ToInt().String()
+	}
+	if len(frame.Output) > 0 {
+		decoded.Output = hexutil.Encode(frame.Output)
+	}
+
+	contractAbi := d.contractAbi
+	if !top {
+		contractAbi = nil
+		if frame.To != nil {
+			if registered, ok := GetAbiRegistry().Lookup(d.chainId, *frame.To); ok {
+				contractAbi = &registered.ABI
+			}
+		}
+	}
+
+	// Create frames carry init code in and runtime code out, not calldata
+	if frame.To != nil && len(frame.Input) >= 4 && !strings.HasPrefix(frame.Type, "CREATE") {
+		if method, args, err := DecodeCalldata(frame.Input, d.candidates(frame.Input[:4], contractAbi, top)); err == nil {
+			decoded.Function = method.RawName
+			decoded.Signature = method.Sig
+			decoded.Args = NamedAbiValues(method.Inputs, args)
+			if frame.Error == "" && len(method.Outputs) > 0 {
+				if outputs, err := DecodeAbiValues(method.Outputs, frame.Output); err == nil {
+					decoded.Outputs = NamedAbiValues(method.Outputs, outputs)
+				}
+			}
+		}
+	}
+
+	if frame.Error != "" {
+		if len(frame.Output) > 0 {
+			decoded.Revert = DecodeRevert(frame.Output, contractAbi)
+		} else if frame.RevertReason != "" {
+			decoded.Revert = &Revert{Data: "0x", Kind: "error", Reason: frame.RevertReason}
+		}
+	}
+
+	for i := range frame.Calls {
+		decoded.Calls = append(decoded.Calls, d.decode(&frame.Calls[i], false))
+	}
+	return decoded
+}
+
+// candidates lists the methods a frame's calldata may decode as, the caller's
+// own first.
+func (d *traceDecoder) candidates(selector []byte, contractAbi *abi.ABI, top bool) []abi.Method {
+	seen := make(map[string]struct{})
+	candidates := []abi.Method{}
+	add := func(method abi.Method) {
+		if _, ok := seen[method.Sig]; ok {
+			return
+		}
+		seen[method.Sig] = struct{}{}
+		candidates = append(candidates, method)
+	}
+
+	if top {
+		for _, method := range d.methods {
+			add(method)
+		}
+	}
+	if contractAbi != nil {
+		if method, err := contractAbi.MethodById(selector); err == nil {
+			add(*method)
+		}
+	}
+	for _, method := range GetAbiRegistry().MethodsBySelector(selector) {
+		add(method)
+	}
+	for _, method := range GetSignatureDB().Methods(selector) {
+		add(method)
+	}
+	return candidates
+}
@@ -0,0 +1,262 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	utils "generic-evm-api-go/api/pkg/utils"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const setCodeTxType = 0x04 // EIP-7702
+
+var transactionTypeNames = map[uint64]string{
+	types.LegacyTxType:     "legacy",
+	types.AccessListTxType: "access-list",
+	types.DynamicFeeTxType: "dynamic-fee",
+	types.BlobTxType:       "blob",
+	setCodeTxType:          "set-code",
+}
+
+// rpcTransaction is a transaction as eth_getTransactionByHash returns it.
+// It is decoded by hand rather than as a types.Transaction so transaction
+// types go-ethereum does not know yet, like EIP-7702, still come through.
+type rpcTransaction struct {
+	Type                 hexutil.Uint64     `json:"type"`
+	Hash                 common.Hash        `json:"hash"`
+	From                 common.Address     `json:"from"`
+	To                   *common.Address    `json:"to"`
+	Nonce                hexutil.Uint64     `json:"nonce"`
+	Value                *hexutil.Big       `json:"value"`
+	Gas                  hexutil.Uint64     `json:"gas"`
+	GasPrice             *hexutil.Big       `json:"gasPrice"`
+	MaxFeePerGas         *hexutil.Big       `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big       `json:"maxPriorityFeePerGas"`
+	MaxFeePerBlobGas     *hexutil.Big       `json:"maxFeePerBlobGas"`
+	Input                hexutil.Bytes      `json:"input"`
+	ChainId              *hexutil.Big       `json:"chainId"`
+	AccessList           *types.AccessList  `json:"accessList"`
+	BlobHashes           []common.Hash      `json:"blobVersionedHashes"`
+	AuthorizationList    []rpcAuthorization `json:"authorizationList"`
+	BlockNumber          *hexutil.Uint64    `json:"blockNumber"`
+	BlockHash            *common.Hash       `json:"blockHash"`
+	TransactionIndex     *hexutil.Uint64    `json:"transactionIndex"`
+}
+
+// rpcAuthorization is a signed EIP-7702 delegation.
+type rpcAuthorization struct {
+	ChainId hexutil.Big    `json:"chainId"`
+	Address common.Address `json:"address"`
+	Nonce   hexutil.Uint64 `json:"nonce"`
+	YParity hexutil.Uint64 `json:"yParity"`
+	R       hexutil.Big    `json:"r"`
+	S       hexutil.Big    `json:"s"`
+}
+
+// rpcReceipt holds the receipt fields reported, leaving out the bloom that
+// some chains do not fill in.
+type rpcReceipt struct {
+	Status            *hexutil.Uint64 `json:"status"`
+	GasUsed           hexutil.Uint64  `json:"gasUsed"`
+	CumulativeGasUsed hexutil.Uint64  `json:"cumulativeGasUsed"`
+	EffectiveGasPrice *hexutil.Big    `json:"effectiveGasPrice"`
+	BlobGasUsed       *hexutil.Uint64 `json:"blobGasUsed"`
+	BlobGasPrice      *hexutil.Big    `json:"blobGasPrice"`
+	ContractAddress   *common.Address `json:"contractAddress"`
+	Logs              []types.Log     `json:"logs"`
+}
+
+// GetTransaction fetches a transaction and, once it is mined, its receipt.
+// The receipt is nil while the transaction is pending.
+func GetTransaction(client *ethclient.Client, hash common.Hash) (*rpcTransaction, json.RawMessage, *rpcReceipt, error) {
+	var raw json.RawMessage
+	if err := client.Client().CallContext(context.Background(), &raw, "eth_getTransactionByHash", hash); err != nil {
+		return nil, nil, nil, fmt.Errorf("get transaction %s failed: %v", hash.Hex(), err)
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil, nil, utils.ErrNotFound(fmt.Sprintf("transaction %s %v", hash.Hex(), ethereum.NotFound))
+	}
+	var tx rpcTransaction
+	if err := json.Unmarshal(raw, &tx); err != nil {
+		return nil, nil, nil, fmt.Errorf("get transaction %s failed: %v", hash.Hex(), err)
+	}
+	if tx.BlockHash == nil {
+		return &tx, raw, nil, nil
+	}
+
+	var receipt *rpcReceipt
+	if err := client.Client().CallContext(context.Background(), &receipt, "eth_getTransactionReceipt", hash); err != nil {
+		return nil, nil, nil, fmt.Errorf("get receipt %s failed: %v", hash.Hex(), err)
+	}
+	return &tx, raw, receipt, nil
+}
+
+// FormatTransaction reports tx with its sender recovered from the signature
+// in raw, its input decoded and, for EIP-7702, the authority of every
+// authorization.
+func FormatTransaction(chainId string, tx *rpcTransaction, raw json.RawMessage) *EvmTransaction {
+	formatted := &EvmTransaction{
+		Hash:                 tx.Hash.Hex(),
+		Type:                 uint64(tx.Type),
+		TypeName:             transactionTypeNames[uint64(tx.Type)],
+		From:                 tx.From.Hex(),
+		Nonce:                uint64(tx.Nonce),
+		Value:                formatBig(tx.Value),
+		Gas:                  uint64(tx.Gas),
+		GasPrice:             formatBig(tx.GasPrice),
+		MaxFeePerGas:         formatBig(tx.MaxFeePerGas),
+		MaxPriorityFeePerGas: formatBig(tx.MaxPriorityFeePerGas),
+		MaxFeePerBlobGas:     formatBig(tx.MaxFeePerBlobGas),
+		ChainId:              formatBig(tx.ChainId),
+		Input:                hexutil.Encode(tx.Input),
+		BlobHashes:           make([]string, 0, len(tx.BlobHashes)),
+	}
+	if tx.To != nil {
+		formatted.To = tx.To.Hex()
+	}
+	if tx.AccessList != nil {
+		formatted.AccessList = *tx.AccessList
+	}
+	for _, hash := range tx.BlobHashes {
+		formatted.BlobHashes = append(formatted.BlobHashes, hash.Hex())
+	}
+	if tx.BlockHash != nil {
+		formatted.BlockHash = tx.BlockHash.Hex()
+	}
+	if tx.BlockNumber != nil {
+		number := uint64(*tx.BlockNumber)
+		formatted.BlockNumber = &number
+	}
+	if tx.TransactionIndex != nil {
+		index := uint64(*tx.TransactionIndex)
+		formatted.TxIndex = &index
+	}
+
+	if from, err := recoverSender(raw); err == nil {
+		formatted.From = from.Hex()
+		formatted.FromRecovered = true
+	}
+
+	for _, auth := range tx.AuthorizationList {
+		authorization := EvmAuthorization{
+			ChainId: auth.ChainId.ToInt().String(),
+			Address: auth.Address.Hex(),
+			Nonce:   uint64(auth.Nonce),
+		}
+		if authority, err := recoverAuthority(auth); err == nil {
+			authorization.Authority = authority.Hex()
+		}
+		formatted.Authorizations = append(formatted.Authorizations, authorization)
+	}
+
+	if tx.To != nil && len(tx.Input) >= 4 {
+		formatted.Decoded = decodeTransactionInput(chainId, *tx.To, tx.Input)
+	}
+	return formatted
+}
+
+// FormatReceipt reports a receipt with its logs decoded like evm-logs.
+func FormatReceipt(chainId string, receipt *rpcReceipt) *EvmReceipt {
+	formatted := &EvmReceipt{
+		GasUsed:           uint64(receipt.GasUsed),
+		CumulativeGasUsed: uint64(receipt.CumulativeGasUsed),
+		EffectiveGasPrice: formatBig(receipt.EffectiveGasPrice),
+		BlobGasPrice:      formatBig(receipt.BlobGasPrice),
+		Logs:              make([]EvmLog, 0, len(receipt.Logs)),
+	}
+	if receipt.Status != nil {
+		status := uint64(*receipt.Status)
+		formatted.Status = &status
+	}
+	if receipt.EffectiveGasPrice != nil {
+		fee := new(big.Int).Mul(receipt.EffectiveGasPrice.ToInt(), new(big.Int).SetUint64(uint64(receipt.GasUsed)))
+		formatted.Fee = fee.String()
+		formatted.FeeNative = formatUnits(fee, nativeDecimals)
+	}
+	if receipt.BlobGasUsed != nil {
+		formatted.BlobGasUsed = uint64(*receipt.BlobGasUsed)
+	}
+	if receipt.ContractAddress != nil && *receipt.ContractAddress != (common.Address{}) {
+		formatted.ContractAddress = receipt.ContractAddress.Hex()
+	}
+
+	resolver := &logEventResolver{chainId: chainId}
+	for _, log := range receipt.Logs {
+		formatted.Logs = append(formatted.Logs, resolver.DecodeLog(log))
+	}
+	return formatted
+}
+
+// recoverSender recovers the signer of a transaction of a type go-ethereum
+// can hash.
+func recoverSender(raw json.RawMessage) (common.Address, error) {
+	var tx types.Transaction
+	if err := tx.UnmarshalJSON(raw); err != nil {
+		return common.Address{}, err
+	}
+	return types.LatestSignerForChainID(tx.ChainId()).Sender(&tx)
+}
+
+// recoverAuthority recovers the account that signed an EIP-7702
+// authorization: keccak256(0x05 || rlp([chain_id, address, nonce])).
+func recoverAuthority(auth rpcAuthorization) (common.Address, error) {
+	r, s := auth.R.ToInt(), auth.S.ToInt()
+	if auth.YParity > 1 || !crypto.ValidateSignatureValues(byte(auth.YParity), r, s, true) {
+		return common.Address{}, fmt.Errorf("invalid authorization signature")
+	}
+
+	payload, err := rlp.EncodeToBytes([]interface{}{auth.ChainId.ToInt(), auth.Address, uint64(auth.Nonce)})
+	if err != nil {
+		return common.Address{}, err
+	}
+	hash := crypto.Keccak256(append([]byte{0x05}, payload...))
+
+	sig := make([]byte, crypto.SignatureLength)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:64])
+	sig[64] = byte(auth.YParity)
+	pub, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// decodeTransactionInput decodes calldata like decode-calldata with the ABI
+// bound to the recipient, the registry and the signature database. It
+// returns nil when no candidate decodes it.
+func decodeTransactionInput(chainId string, to common.Address, input []byte) *DecodeCalldataRequestResponse {
+	params := &DecodeCalldataRequestParams{ChainId: chainId, Address: to.Hex()}
+	candidates, sources, err := calldataCandidates(params, nil, input[:4])
+	if err != nil {
+		return nil
+	}
+	method, decoded, err := DecodeCalldata(input, candidates)
+	if err != nil {
+		return nil
+	}
+	return &DecodeCalldataRequestResponse{
+		Selector:  hexutil.Encode(input[:4]),
+		Function:  method.RawName,
+		Signature: method.Sig,
+		Args:      decoded,
+		NamedArgs: NamedAbiValues(method.Inputs, decoded),
+		Source:    sources[method.Sig],
+	}
+}
+
+func formatBig(n *hexutil.Big) string {
+	if n == nil {
+		return ""
+	}
+	return n.ToInt().String()
+}
@@ -1,11 +1,17 @@
 package utils
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"os"
 	"reflect"
+	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -69,6 +75,79 @@ func ParseAndValidateParams(r *http.Request, params interface{}) error {
 	return nil
 }
 
+// ParseIndexedParams collects query keys of the form name[i][type] and
+// name[i][value] into a parameter list ordered by index.
+func ParseIndexedParams(query url.Values, name string) ([]Parameter, error) {
+	keyRegex := regexp.MustCompile(`^` + regexp.QuoteMeta(name) + `\[([0-9]+)\]\[(type|value)\]$`)
+
+	byIndex := make(map[int]*Parameter)
+	for key, values := range query {
+		matches := keyRegex.FindStringSubmatch(key)
+		if matches == nil || len(values) == 0 {
+			continue
+		}
+		index, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return nil, ErrMalformedRequest(fmt.Sprintf("invalid index in %s", key))
+		}
+
+		param, ok := byIndex[index]
+		if !ok {
+			param = &Parameter{}
+			byIndex[index] = param
+		}
+		if matches[2] == "type" {
+			param.Type = values[0]
+		} else {
+			param.Value = values[0]
+		}
+	}
+
+	indexes := make([]int, 0, len(byIndex))
+	for index := range byIndex {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	params := make([]Parameter, 0, len(indexes))
+	for i, index := range indexes {
+		if index != i {
+			return nil, ErrMalformedRequest(fmt.Sprintf("%s[%d] is missing", name, i))
+		}
+		params = append(params, *byIndex[index])
+	}
+	return params, nil
+}
+
+// ParseJSONBody decodes the JSON body of a POST request into v. Numbers are
+// kept as json.Number so large integers survive. Requests without a body are
+// left untouched.
+func ParseJSONBody(r *http.Request, v interface{}) error {
+	if r == nil || r.Method != http.MethodPost || r.Body == nil || r.ContentLength == 0 {
+		return nil
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return ErrMalformedRequest(fmt.Sprintf("Invalid JSON body: %v", err))
+	}
+	return nil
+}
+
+// RequireAdmin checks the X-Admin-Key header against ADMIN_API_KEY. Admin
+// queries are disabled entirely while no key is configured.
+func RequireAdmin(r *http.Request) error {
+	adminKey := os.Getenv("ADMIN_API_KEY")
+	if adminKey == "" {
+		return ErrUnauthorized("Admin queries are disabled")
+	}
+	if r == nil || subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Key")), []byte(adminKey)) != 1 {
+		return ErrUnauthorized("Invalid admin key")
+	}
+	return nil
+}
+
 func GetOrigin() string {
 	pc, _, _, ok := runtime.Caller(2)
 	if !ok {
@@ -87,7 +166,7 @@ func EnableCORS(next http.Handler) http.Handler {
 		// Set CORS headers
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Admin-Key")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 
 		// Handle preflight requests
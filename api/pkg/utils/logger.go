@@ -94,3 +94,36 @@ func ErrInternal(message string) Error {
 		Origin:  origin,
 	}
 }
+
+func ErrUnauthorized(message string) error {
+	origin := GetOrigin()
+
+	return Error{
+		Code:    401,
+		Message: "Unauthorized",
+		Details: message,
+		Origin:  origin,
+	}
+}
+
+func ErrNotImplemented(message string) error {
+	origin := GetOrigin()
+
+	return Error{
+		Code:    501,
+		Message: "Not implemented",
+		Details: message,
+		Origin:  origin,
+	}
+}
+
+func ErrNotFound(message string) error {
+	origin := GetOrigin()
+
+	return Error{
+		Code:    404,
+		Message: "Not found",
+		Details: message,
+		Origin:  origin,
+	}
+}
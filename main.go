@@ -66,6 +66,10 @@ func main() {
 
 	logrus.Warning("program starting in debug mode...")
 
+	// Load registered contract ABIs and signatures up front so file errors show at startup
+	handler.GetAbiRegistry()
+	handler.GetSignatureDB()
+
 	http.HandleFunc("/api/api", handler.Handler)
 
 	log.Println("Starting server on :8080")